@@ -1,37 +1,159 @@
 package main
 
 import (
-	"log"
-	"net/http"
+	"fmt"
+	"io"
+	"log/slog"
 	"os"
+	"strings"
+	"text/tabwriter"
 
 	_ "github.com/go-sql-driver/mysql"
-	"github.com/gorilla/mux"
-	"github.com/joho/godotenv"
-	"github.com/teojiahao/HireMe/pkg/api"
-	"github.com/teojiahao/HireMe/pkg/handler"
+	"github.com/teojiahao/HireMe/pkg/config"
+	"github.com/teojiahao/HireMe/pkg/content"
+	"github.com/teojiahao/HireMe/pkg/database"
+	"github.com/teojiahao/HireMe/pkg/email"
+	"github.com/teojiahao/HireMe/pkg/logging"
+	"github.com/teojiahao/HireMe/pkg/security"
 )
 
-func init() {
-	err := godotenv.Load()
-	if err != nil {
-		log.Fatal("Error loading .env file")
+// command is one of the subcommands of the binary
+type command struct {
+	name  string
+	usage string
+	run   func(cfg config.Config, d deps, args []string) error
+}
+
+// deps are built by setup from the config and handed to the commands
+type deps struct {
+	db         *database.DB
+	keyring    *security.Keyring
+	passwords  *security.Passwords
+	disposable *email.DisposableList
+	messages   content.Policy
+}
+
+// commands in the order shown by help, serve runs when none is given
+var commands = []command{
+	{"serve", "run the pages and the api, the default", serve},
+	{"migrate", "bring the database schema up to date, -status lists the migrations", migrate},
+	{"user", "create, list, show, disable, enable, delete or reset-password of users", userCommand},
+	{"apikey", "issue or revoke the access key of a user", apikeyCommand},
+	{"seed", "add demo users with a profile for development", seed},
+	{"rotate-keys", "seal every encrypted column under the primary encryption key", rotateKeys},
+}
+
+// usage lists the commands
+func usage(w io.Writer) {
+	fmt.Fprintln(w, "usage: HireMe [command] [flags] [args]")
+	fmt.Fprintln(w)
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	for _, c := range commands {
+		fmt.Fprintf(tw, "  %s\t%s\n", c.name, c.usage)
 	}
+	tw.Flush()
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, "run HireMe <command> -h for the flags of a command")
 }
 
 func main() {
-	router := mux.NewRouter()
-	router.HandleFunc("/", handler.Index)
-	router.HandleFunc("/activity", handler.Activity)
-	router.HandleFunc("/updateProfile", handler.UpdateProfile)
-	router.HandleFunc("/signup", handler.Signup)
-	router.HandleFunc("/login", handler.Login)
-	router.HandleFunc("/logout", handler.Logout)
-
-	router.HandleFunc("/api/v1/login", api.Login).Methods("POST")
-	router.HandleFunc("/api/v1/users", api.AllUsers)
-	router.HandleFunc("/api/v1/users/{username}", api.User).Methods("GET", "PUT", "POST", "DELETE", "PATCH")
-
-	log.Println("Listening at port", os.Getenv("PORT"))
-	log.Fatal(http.ListenAndServeTLS(":"+os.Getenv("PORT"), "cert/cert.pem", "cert/key.pem", router))
+	name, args := "serve", os.Args[1:]
+	if len(args) > 0 && !strings.HasPrefix(args[0], "-") {
+		name, args = args[0], args[1:]
+	}
+	if name == "help" {
+		usage(os.Stdout)
+		return
+	}
+	var cmd *command
+	for i := range commands {
+		if commands[i].name == name {
+			cmd = &commands[i]
+		}
+	}
+	if cmd == nil {
+		fmt.Fprintf(os.Stderr, "unknown command %q\n\n", name)
+		usage(os.Stderr)
+		os.Exit(2)
+	}
+
+	// the server logs to stdout, the other commands keep it for what they print
+	logs := os.Stderr
+	if cmd.name == "serve" {
+		logs = os.Stdout
+	}
+
+	// redact from the first line, the level and format are only known once the config is
+	logging.Setup(logs, "json", slog.LevelInfo)
+
+	cfg, d := setup(logs)
+	if err := cmd.run(cfg, d, args); err != nil {
+		fatal("running "+cmd.name, err)
+	}
+}
+
+// setup loads the config and sets up the keys, the password rules and the database
+// every command shares, it exits when any of them is wrong
+func setup(logs io.Writer) (config.Config, deps) {
+	// every setting is read and checked once, all the problems are reported together
+	cfg, err := config.Load(".env", os.LookupEnv)
+	if err != nil {
+		if errs, ok := err.(config.Errors); ok {
+			for _, e := range errs {
+				slog.Error("invalid config", "error", e)
+			}
+		}
+		fatal("loading config", err)
+	}
+
+	// the level and format are checked by Validate
+	level, _ := logging.ParseLevel(cfg.Log.Level)
+	logging.Setup(logs, cfg.Log.Format, level)
+
+	// fail closed, nothing should be sealed with a key baked into the source
+	keyring, err := security.LoadKeyring(cfg.Encryption.Keys, cfg.Encryption.KeyFile)
+	if err != nil {
+		fatal("loading encryption keys", err)
+	}
+	if cfg.Encryption.LegacyKey != "" {
+		keyring.AllowLegacy(cfg.Encryption.LegacyKey)
+	}
+	d := deps{keyring: keyring}
+
+	if err := cfg.PasswordParams().Validate(); err != nil {
+		fatal("in password hashing settings", err)
+	}
+
+	policy, err := cfg.PasswordPolicy()
+	if err == nil {
+		d.passwords, err = security.NewPasswords(keyring, cfg.PasswordParams(), policy)
+	}
+	if err != nil {
+		fatal("in password policy", err)
+	}
+
+	if cfg.DisposableEmailFile != "" {
+		if d.disposable, err = email.LoadDisposableList(cfg.DisposableEmailFile); err != nil {
+			fatal("loading disposable email domains", err)
+		}
+	}
+
+	d.messages, err = cfg.ContentPolicy()
+	if err == nil {
+		err = d.messages.Validate()
+	}
+	if err != nil {
+		fatal("in content policy", err)
+	}
+
+	if d.db, err = database.Open(cfg.Database, keyring); err != nil {
+		fatal("opening database", err)
+	}
+	return cfg, d
+}
+
+// fatal logs what failed and exits
+func fatal(doing string, err error) {
+	slog.Error("error "+doing, "error", err)
+	os.Exit(1)
 }
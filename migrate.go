@@ -0,0 +1,48 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log/slog"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"github.com/teojiahao/HireMe/pkg/config"
+)
+
+// migrate runs the migrate command which applies the pending schema migrations,
+// it is safe to run again and from several instances at once
+func migrate(_ config.Config, d deps, args []string) error {
+	flags := flag.NewFlagSet("migrate", flag.ExitOnError)
+	status := flags.Bool("status", false, "only list the migrations applied and pending")
+	flags.Parse(args)
+	ctx := context.Background()
+
+	if *status {
+		applied, pending, err := d.db.MigrationStatus(ctx)
+		if err != nil {
+			return err
+		}
+		tw := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(tw, "VERSION\tNAME\tAPPLIED")
+		for _, m := range applied {
+			fmt.Fprintf(tw, "%d\t%s\t%s\n", m.Version, m.Name, m.Applied.Local().Format(time.RFC3339))
+		}
+		for _, m := range pending {
+			fmt.Fprintf(tw, "%d\t%s\tpending\n", m.Version, m.Name)
+		}
+		return tw.Flush()
+	}
+
+	done, err := d.db.Migrate(ctx)
+	for _, m := range done {
+		slog.Info("migrated", "version", m.Version, "name", m.Name)
+	}
+	if err != nil {
+		return err
+	}
+	slog.Info("schema is up to date", "applied", len(done))
+	return nil
+}
@@ -0,0 +1,141 @@
+// Package alert finds suspicious logins and tells the user about them
+package alert
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	uuid "github.com/satori/go.uuid"
+	"github.com/teojiahao/HireMe/pkg/queue"
+)
+
+// Reason is why a login was flagged
+type Reason string
+
+// All the reason a login can be flagged
+const (
+	RepeatedFailures Reason = "repeated_failures"
+	NewIP            Reason = "new_ip"
+	NewUserAgent     Reason = "new_user_agent"
+	LongInactivity   Reason = "long_inactivity"
+)
+
+var reasonLabel = map[Reason]string{
+	RepeatedFailures: "Repeated failed logins",
+	NewIP:            "Login from a new IP address",
+	NewUserAgent:     "Login from a new browser or device",
+	LongInactivity:   "Login after a long time without activity",
+}
+
+// Label return the human readable reason
+func (r Reason) Label() string {
+	if label, ok := reasonLabel[r]; ok {
+		return label
+	}
+	return string(r)
+}
+
+// Alert is a login flagged as suspicious
+type Alert struct {
+	ID       string
+	Username string
+	Reason   Reason
+	// Event is the login that was flagged
+	Event queue.History
+	// Confirmed is set once the user said the login was them
+	Confirmed bool
+}
+
+// New return an alert with a fresh ID
+func New(username string, reason Reason, event queue.History) Alert {
+	return Alert{
+		ID:       uuid.NewV4().String(),
+		Username: username,
+		Reason:   reason,
+		Event:    event,
+	}
+}
+
+// Message return the text sent to the user
+func (a Alert) Message() string {
+	return fmt.Sprintf("%s on your HireMe account %s.\n\nTime: %s\nIP: %s\nBrowser: %s\n\nIf this was you, confirm it on your activity page. If not, change your password right away.",
+		a.Reason.Label(), a.Username, a.Event.Time.Format(time.RFC1123), a.Event.IP, a.Event.UserAgent)
+}
+
+// Store keeps the alerts so the user can review them in the app
+type Store interface {
+	Notifier
+	// Pending return the alerts the user has not confirmed, newest first
+	Pending(username string) ([]Alert, error)
+	// Confirm marks the alert as done by the user
+	Confirm(username, id string) error
+}
+
+// MemoryStore is a Store kept in memory, holding the newest alerts of every user
+type MemoryStore struct {
+	mutex  sync.Mutex
+	alerts map[string]*queue.Ring[Alert]
+}
+
+// NewMemoryStore return an empty MemoryStore
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{alerts: map[string]*queue.Ring[Alert]{}}
+}
+
+// Notify keeps the alert for the user to review
+func (m *MemoryStore) Notify(a Alert) error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	if _, ok := m.alerts[a.Username]; !ok {
+		m.alerts[a.Username] = queue.NewRing[Alert](queue.DefaultLimit, queue.DropOldest)
+	}
+	return m.alerts[a.Username].Push(a)
+}
+
+// Pending return the alerts the user has not confirmed, newest first
+func (m *MemoryStore) Pending(username string) ([]Alert, error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	pending := []Alert{}
+	if ring, ok := m.alerts[username]; ok {
+		ring.DoReverse(func(a Alert) bool {
+			if !a.Confirmed {
+				pending = append(pending, a)
+			}
+			return true
+		})
+	}
+	return pending, nil
+}
+
+// Confirm marks the alert as done by the user
+func (m *MemoryStore) Confirm(username, id string) error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	ring, ok := m.alerts[username]
+	if !ok {
+		return fmt.Errorf("alert not found")
+	}
+
+	alerts := ring.Snapshot()
+	found := false
+	for i := range alerts {
+		if alerts[i].ID == id {
+			alerts[i].Confirmed = true
+			found = true
+		}
+	}
+	if !found {
+		return fmt.Errorf("alert not found")
+	}
+
+	ring.Clear()
+	for _, a := range alerts {
+		ring.Push(a)
+	}
+	return nil
+}
@@ -0,0 +1,145 @@
+package alert
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	. "github.com/franela/goblin"
+	"github.com/teojiahao/HireMe/pkg/queue"
+)
+
+type failingNotifier struct{}
+
+func (failingNotifier) Notify(a Alert) error {
+	return fmt.Errorf("down")
+}
+
+func TestAlert(t *testing.T) {
+	gob := Goblin(t)
+	now := time.Now()
+	login := func(kind queue.Kind, ip, agent string, at time.Time) queue.History {
+		return queue.History{Kind: kind, Time: at, IP: ip, UserAgent: agent}
+	}
+	reasons := func(alerts []Alert) []Reason {
+		r := []Reason{}
+		for _, a := range alerts {
+			r = append(r, a.Reason)
+		}
+		return r
+	}
+
+	gob.Describe("Detector Test", func() {
+		activities := queue.NewMemoryStore(queue.Retention{MaxEntries: 100})
+		detector := &Detector{
+			Activities:    activities,
+			MaxFailures:   3,
+			FailureWindow: 15 * time.Minute,
+			Inactivity:    30 * 24 * time.Hour,
+		}
+
+		gob.It("should not flag the first login", func() {
+			event := login(queue.LoginSuccess, "1.1.1.1", "firefox", now.Add(-time.Hour))
+			alerts, err := detector.Inspect("jiahao", event)
+			gob.Assert(err).IsNil()
+			gob.Assert(len(alerts)).Equal(0)
+			activities.Add("jiahao", event)
+		})
+
+		gob.It("should flag repeated failures once", func() {
+			for i := 1; i <= 4; i++ {
+				event := login(queue.LoginFailure, "2.2.2.2", "curl", now)
+				alerts, _ := detector.Inspect("jiahao", event)
+				if i == 3 {
+					gob.Assert(reasons(alerts)).Equal([]Reason{RepeatedFailures})
+				} else {
+					gob.Assert(len(alerts)).Equal(0)
+				}
+				activities.Add("jiahao", event)
+			}
+		})
+
+		gob.It("should not look at logins of accounts there are not", func() {
+			unknown := &Detector{
+				Activities:    activities,
+				MaxFailures:   1,
+				FailureWindow: 15 * time.Minute,
+				Exists:        func(username string) bool { return username == "jiahao" },
+			}
+			alerts, _ := unknown.Inspect("nobody", login(queue.LoginFailure, "2.2.2.2", "curl", now))
+			gob.Assert(len(alerts)).Equal(0)
+			// the same failure is flagged once nobody is taken as an account
+			unknown.Exists = nil
+			alerts, _ = unknown.Inspect("nobody", login(queue.LoginFailure, "2.2.2.2", "curl", now))
+			gob.Assert(reasons(alerts)).Equal([]Reason{RepeatedFailures})
+		})
+
+		gob.It("should flag a new ip and browser", func() {
+			alerts, _ := detector.Inspect("jiahao", login(queue.LoginSuccess, "1.1.1.1", "firefox", now))
+			gob.Assert(len(alerts)).Equal(0)
+
+			alerts, _ = detector.Inspect("jiahao", login(queue.LoginSuccess, "3.3.3.3", "firefox", now))
+			gob.Assert(reasons(alerts)).Equal([]Reason{NewIP})
+
+			alerts, _ = detector.Inspect("jiahao", login(queue.LoginSuccess, "3.3.3.3", "chrome", now))
+			gob.Assert(reasons(alerts)).Equal([]Reason{NewIP, NewUserAgent})
+		})
+
+		gob.It("should flag a login after long inactivity", func() {
+			alerts, _ := detector.Inspect("jiahao", login(queue.LoginSuccess, "1.1.1.1", "firefox", now.Add(60*24*time.Hour)))
+			gob.Assert(reasons(alerts)).Equal([]Reason{LongInactivity})
+		})
+	})
+
+	gob.Describe("Memory Store Test", func() {
+		store := NewMemoryStore()
+		a := New("jiahao", NewIP, login(queue.LoginSuccess, "3.3.3.3", "chrome", now))
+		b := New("jiahao", NewUserAgent, login(queue.LoginSuccess, "3.3.3.3", "chrome", now))
+
+		gob.It("should list pending alerts newest first", func() {
+			store.Notify(a)
+			store.Notify(b)
+			pending, _ := store.Pending("jiahao")
+			gob.Assert(len(pending)).Equal(2)
+			gob.Assert(pending[0].ID).Equal(b.ID)
+		})
+
+		gob.It("should confirm an alert", func() {
+			gob.Assert(store.Confirm("jiahao", a.ID)).IsNil()
+			pending, _ := store.Pending("jiahao")
+			gob.Assert(len(pending)).Equal(1)
+			gob.Assert(pending[0].ID).Equal(b.ID)
+
+			gob.Assert(store.Confirm("jiahao", "nope")).IsNotNil()
+			gob.Assert(store.Confirm("nobody", a.ID)).IsNotNil()
+		})
+	})
+
+	gob.Describe("Notifier Test", func() {
+		gob.It("should POST the alert to the webhook", func() {
+			received := make(chan Alert, 1)
+			server := httptest.NewServer(http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+				var a Alert
+				json.NewDecoder(req.Body).Decode(&a)
+				received <- a
+			}))
+			defer server.Close()
+
+			a := New("jiahao", NewIP, login(queue.LoginSuccess, "3.3.3.3", "chrome", now))
+			webhook := &WebhookNotifier{URL: server.URL}
+			gob.Assert(webhook.Notify(a)).IsNil()
+			gob.Assert((<-received).ID).Equal(a.ID)
+		})
+
+		gob.It("should carry on when a notifier fails", func() {
+			store := NewMemoryStore()
+			notifiers := Notifiers{failingNotifier{}, store}
+			gob.Assert(notifiers.Notify(New("jiahao", NewIP, queue.History{}))).IsNotNil()
+			pending, _ := store.Pending("jiahao")
+			gob.Assert(len(pending)).Equal(1)
+		})
+	})
+}
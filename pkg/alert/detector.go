@@ -0,0 +1,83 @@
+package alert
+
+import (
+	"time"
+
+	"github.com/teojiahao/HireMe/pkg/queue"
+)
+
+// how many past logins are compared against a new one
+const lookback = 50
+
+// Detector looks at a login against the earlier activity of the user
+type Detector struct {
+	Activities queue.ActivityStore
+	// MaxFailures failed logins within FailureWindow are flagged, 0 turns it off
+	MaxFailures   int
+	FailureWindow time.Duration
+	// Inactivity flags a login after this long without any activity, 0 turns it off
+	Inactivity time.Duration
+	// Exists tells if there is an account with the username, the logins typed for any other name
+	// are not looked at, every login is when it is nil
+	Exists func(username string) bool
+}
+
+// Inspect return the alerts raised by the login event, it has to be called before
+// the event is added to the activity store
+func (d *Detector) Inspect(username string, event queue.History) ([]Alert, error) {
+	alerts := []Alert{}
+	if d.Exists != nil && !d.Exists(username) {
+		return alerts, nil
+	}
+
+	switch event.Kind {
+	case queue.LoginFailure:
+		if d.MaxFailures <= 0 {
+			return alerts, nil
+		}
+		_, failures, err := d.Activities.Search(username, queue.Query{
+			Kinds: []queue.Kind{queue.LoginFailure},
+			From:  event.Time.Add(-d.FailureWindow),
+		}, 0, 1)
+		if err != nil {
+			return nil, err
+		}
+		// only once when the limit is reached, not on every failure after
+		if failures+1 == d.MaxFailures {
+			alerts = append(alerts, New(username, RepeatedFailures, event))
+		}
+
+	case queue.LoginSuccess:
+		if d.Inactivity > 0 {
+			last, _, err := d.Activities.Search(username, queue.Query{}, 0, 1)
+			if err != nil {
+				return nil, err
+			}
+			if len(last) > 0 && event.Time.Sub(last[0].Time) > d.Inactivity {
+				alerts = append(alerts, New(username, LongInactivity, event))
+			}
+		}
+
+		logins, _, err := d.Activities.Search(username, queue.Query{Kinds: []queue.Kind{queue.LoginSuccess}}, 0, lookback)
+		if err != nil {
+			return nil, err
+		}
+		// nothing to compare with on the first login
+		if len(logins) == 0 {
+			return alerts, nil
+		}
+
+		knownIP, knownAgent := false, false
+		for _, login := range logins {
+			knownIP = knownIP || login.IP == event.IP
+			knownAgent = knownAgent || login.UserAgent == event.UserAgent
+		}
+		if !knownIP {
+			alerts = append(alerts, New(username, NewIP, event))
+		}
+		if !knownAgent {
+			alerts = append(alerts, New(username, NewUserAgent, event))
+		}
+	}
+	return alerts, nil
+}
@@ -0,0 +1,89 @@
+package alert
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/smtp"
+	"strings"
+	"time"
+)
+
+// Notifier sends the alert somewhere
+type Notifier interface {
+	Notify(a Alert) error
+}
+
+// Notifiers sends the alert through every notifier, it carries on when one fails
+type Notifiers []Notifier
+
+// Notify sends the alert through every notifier and return all the errors joined
+func (n Notifiers) Notify(a Alert) error {
+	failed := []string{}
+	for _, notifier := range n {
+		if err := notifier.Notify(a); err != nil {
+			failed = append(failed, err.Error())
+		}
+	}
+	if len(failed) > 0 {
+		return fmt.Errorf("notify: %s", strings.Join(failed, "; "))
+	}
+	return nil
+}
+
+// EmailNotifier mails the alert to the user
+type EmailNotifier struct {
+	// Addr is the host:port of the SMTP server
+	Addr string
+	From string
+	Auth smtp.Auth
+	// Lookup return the email of the user, users without one are skipped
+	Lookup func(username string) string
+}
+
+// Notify mails the alert to the user
+func (e *EmailNotifier) Notify(a Alert) error {
+	to := e.Lookup(a.Username)
+	if to == "" {
+		return nil
+	}
+
+	var msg bytes.Buffer
+	fmt.Fprintf(&msg, "From: %s\r\n", e.From)
+	fmt.Fprintf(&msg, "To: %s\r\n", to)
+	fmt.Fprintf(&msg, "Subject: HireMe security alert: %s\r\n", a.Reason.Label())
+	fmt.Fprintf(&msg, "Content-Type: text/plain; charset=UTF-8\r\n\r\n")
+	msg.WriteString(strings.ReplaceAll(a.Message(), "\n", "\r\n"))
+
+	return smtp.SendMail(e.Addr, e.Auth, e.From, []string{to}, msg.Bytes())
+}
+
+// WebhookNotifier POST the alert as JSON to a URL
+type WebhookNotifier struct {
+	URL    string
+	Client *http.Client
+}
+
+// Notify POST the alert to the webhook
+func (w *WebhookNotifier) Notify(a Alert) error {
+	jsonValue, err := json.Marshal(a)
+	if err != nil {
+		return err
+	}
+
+	client := w.Client
+	if client == nil {
+		client = &http.Client{Timeout: 10 * time.Second}
+	}
+	response, err := client.Post(w.URL, "application/json", bytes.NewBuffer(jsonValue))
+	if err != nil {
+		return err
+	}
+	response.Body.Close()
+
+	if response.StatusCode >= 300 {
+		return fmt.Errorf("webhook returned %s", response.Status)
+	}
+	return nil
+}
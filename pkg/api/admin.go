@@ -0,0 +1,233 @@
+package api
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"log/slog"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/gorilla/mux"
+	"github.com/teojiahao/HireMe/pkg/audit"
+	"github.com/teojiahao/HireMe/pkg/database"
+)
+
+// ManagedUser is a user as the admins see it, the password and key are left out
+type ManagedUser struct {
+	Username       string
+	Display        string
+	JobType        string
+	Skill          string
+	Skills         string
+	Exp            int
+	UnemployedDate string
+	Message        string
+	Email          string
+	Disabled       bool
+	Hidden         bool
+	TwoFactor      bool
+	HasKey         bool
+}
+
+// ManagedUsers is a page of the users found by AdminUsers
+type ManagedUsers struct {
+	Page  int
+	Limit int
+	Total int
+	Users []ManagedUser
+}
+
+// AdminChange is the body of a PATCH by an admin, the fields left out are not changed
+type AdminChange struct {
+	Hidden   *bool
+	Disabled *bool
+}
+
+// Statuses the users can be searched by
+const (
+	StatusShown    = "shown"
+	StatusHidden   = "hidden"
+	StatusDisabled = "disabled"
+)
+
+func (a *API) managedUser(user database.User) (ManagedUser, error) {
+	enabled, err := a.twoFactor.Enabled(user.Username)
+	if err != nil {
+		return ManagedUser{}, err
+	}
+	picked, err := a.taxonomy.Picked(user.Username)
+	return ManagedUser{user.Username, user.Display, strings.Join(picked.JobTypes, ", "), strings.Join(picked.Categories, ", "),
+		strings.Join(picked.Skills, ", "), user.Exp, user.UnemployedDate, user.Message, user.Email, user.Disabled, user.Hidden,
+		enabled, len(user.AccessKey) > 0}, err
+}
+
+// check if the user fits the search, q is lower case
+func matchUser(user database.User, q, status string) bool {
+	switch status {
+	case StatusShown:
+		if user.Display != "Yes" || user.Hidden || user.Disabled {
+			return false
+		}
+	case StatusHidden:
+		if !user.Hidden {
+			return false
+		}
+	case StatusDisabled:
+		if !user.Disabled {
+			return false
+		}
+	}
+	if q == "" {
+		return true
+	}
+	for _, field := range []string{user.Username, user.Email, user.Message} {
+		if strings.Contains(strings.ToLower(field), q) {
+			return true
+		}
+	}
+	return false
+}
+
+// AdminUsers return a page of the users by username for the admins. It can be searched with q in
+// the username, email and message and with status, shown, hidden or disabled.
+func (a *API) AdminUsers(res http.ResponseWriter, req *http.Request) {
+	if _, ok := a.adminKey(req); !ok {
+		res.WriteHeader(http.StatusForbidden)
+		res.Write([]byte("403 - Admin only"))
+		return
+	}
+	v := req.URL.Query()
+
+	page, _ := strconv.Atoi(v.Get("page"))
+	if page < 1 {
+		page = 1
+	}
+	limit, _ := strconv.Atoi(v.Get("limit"))
+	if limit < 1 || limit > 100 {
+		limit = 20
+	}
+	q := strings.ToLower(strings.TrimSpace(v.Get("q")))
+
+	found := []database.User{}
+	for _, user := range a.db.GetAllUser(req.Context()) {
+		if matchUser(user, q, v.Get("status")) {
+			found = append(found, user)
+		}
+	}
+	sort.Slice(found, func(i, j int) bool { return found[i].Username < found[j].Username })
+
+	result := ManagedUsers{Page: page, Limit: limit, Total: len(found), Users: []ManagedUser{}}
+	for i := (page - 1) * limit; i < len(found) && i < page*limit; i++ {
+		user, err := a.managedUser(found[i])
+		if err != nil {
+			slog.ErrorContext(req.Context(), "reading user", "error", err)
+			res.WriteHeader(http.StatusInternalServerError)
+			res.Write([]byte("500 - Internal server error"))
+			return
+		}
+		result.Users = append(result.Users, user)
+	}
+
+	res.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(res).Encode(result)
+}
+
+// AdminUser return the user to an admin, a PATCH hides the profile or disables the account
+func (a *API) AdminUser(res http.ResponseWriter, req *http.Request) {
+	admin, ok := a.adminKey(req)
+	if !ok {
+		res.WriteHeader(http.StatusForbidden)
+		res.Write([]byte("403 - Admin only"))
+		return
+	}
+	params := mux.Vars(req)
+
+	user, err := a.db.GetUser(req.Context(), params["username"])
+	if err == database.ErrNoUser {
+		res.WriteHeader(http.StatusNotFound)
+		res.Write([]byte("404 - No user found!"))
+		return
+	}
+	if err != nil {
+		slog.ErrorContext(req.Context(), "reading user", "error", err)
+		res.WriteHeader(http.StatusInternalServerError)
+		res.Write([]byte("500 - Internal server error"))
+		return
+	}
+
+	if req.Method == "PATCH" {
+		var change AdminChange
+		reqBody, err := ioutil.ReadAll(req.Body)
+		if err != nil || json.Unmarshal(reqBody, &change) != nil {
+			res.WriteHeader(http.StatusUnprocessableEntity)
+			res.Write([]byte("422 - Please supply the change in JSON format"))
+			return
+		}
+
+		if change.Hidden != nil && *change.Hidden != user.Hidden {
+			if err := a.db.SetHidden(req.Context(), user.Username, *change.Hidden); err != nil {
+				slog.ErrorContext(req.Context(), "hiding profile", "error", err)
+				res.WriteHeader(http.StatusInternalServerError)
+				res.Write([]byte("500 - Internal server error"))
+				return
+			}
+			action := audit.ProfileShow
+			if *change.Hidden {
+				action = audit.ProfileHide
+			}
+			a.record(req, admin, action, user.Username, nil)
+			user.Hidden = *change.Hidden
+		}
+
+		if change.Disabled != nil && *change.Disabled != user.Disabled {
+			if err := a.db.SetDisabled(req.Context(), user.Username, *change.Disabled); err != nil {
+				slog.ErrorContext(req.Context(), "disabling user", "error", err)
+				res.WriteHeader(http.StatusInternalServerError)
+				res.Write([]byte("500 - Internal server error"))
+				return
+			}
+			action := audit.UserEnable
+			if *change.Disabled {
+				action = audit.UserDisable
+			}
+			a.record(req, admin, action, user.Username, []audit.Change{{Field: "Disabled",
+				Before: strconv.FormatBool(user.Disabled), After: strconv.FormatBool(*change.Disabled)}})
+			user.Disabled = *change.Disabled
+		}
+	}
+
+	managed, err := a.managedUser(user)
+	if err != nil {
+		slog.ErrorContext(req.Context(), "checking two-factor", "error", err)
+		res.WriteHeader(http.StatusInternalServerError)
+		res.Write([]byte("500 - Internal server error"))
+		return
+	}
+	res.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(res).Encode(managed)
+}
+
+// RevokeKey lets an admin log a user out everywhere, the pages stop taking the sessions
+// holding the old key and a new one is issued on the next login
+func (a *API) RevokeKey(res http.ResponseWriter, req *http.Request) {
+	admin, ok := a.adminKey(req)
+	if !ok {
+		res.WriteHeader(http.StatusForbidden)
+		res.Write([]byte("403 - Admin only"))
+		return
+	}
+
+	params := mux.Vars(req)
+	if err := a.db.SetAccessKey(req.Context(), params["username"], nil); err != nil {
+		slog.ErrorContext(req.Context(), "revoking key", "error", err)
+		res.WriteHeader(http.StatusInternalServerError)
+		res.Write([]byte("500 - Internal server error"))
+		return
+	}
+	a.record(req, admin, audit.KeyRevoke, params["username"], nil)
+
+	res.WriteHeader(http.StatusOK)
+	res.Write([]byte("200 - Key revoked"))
+}
@@ -4,29 +4,213 @@ package api
 import (
 	"encoding/json"
 	"io/ioutil"
+	"log/slog"
+	"math"
 	"net/http"
+	"strconv"
+	"strings"
 
 	uuid "github.com/satori/go.uuid"
+	"github.com/teojiahao/HireMe/pkg/audit"
+	"github.com/teojiahao/HireMe/pkg/config"
+	"github.com/teojiahao/HireMe/pkg/content"
+	"github.com/teojiahao/HireMe/pkg/headers"
+	"github.com/teojiahao/HireMe/pkg/logging"
+	"github.com/teojiahao/HireMe/pkg/metrics"
+	"github.com/teojiahao/HireMe/pkg/queue"
+	"github.com/teojiahao/HireMe/pkg/report"
 	"github.com/teojiahao/HireMe/pkg/security"
+	"github.com/teojiahao/HireMe/pkg/taxonomy"
+	"github.com/teojiahao/HireMe/pkg/throttle"
+	"github.com/teojiahao/HireMe/pkg/totp"
 
 	"github.com/gorilla/mux"
 	"github.com/teojiahao/HireMe/pkg/database"
 )
 
+// Deps are what the api is built from, the stores left nil are kept in memory for a single instance
+type Deps struct {
+	// DB holds the users, it is required
+	DB *database.DB
+	// Keyring seals the access keys, it is required
+	Keyring *security.Keyring
+	// Passwords hashes and checks the passwords, the defaults are used with Keyring when nil
+	Passwords *security.Passwords
+	// Messages is the policy the profile messages are checked against, content.DefaultPolicy when nil
+	Messages *content.Policy
+	// Activities keeps the user activity history
+	Activities queue.ActivityStore
+	// Logins throttles failed logins, share its store between instances
+	Logins *throttle.Guard
+	// TwoFactor checks the second factor of users who turned it on, the pages should get the same one
+	TwoFactor *totp.Manager
+	// Audit records the sensitive actions, the pages should get the same one
+	Audit *audit.Log
+	// Reports files the reported profiles and tells the moderators
+	Reports *report.Queue
+	// Taxonomy keeps the job types, categories and skills and the picks of the users
+	Taxonomy taxonomy.Store
+}
+
+// API serves the users, the logins and the admin api
+type API struct {
+	db         *database.DB
+	keyring    *security.Keyring
+	passwords  *security.Passwords
+	messages   content.Policy
+	activities queue.ActivityStore
+	logins     *throttle.Guard
+	twoFactor  *totp.Manager
+	audit      *audit.Log
+	reports    *report.Queue
+	taxonomy   taxonomy.Store
+
+	// users allowed to use the admin api
+	admins []string
+	// reverse proxies trusted to add X-Forwarded-For
+	proxies headers.Proxies
+	// contact details are only given to users with two-factor authentication
+	twoFactorRequired bool
+}
+
+// New return an API built from the config and the deps
+func New(c config.Config, d Deps) *API {
+	a := &API{
+		db:                d.DB,
+		keyring:           d.Keyring,
+		passwords:         d.Passwords,
+		messages:          content.DefaultPolicy,
+		activities:        d.Activities,
+		logins:            d.Logins,
+		twoFactor:         d.TwoFactor,
+		audit:             d.Audit,
+		reports:           d.Reports,
+		taxonomy:          d.Taxonomy,
+		admins:            c.AdminUsers,
+		proxies:           c.Proxies(),
+		twoFactorRequired: c.TwoFactor.Required,
+	}
+	if a.passwords == nil {
+		a.passwords = &security.Passwords{Keyring: d.Keyring, Params: security.DefaultPasswordParams, Policy: security.DefaultPasswordPolicy}
+	}
+	if d.Messages != nil {
+		a.messages = *d.Messages
+	}
+	if a.activities == nil {
+		a.activities = queue.NewMemoryStore(c.Retention())
+	}
+	if a.logins == nil {
+		a.logins = throttle.NewGuard(throttle.NewMemoryStore())
+	}
+	if a.twoFactor == nil {
+		a.twoFactor = totp.NewManager(totp.NewMemoryStore(), c.TwoFactor.Issuer)
+	}
+	if a.audit == nil {
+		a.audit = audit.NewLog(audit.NewMemoryStore(), c.AuditKey())
+	}
+	if a.reports == nil {
+		a.reports = &report.Queue{Store: report.NewMemoryStore(), HideAfter: c.Report.HideAfter}
+	}
+	if a.taxonomy == nil {
+		a.taxonomy = taxonomy.NewMemoryStore(taxonomy.Default())
+	}
+	return a
+}
+
+// LoginRequest is the body of a login, Code is only needed when the user has two-factor authentication
+type LoginRequest struct {
+	database.User
+	Code string
+}
+
+// ProfileRequest is the body of a profile update, the picks are the exact names in the lists.
+// A client sending only JobType and Skill joined with ", " has them split by the lists.
+type ProfileRequest struct {
+	database.User
+	taxonomy.Selection
+}
+
+// return the ip of the client, the pages call the api from the same machine with the
+// ip they saw in X-Forwarded-For
+func (a *API) clientIP(req *http.Request) string {
+	return a.proxies.ClientIP(req)
+}
+
+// IsAdmin checks if the user is one of the ADMIN_USERS
+func (a *API) IsAdmin(username string) bool {
+	if username == "" {
+		return false
+	}
+	for _, admin := range a.admins {
+		if admin == username {
+			return true
+		}
+	}
+	return false
+}
+
+// check if the key belongs to one of the ADMIN_USERS
+func (a *API) adminKey(req *http.Request) (string, bool) {
+	username, ok := a.db.UserFromAPIKey(req.Context(), req.URL.Query().Get("accessKey"))
+	if !ok {
+		slog.WarnContext(req.Context(), "invalid access key")
+		return "", false
+	}
+	logging.SetUser(req.Context(), username)
+	if !a.IsAdmin(username) {
+		slog.WarnContext(req.Context(), "admin only")
+		return "", false
+	}
+	return username, true
+}
+
+// record the action in the audit log, the request goes on even if it cannot be recorded
+func (a *API) record(req *http.Request, actor string, action audit.Action, target string, changes []audit.Change) {
+	// a failed login can name any user, keep it to the size of the column
+	if runes := []rune(target); len(runes) > 64 {
+		target = string(runes[:64])
+	}
+	if err := a.audit.Record(actor, action, target, a.clientIP(req), changes); err != nil {
+		slog.ErrorContext(req.Context(), "recording audit entry", "action", action, "error", err)
+	}
+}
+
+// return the profile fields compared in the audit log, the password and key are left out
+func profileFields(user database.User) map[string]string {
+	return map[string]string{
+		"Display":        user.Display,
+		"CoordX":         strconv.FormatFloat(user.CoordX, 'f', -1, 64),
+		"CoordY":         strconv.FormatFloat(user.CoordY, 'f', -1, 64),
+		"JobType":        user.JobType,
+		"Skill":          user.Skill,
+		"Exp":            strconv.Itoa(user.Exp),
+		"UnemployedDate": user.UnemployedDate,
+		"Message":        user.Message,
+		"Email":          user.Email,
+	}
+}
+
+// NewAccessKey return a new access key and the key sealed with the keyring as it is kept in the database
+func NewAccessKey(keyring *security.Keyring) (string, []byte, error) {
+	key := uuid.NewV4().String()
+	sealed, err := keyring.Encrypt([]byte(key))
+	return key, sealed, err
+}
+
 // check if the user provide key and check if the key exsit inside db
-func validKey(req *http.Request) bool {
+func (a *API) validKey(req *http.Request) bool {
 	v := req.URL.Query()
 	if key, ok := v["accessKey"]; ok {
-		return database.CheckAPIKey(key[0])
+		return a.db.CheckAPIKey(req.Context(), key[0])
 	}
 	return false
 }
 
 // Login func
-func Login(res http.ResponseWriter, req *http.Request) {
+func (a *API) Login(res http.ResponseWriter, req *http.Request) {
 	if req.Header.Get("Content-type") == "application/json" {
 		if req.Method == "POST" {
-			var user database.User
+			var user LoginRequest
 			reqBody, err := ioutil.ReadAll(req.Body)
 			if err == nil {
 				json.Unmarshal(reqBody, &user)
@@ -38,24 +222,104 @@ func Login(res http.ResponseWriter, req *http.Request) {
 					return
 				}
 
+				logging.SetUser(req.Context(), user.Username)
+
+				// slow down and lock out repeated failures of the account or the ip
+				ip := a.clientIP(req)
+				wait, err := a.logins.Wait(user.Username, ip)
+				if err != nil {
+					slog.ErrorContext(req.Context(), "checking login throttle", "error", err)
+					res.WriteHeader(http.StatusInternalServerError)
+					res.Write([]byte("500 - Internal server error"))
+					return
+				}
+				if wait > 0 {
+					metrics.Logins.WithLabelValues("locked").Inc()
+					res.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+					res.WriteHeader(http.StatusTooManyRequests)
+					res.Write([]byte("429 - Too many failed logins, try again later"))
+					return
+				}
+
 				// Get all user from db
-				dbAllUser := database.GetAllUser()
+				dbAllUser := a.db.GetAllUser(req.Context())
 				// check if user exist in the db
 				dbUser, ok := dbAllUser[user.Username]
 				if !ok {
+					a.loginFailed(req, user.Username, ip)
 					res.WriteHeader(http.StatusForbidden)
 					res.Write([]byte("403 - Username and/or password do not match"))
 					return
 				}
 
 				// compare the password with the db password
-				err := security.HashPasswordCompare(user.Password, "", dbUser.Password)
+				outdated, err := a.passwords.Compare(user.Password, dbUser.Password)
 				if err != nil {
+					a.loginFailed(req, user.Username, ip)
 					res.WriteHeader(http.StatusForbidden)
 					res.Write([]byte("403 - Username and/or password do not match"))
 					return
 				}
 
+				// only told once the password is right, so it does not give away who has an account
+				if dbUser.Disabled {
+					slog.WarnContext(req.Context(), "login of disabled user")
+					res.WriteHeader(http.StatusForbidden)
+					res.Write([]byte("403 - Account disabled"))
+					return
+				}
+
+				// the password is right, ask for the second factor when the user has one
+				enabled, err := a.twoFactor.Enabled(user.Username)
+				if err != nil {
+					slog.ErrorContext(req.Context(), "checking two-factor", "error", err)
+					res.WriteHeader(http.StatusInternalServerError)
+					res.Write([]byte("500 - Internal server error"))
+					return
+				}
+				if enabled {
+					if user.Code == "" {
+						res.WriteHeader(http.StatusUnauthorized)
+						res.Write([]byte("401 - Two-factor code required"))
+						return
+					}
+					if err := a.twoFactor.Verify(user.Username, user.Code); err != nil {
+						if err != totp.ErrInvalidCode {
+							slog.ErrorContext(req.Context(), "verifying two-factor code", "error", err)
+						}
+						a.loginFailed(req, user.Username, ip)
+						res.WriteHeader(http.StatusForbidden)
+						res.Write([]byte("403 - Invalid two-factor code"))
+						return
+					}
+				}
+
+				// the password is known only now, so this is the time to move it to the current hash
+				if outdated {
+					a.rehash(req, user.Username, user.Password)
+				}
+
+				if err := a.logins.Succeeded(user.Username); err != nil {
+					slog.ErrorContext(req.Context(), "clearing failed logins", "error", err)
+				}
+				metrics.Logins.WithLabelValues("success").Inc()
+				a.record(req, user.Username, audit.LoginSuccess, user.Username, nil)
+
+				// a revoked key is replaced on the next login
+				if len(dbUser.AccessKey) == 0 {
+					_, dbUser.AccessKey, err = NewAccessKey(a.keyring)
+					if err == nil {
+						err = a.db.SetAccessKey(req.Context(), user.Username, dbUser.AccessKey)
+					}
+					if err != nil {
+						slog.ErrorContext(req.Context(), "issuing access key", "error", err)
+						res.WriteHeader(http.StatusInternalServerError)
+						res.Write([]byte("500 - Internal server error"))
+						return
+					}
+					a.record(req, user.Username, audit.KeyIssue, user.Username, nil)
+				}
+
 				// write something back to user
 				res.Write(dbUser.AccessKey)
 
@@ -67,24 +331,236 @@ func Login(res http.ResponseWriter, req *http.Request) {
 	}
 }
 
-// AllUsers return all the user in JSON
-func AllUsers(res http.ResponseWriter, req *http.Request) {
-	/*if !validKey(req) {
+// hash the password again with the current params, the login goes on even if it fails
+func (a *API) rehash(req *http.Request, username string, password []byte) {
+	hashPassword, err := a.passwords.Hash(string(password))
+	if err == nil {
+		err = a.db.UpdatePassword(req.Context(), username, hashPassword)
+	}
+	if err != nil {
+		slog.ErrorContext(req.Context(), "rehashing password", "error", err)
+	}
+}
+
+// record the failed login, the response stays the same even if it cannot be recorded
+func (a *API) loginFailed(req *http.Request, username, ip string) {
+	metrics.Logins.WithLabelValues("failure").Inc()
+	if err := a.logins.Failed(username, ip); err != nil {
+		slog.ErrorContext(req.Context(), "recording failed login", "error", err)
+	}
+	a.record(req, "", audit.LoginFailure, username, nil)
+}
+
+// Unlock lets an admin clear the failed logins of the user, and of the ip when given
+func (a *API) Unlock(res http.ResponseWriter, req *http.Request) {
+	admin, ok := a.adminKey(req)
+	if !ok {
+		res.WriteHeader(http.StatusForbidden)
+		res.Write([]byte("403 - Admin only"))
+		return
+	}
+
+	params := mux.Vars(req)
+	if err := a.logins.Accounts.Unlock(params["username"]); err != nil {
+		slog.ErrorContext(req.Context(), "unlocking account", "error", err)
+		res.WriteHeader(http.StatusInternalServerError)
+		res.Write([]byte("500 - Internal server error"))
+		return
+	}
+	if ip := req.URL.Query().Get("ip"); ip != "" {
+		if err := a.logins.IPs.Unlock(ip); err != nil {
+			slog.ErrorContext(req.Context(), "unlocking ip", "error", err)
+			res.WriteHeader(http.StatusInternalServerError)
+			res.Write([]byte("500 - Internal server error"))
+			return
+		}
+	}
+	var changes []audit.Change
+	if ip := req.URL.Query().Get("ip"); ip != "" {
+		changes = []audit.Change{{Field: "IP", Before: ip}}
+	}
+	a.record(req, admin, audit.LockoutClear, params["username"], changes)
+
+	res.WriteHeader(http.StatusOK)
+	res.Write([]byte("200 - Unlocked"))
+}
+
+// ResetTwoFactor lets an admin turn off the two-factor authentication of a user who lost the device
+func (a *API) ResetTwoFactor(res http.ResponseWriter, req *http.Request) {
+	admin, ok := a.adminKey(req)
+	if !ok {
+		res.WriteHeader(http.StatusForbidden)
+		res.Write([]byte("403 - Admin only"))
+		return
+	}
+
+	params := mux.Vars(req)
+	if err := a.twoFactor.Reset(params["username"]); err != nil {
+		slog.ErrorContext(req.Context(), "resetting two-factor", "error", err)
+		res.WriteHeader(http.StatusInternalServerError)
+		res.Write([]byte("500 - Internal server error"))
+		return
+	}
+	a.record(req, admin, audit.TwoFactorReset, params["username"], nil)
+
+	res.WriteHeader(http.StatusOK)
+	res.Write([]byte("200 - Two-factor authentication reset"))
+}
+
+// AuditLog lets an admin search the audit log, newest first.
+// It can be filtered with the actor, action, target, from and to query parameters.
+func (a *API) AuditLog(res http.ResponseWriter, req *http.Request) {
+	if _, ok := a.adminKey(req); !ok {
+		res.WriteHeader(http.StatusForbidden)
+		res.Write([]byte("403 - Admin only"))
+		return
+	}
+
+	v := req.URL.Query()
+	page, _ := strconv.Atoi(v.Get("page"))
+	if page < 1 {
+		page = 1
+	}
+	limit, _ := strconv.Atoi(v.Get("limit"))
+	if limit < 1 || limit > 100 {
+		limit = 20
+	}
+
+	entries, total, err := a.audit.Store.Search(audit.QueryFromValues(v), (page-1)*limit, limit)
+	if err != nil {
+		slog.ErrorContext(req.Context(), "searching audit log", "error", err)
+		res.WriteHeader(http.StatusInternalServerError)
+		res.Write([]byte("500 - Internal server error"))
+		return
+	}
+
+	res.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(res).Encode(struct {
+		Page    int
+		Limit   int
+		Total   int
+		Entries []audit.Entry
+	}{page, limit, total, entries})
+}
+
+// AuditExport lets an admin download the matching audit entries as JSON Lines, oldest first
+func (a *API) AuditExport(res http.ResponseWriter, req *http.Request) {
+	if _, ok := a.adminKey(req); !ok {
+		res.WriteHeader(http.StatusForbidden)
+		res.Write([]byte("403 - Admin only"))
+		return
+	}
+
+	res.Header().Set("Content-Type", "application/x-ndjson")
+	res.Header().Set("Content-Disposition", `attachment; filename="audit.jsonl"`)
+	if err := a.audit.Export(res, audit.QueryFromValues(req.URL.Query())); err != nil {
+		// the status is already sent, the cut short file is the only sign
+		slog.ErrorContext(req.Context(), "exporting audit log", "error", err)
+	}
+}
+
+// AuditVerify lets an admin check that no audit entry was changed or removed
+func (a *API) AuditVerify(res http.ResponseWriter, req *http.Request) {
+	if _, ok := a.adminKey(req); !ok {
+		res.WriteHeader(http.StatusForbidden)
+		res.Write([]byte("403 - Admin only"))
+		return
+	}
+
+	checked, bad, err := a.audit.Verify()
+	if err != nil && err != audit.ErrTampered {
+		slog.ErrorContext(req.Context(), "verifying audit log", "error", err)
+		res.WriteHeader(http.StatusInternalServerError)
+		res.Write([]byte("500 - Internal server error"))
+		return
+	}
+
+	res.Header().Set("Content-Type", "application/json")
+	if err == audit.ErrTampered {
+		res.WriteHeader(http.StatusConflict)
+	}
+	json.NewEncoder(res).Encode(struct {
+		Checked int64
+		Valid   bool
+		BadSeq  int64 `json:",omitempty"`
+	}{checked, err == nil, bad})
+}
+
+// AllUsers return all the user in JSON, the emails follow TWO_FACTOR_REQUIRED for the accessKey given
+func (a *API) AllUsers(res http.ResponseWriter, req *http.Request) {
+	/*if !a.validKey(req) {
 		res.WriteHeader(http.StatusNotFound)
 		res.Write([]byte("404 - invalid key!"))
 		return
 	}*/
 
-	json.NewEncoder(res).Encode(database.UserInfoJSON())
+	users := a.db.UserInfoJSON(req.Context())
+	picks, err := a.taxonomy.Picks()
+	if err != nil {
+		slog.ErrorContext(req.Context(), "reading job picks", "error", err)
+		res.WriteHeader(http.StatusInternalServerError)
+		res.Write([]byte("500 - Internal server error"))
+		return
+	}
+	for username, user := range users {
+		picked := picks[username]
+		user.JobTypes, user.Categories, user.Skills = picked.JobTypes, picked.Categories, picked.Skills
+		// the text follows the lists when an admin renames a name
+		user.JobType, user.Skill = strings.Join(picked.JobTypes, ", "), strings.Join(picked.Categories, ", ")
+		users[username] = user
+	}
+
+	// when two-factor is required the emails are only given to a key of a user who turned it on,
+	// anyone still sees their own
+	if a.twoFactorRequired {
+		viewer, _ := a.db.UserFromAPIKey(req.Context(), req.URL.Query().Get("accessKey"))
+		enabled := false
+		if viewer != "" {
+			if enabled, err = a.twoFactor.Enabled(viewer); err != nil {
+				slog.ErrorContext(req.Context(), "checking two-factor", "error", err)
+			}
+		}
+		if !enabled {
+			for username, user := range users {
+				if username != viewer {
+					user.Email = ""
+					users[username] = user
+				}
+			}
+		}
+	}
+
+	json.NewEncoder(res).Encode(users)
+}
+
+// JobTaxonomy return the job types, categories and skills a profile can pick from
+func (a *API) JobTaxonomy(res http.ResponseWriter, req *http.Request) {
+	t, err := a.taxonomy.Taxonomy()
+	if err != nil {
+		slog.ErrorContext(req.Context(), "reading taxonomy", "error", err)
+		res.WriteHeader(http.StatusInternalServerError)
+		res.Write([]byte("500 - Internal server error"))
+		return
+	}
+	res.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(res).Encode(t)
 }
 
 // User func
-func User(res http.ResponseWriter, req *http.Request) {
+func (a *API) User(res http.ResponseWriter, req *http.Request) {
 	params := mux.Vars(req)
 
 	if req.Method == "GET" {
+		// the pages send the key of the session to check it was not revoked
+		_, withKey := req.URL.Query()["accessKey"]
+		if withKey && !a.db.CheckUserAPIKey(req.Context(), params["username"], req.URL.Query().Get("accessKey")) {
+			res.WriteHeader(http.StatusNotFound)
+			res.Write([]byte("404 - No user found!"))
+			return
+		}
+
 		// Get all user from DB
-		users := database.GetAllUser()
+		users := a.db.GetAllUser(req.Context())
 
 		// Check if user exist
 		if _, ok := users[params["username"]]; ok {
@@ -111,12 +587,17 @@ func User(res http.ResponseWriter, req *http.Request) {
 				}
 
 				// Generate a accesskey
-				key := uuid.NewV4()
-				secretKey, _ := security.Encrypt([]byte(key.String()), "")
+				_, secretKey, err := NewAccessKey(a.keyring)
+				if err != nil {
+					slog.ErrorContext(req.Context(), "encrypting access key", "error", err)
+					res.WriteHeader(http.StatusInternalServerError)
+					res.Write([]byte("500 - Internal server error"))
+					return
+				}
 
 				// Attempt to Add user into DB
 				insertChan := make(chan error)
-				go database.InsertUser(string(params["username"]), newUser.Password, secretKey, insertChan)
+				go a.db.InsertUser(req.Context(), string(params["username"]), newUser.Password, secretKey, insertChan)
 				err = <-insertChan
 				if err != nil {
 					res.WriteHeader(http.StatusConflict)
@@ -124,6 +605,9 @@ func User(res http.ResponseWriter, req *http.Request) {
 					return
 				}
 
+				a.record(req, params["username"], audit.UserCreate, params["username"], nil)
+				a.record(req, params["username"], audit.KeyIssue, params["username"], nil)
+
 				// Give user a key
 				res.WriteHeader(http.StatusCreated)
 				res.Write(secretKey)
@@ -135,25 +619,98 @@ func User(res http.ResponseWriter, req *http.Request) {
 		}
 
 		if req.Method == "PATCH" {
-			if !validKey(req) {
+			actor, ok := a.db.UserFromAPIKey(req.Context(), req.URL.Query().Get("accessKey"))
+			if !ok {
+				slog.WarnContext(req.Context(), "invalid access key")
 				res.WriteHeader(http.StatusNotFound)
 				res.Write([]byte("404 - invalid key!"))
 				return
 			}
 
-			var newUser database.User
+			var newUser ProfileRequest
 			reqBody, err := ioutil.ReadAll(req.Body)
 			if err == nil {
 				json.Unmarshal(reqBody, &newUser)
 
 				// Only accept a proper JSON format
 				if newUser.Username == "" {
+					slog.WarnContext(req.Context(), "profile update without a username")
 					res.WriteHeader(http.StatusUnprocessableEntity)
 					res.Write([]byte("422 - Please supply user information in JSON format"))
 					return
 				}
+				logging.SetUser(req.Context(), actor)
+
+				// a key only changes the profile of its own user
+				if actor != newUser.Username || actor != params["username"] {
+					slog.WarnContext(req.Context(), "profile update of another user", "username", newUser.Username)
+					res.WriteHeader(http.StatusForbidden)
+					res.Write([]byte("403 - You can only update your own profile"))
+					return
+				}
+
+				// the message is published on the map so it has to follow the content policy
+				review := []content.Violation{}
+				if newUser.Display == "Yes" {
+					result := a.messages.Check(newUser.Message)
+					if rejected := result.Rejected(); len(rejected) > 0 {
+						res.WriteHeader(http.StatusUnprocessableEntity)
+						res.Write([]byte("422 - " + rejected[0].Message))
+						return
+					}
+					newUser.Message = result.Text
+					review = result.Review()
+				}
+
+				// the picks have to be in the lists, a profile taken off the map picks nothing
+				picked := taxonomy.Selection{}
+				if newUser.Display == "Yes" {
+					t, err := a.taxonomy.Taxonomy()
+					if err != nil {
+						slog.ErrorContext(req.Context(), "reading taxonomy", "error", err)
+						res.WriteHeader(http.StatusInternalServerError)
+						res.Write([]byte("500 - The job lists could not be read, please try again later"))
+						return
+					}
+					picked = newUser.Selection
+					if len(picked.JobTypes) == 0 && len(picked.Categories) == 0 {
+						picked.JobTypes = taxonomy.Split(newUser.JobType, t.JobTypes)
+						picked.Categories = taxonomy.Split(newUser.Skill, t.Categories)
+					}
+					if err := t.Check(picked); err != nil {
+						res.WriteHeader(http.StatusUnprocessableEntity)
+						res.Write([]byte("422 - Please pick from the lists, " + err.Error()))
+						return
+					}
+				}
+				newUser.JobType, newUser.Skill = strings.Join(picked.JobTypes, ", "), strings.Join(picked.Categories, ", ")
+				before := a.db.GetAllUser(req.Context())[newUser.Username]
+				// only moderators hide a profile, whatever the body says
+				newUser.Hidden = before.Hidden
+				pickedBefore, err := a.taxonomy.Picked(newUser.Username)
+				if err == nil {
+					err = a.taxonomy.Pick(newUser.Username, picked)
+				}
+				if err != nil {
+					slog.ErrorContext(req.Context(), "saving job picks", "error", err)
+					res.WriteHeader(http.StatusInternalServerError)
+					res.Write([]byte("500 - Your job picks could not be saved, please try again later"))
+					return
+				}
+
 				// connect to db and update it
-				database.UpdateUser(newUser.Username, newUser.Display, newUser.CoordX, newUser.CoordY, newUser.JobType, newUser.Skill, newUser.Exp, newUser.UnemployedDate, newUser.Message, newUser.Email)
+				a.db.UpdateUser(req.Context(), newUser.Username, newUser.Display, newUser.CoordX, newUser.CoordY, newUser.JobType, newUser.Skill, newUser.Exp, newUser.UnemployedDate, newUser.Message, newUser.Email)
+
+				changes := audit.Diff(profileFields(before), profileFields(newUser.User))
+				changes = append(changes, audit.Diff(map[string]string{"Skills": strings.Join(pickedBefore.Skills, ", ")},
+					map[string]string{"Skills": strings.Join(picked.Skills, ", ")})...)
+				if len(changes) > 0 {
+					a.record(req, actor, audit.ProfileUpdate, newUser.Username, changes)
+				}
+				slog.InfoContext(req.Context(), "profile updated", "username", newUser.Username, "changes", len(changes))
+				if len(review) > 0 {
+					a.flagMessage(req, newUser.User, review)
+				}
 			} else {
 				res.WriteHeader(http.StatusUnprocessableEntity)
 				res.Write([]byte("422 - Please supply user information in JSON format"))
@@ -161,3 +718,44 @@ func User(res http.ResponseWriter, req *http.Request) {
 		}
 	}
 }
+
+// Activity return a page of the user activity history in JSON, newest first.
+// It can be searched with the kind, q, from and to query parameters.
+func (a *API) Activity(res http.ResponseWriter, req *http.Request) {
+	params := mux.Vars(req)
+	v := req.URL.Query()
+
+	// history is private so the key has to belong to the user
+	if !a.db.CheckUserAPIKey(req.Context(), params["username"], v.Get("accessKey")) {
+		slog.WarnContext(req.Context(), "invalid access key", "username", params["username"])
+		res.WriteHeader(http.StatusNotFound)
+		res.Write([]byte("404 - invalid key!"))
+		return
+	}
+	logging.SetUser(req.Context(), params["username"])
+
+	page, _ := strconv.Atoi(v.Get("page"))
+	if page < 1 {
+		page = 1
+	}
+	limit, _ := strconv.Atoi(v.Get("limit"))
+	if limit < 1 || limit > 100 {
+		limit = 10
+	}
+
+	history, total, err := a.activities.Search(params["username"], queue.QueryFromValues(v), (page-1)*limit, limit)
+	if err != nil {
+		slog.ErrorContext(req.Context(), "searching activity", "error", err)
+		res.WriteHeader(http.StatusInternalServerError)
+		res.Write([]byte("500 - Internal server error"))
+		return
+	}
+
+	res.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(res).Encode(struct {
+		Page    int
+		Limit   int
+		Total   int
+		History []queue.History
+	}{page, limit, total, history})
+}
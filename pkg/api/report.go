@@ -0,0 +1,203 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/gorilla/mux"
+	"github.com/teojiahao/HireMe/pkg/audit"
+	"github.com/teojiahao/HireMe/pkg/content"
+	"github.com/teojiahao/HireMe/pkg/database"
+	"github.com/teojiahao/HireMe/pkg/logging"
+	"github.com/teojiahao/HireMe/pkg/report"
+)
+
+// MaxReportDetails is the longest the details of a report can be, the size of the column
+const MaxReportDetails = 500
+
+// ReportRequest is the body of a report on a profile
+type ReportRequest struct {
+	Reason  report.Reason
+	Details string
+}
+
+// FiledReport is a report as the reporter sees it, without the moderator who resolved it
+type FiledReport struct {
+	Target     string
+	Reason     report.Reason
+	Details    string
+	Time       time.Time
+	Outcome    report.Outcome
+	ResolvedAt time.Time
+}
+
+// Report files a report on the profile by the user holding the accessKey. The profile is taken
+// off the map once HideAfter users reported it and the moderators are told.
+func (a *API) Report(res http.ResponseWriter, req *http.Request) {
+	params := mux.Vars(req)
+
+	reporter, ok := a.db.UserFromAPIKey(req.Context(), req.URL.Query().Get("accessKey"))
+	if !ok {
+		slog.WarnContext(req.Context(), "invalid access key")
+		res.WriteHeader(http.StatusNotFound)
+		res.Write([]byte("404 - invalid key!"))
+		return
+	}
+	logging.SetUser(req.Context(), reporter)
+
+	if reporter == params["username"] {
+		res.WriteHeader(http.StatusUnprocessableEntity)
+		res.Write([]byte("422 - You cannot report your own profile"))
+		return
+	}
+	user, err := a.db.GetUser(req.Context(), params["username"])
+	if err == database.ErrNoUser {
+		res.WriteHeader(http.StatusNotFound)
+		res.Write([]byte("404 - No user found!"))
+		return
+	}
+	if err != nil {
+		slog.ErrorContext(req.Context(), "reading user", "error", err)
+		res.WriteHeader(http.StatusInternalServerError)
+		res.Write([]byte("500 - Internal server error"))
+		return
+	}
+
+	var r ReportRequest
+	reqBody, err := ioutil.ReadAll(req.Body)
+	if err != nil || json.Unmarshal(reqBody, &r) != nil {
+		res.WriteHeader(http.StatusUnprocessableEntity)
+		res.Write([]byte("422 - Please supply the report in JSON format"))
+		return
+	}
+	if !r.Reason.Valid() {
+		res.WriteHeader(http.StatusUnprocessableEntity)
+		res.Write([]byte("422 - Please supply a valid reason"))
+		return
+	}
+	r.Details = strings.TrimSpace(r.Details)
+	if utf8.RuneCountInString(r.Details) > MaxReportDetails {
+		res.WriteHeader(http.StatusUnprocessableEntity)
+		res.Write([]byte("422 - Details can be at most " + strconv.Itoa(MaxReportDetails) + " characters"))
+		return
+	}
+
+	notice, err := a.reports.File(report.New(user.Username, reporter, r.Reason, r.Details, time.Now()), user.Hidden)
+	if err == report.ErrAlreadyReported {
+		res.WriteHeader(http.StatusConflict)
+		res.Write([]byte("409 - You already reported this profile"))
+		return
+	}
+	if err != nil {
+		slog.ErrorContext(req.Context(), "filing report", "error", err)
+		res.WriteHeader(http.StatusInternalServerError)
+		res.Write([]byte("500 - Internal server error"))
+		return
+	}
+
+	a.act(req, user, notice)
+
+	res.WriteHeader(http.StatusCreated)
+	res.Write([]byte("201 - Report filed"))
+}
+
+// PolicyReporter is who files the messages the content policy sends to review, its reports are
+// report.Flagged so they do not count towards HideAfter
+const PolicyReporter = "policy:content"
+
+// act on the case a report was filed in, hiding the profile when enough users reported it and
+// telling the moderators when the case opens or the profile is hidden
+func (a *API) act(req *http.Request, user database.User, notice report.Notice) {
+	if notice.Hide && !user.Hidden {
+		if err := a.db.SetHidden(req.Context(), user.Username, true); err != nil {
+			slog.ErrorContext(req.Context(), "hiding profile", "error", err)
+		} else {
+			// hidden by the reports, not by anyone in particular
+			a.record(req, "", audit.ProfileHide, user.Username, []audit.Change{{Field: "Reporters",
+				After: strconv.Itoa(notice.Case.Reporters())}})
+		}
+	}
+	if notice.Send() && a.reports.Notifier != nil {
+		// sending mail can be slow so do not hold up the user
+		ctx := context.WithoutCancel(req.Context())
+		go func() {
+			if err := a.reports.Notifier.Notify(notice); err != nil {
+				slog.ErrorContext(ctx, "notifying moderators", "target", user.Username, "error", err)
+			}
+		}()
+	}
+}
+
+// flagMessage files the message for the moderators when rules of the content policy want it
+// reviewed, a message already waiting for review is not filed again
+func (a *API) flagMessage(req *http.Request, user database.User, review []content.Violation) {
+	rules := []string{}
+	for _, v := range review {
+		rules = append(rules, v.Rule)
+	}
+	details := "Matched " + strings.Join(rules, ", ") + ": " + user.Message
+	if runes := []rune(details); len(runes) > MaxReportDetails {
+		details = string(runes[:MaxReportDetails])
+	}
+
+	notice, err := a.reports.File(report.New(user.Username, PolicyReporter, report.Flagged, details, time.Now()), user.Hidden)
+	if err == report.ErrAlreadyReported {
+		return
+	}
+	if err != nil {
+		slog.ErrorContext(req.Context(), "flagging message", "error", err)
+		return
+	}
+	a.act(req, user, notice)
+}
+
+// MyReports return a page of the reports filed by the user holding the accessKey with what
+// became of them, newest first
+func (a *API) MyReports(res http.ResponseWriter, req *http.Request) {
+	v := req.URL.Query()
+
+	reporter, ok := a.db.UserFromAPIKey(req.Context(), v.Get("accessKey"))
+	if !ok {
+		slog.WarnContext(req.Context(), "invalid access key")
+		res.WriteHeader(http.StatusNotFound)
+		res.Write([]byte("404 - invalid key!"))
+		return
+	}
+	logging.SetUser(req.Context(), reporter)
+
+	page, _ := strconv.Atoi(v.Get("page"))
+	if page < 1 {
+		page = 1
+	}
+	limit, _ := strconv.Atoi(v.Get("limit"))
+	if limit < 1 || limit > 100 {
+		limit = 10
+	}
+
+	reports, total, err := a.reports.Store.ByReporter(reporter, (page-1)*limit, limit)
+	if err != nil {
+		slog.ErrorContext(req.Context(), "reading reports", "error", err)
+		res.WriteHeader(http.StatusInternalServerError)
+		res.Write([]byte("500 - Internal server error"))
+		return
+	}
+	filed := []FiledReport{}
+	for _, r := range reports {
+		filed = append(filed, FiledReport{r.Target, r.Reason, r.Details, r.Time, r.Outcome, r.ResolvedAt})
+	}
+
+	res.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(res).Encode(struct {
+		Page    int
+		Limit   int
+		Total   int
+		Reports []FiledReport
+	}{page, limit, total, filed})
+}
@@ -0,0 +1,338 @@
+// Package audit keeps an append only, hash chained log of the administrative and sensitive actions
+package audit
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Action is what was done
+type Action string
+
+// All the actions recorded
+const (
+	LoginSuccess     Action = "login.success"
+	LoginFailure     Action = "login.failure"
+	UserCreate       Action = "user.create"
+	KeyIssue         Action = "key.issue"
+	KeyRevoke        Action = "key.revoke"
+	ProfileUpdate    Action = "profile.update"
+	ProfileHide      Action = "profile.hide"
+	ProfileShow      Action = "profile.show"
+	TwoFactorEnable  Action = "two_factor.enable"
+	TwoFactorDisable Action = "two_factor.disable"
+	TwoFactorRecover Action = "two_factor.recovery_codes"
+	TwoFactorReset   Action = "two_factor.reset"
+	LockoutClear     Action = "lockout.clear"
+	UserDisable      Action = "user.disable"
+	UserEnable       Action = "user.enable"
+	UserDelete       Action = "user.delete"
+	PasswordReset    Action = "password.reset"
+	ReportResolve    Action = "report.resolve"
+	TaxonomyAdd      Action = "taxonomy.add"
+	TaxonomyRename   Action = "taxonomy.rename"
+	TaxonomyRemove   Action = "taxonomy.remove"
+)
+
+// Actions list every Action in the order shown to the admin
+var Actions = []Action{LoginSuccess, LoginFailure, UserCreate, KeyIssue, KeyRevoke, ProfileUpdate,
+	ProfileHide, ProfileShow, TwoFactorEnable, TwoFactorDisable, TwoFactorRecover, TwoFactorReset,
+	LockoutClear, UserDisable, UserEnable, UserDelete, PasswordReset, ReportResolve, TaxonomyAdd,
+	TaxonomyRename, TaxonomyRemove}
+
+var (
+	// ErrConflict is returned by Store.Insert when the sequence number is taken, the entry is chained again
+	ErrConflict = errors.New("audit entry already exists")
+	// ErrTampered is returned by Verify when an entry does not match its hash or the one before
+	ErrTampered = errors.New("audit log has been tampered with")
+)
+
+// Change is a field that changed, secrets are never recorded
+type Change struct {
+	Field  string
+	Before string
+	After  string
+}
+
+// Diff return the fields that differ between before and after, sorted by field
+func Diff(before, after map[string]string) []Change {
+	fields := map[string]bool{}
+	for k := range before {
+		fields[k] = true
+	}
+	for k := range after {
+		fields[k] = true
+	}
+
+	changes := []Change{}
+	for field := range fields {
+		if before[field] != after[field] {
+			changes = append(changes, Change{field, before[field], after[field]})
+		}
+	}
+	sort.Slice(changes, func(i, j int) bool { return changes[i].Field < changes[j].Field })
+	return changes
+}
+
+// Entry is one action in the log
+type Entry struct {
+	// Seq numbers the entries from 1 without gaps
+	Seq  int64
+	Time time.Time
+	// Actor is the user who did it, empty when nobody is logged in
+	Actor  string
+	Action Action
+	// Target is the user it was done to
+	Target  string
+	Changes []Change
+	IP      string
+	// PrevHash is the Hash of the entry before, empty for the first one
+	PrevHash string
+	Hash     string
+}
+
+// ComputeHash return the HMAC-SHA256 under key of every field but Hash, so changing any of
+// them or the entry before breaks the chain, and without the key it cannot be mended
+func (e Entry) ComputeHash(key []byte) string {
+	e.Hash = ""
+	e.Time = e.Time.UTC()
+	if e.Changes == nil {
+		e.Changes = []Change{}
+	}
+	// json.Marshal writes struct fields in order so the bytes are always the same
+	data, _ := json.Marshal(e)
+	mac := hmac.New(sha256.New, key)
+	mac.Write(data)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// Query narrows down the entries returned by Search, the zero value matches everything
+type Query struct {
+	Actor   string
+	Actions []Action
+	Target  string
+	// From and To keep only entries within the time range, either can be left zero
+	From time.Time
+	To   time.Time
+}
+
+// Match checks if the entry fits the query
+func (q Query) Match(e Entry) bool {
+	if q.Actor != "" && e.Actor != q.Actor {
+		return false
+	}
+	if q.Target != "" && e.Target != q.Target {
+		return false
+	}
+	if len(q.Actions) > 0 {
+		found := false
+		for _, a := range q.Actions {
+			if e.Action == a {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	if !q.From.IsZero() && e.Time.Before(q.From) {
+		return false
+	}
+	if !q.To.IsZero() && e.Time.After(q.To) {
+		return false
+	}
+	return true
+}
+
+// QueryFromValues builds a Query from the actor, action, target, from and to form values,
+// from and to are dates in the 2006-01-02 format and to includes the whole day
+func QueryFromValues(v url.Values) Query {
+	q := Query{
+		Actor:  strings.TrimSpace(v.Get("actor")),
+		Target: strings.TrimSpace(v.Get("target")),
+	}
+	for _, a := range v["action"] {
+		if a != "" {
+			q.Actions = append(q.Actions, Action(a))
+		}
+	}
+	if from, err := time.ParseInLocation("2006-01-02", v.Get("from"), time.Local); err == nil {
+		q.From = from
+	}
+	if to, err := time.ParseInLocation("2006-01-02", v.Get("to"), time.Local); err == nil {
+		q.To = to.Add(24*time.Hour - time.Nanosecond)
+	}
+	return q
+}
+
+// Store keeps the entries, it has no way to change or remove one
+type Store interface {
+	// Last return the entry with the highest Seq, the zero Entry when there is none
+	Last() (Entry, error)
+	// Insert adds the entry, ErrConflict when its Seq is already taken
+	Insert(e Entry) error
+	// Search return the newest matching entries first, skipping offset of them, and the total number of matches
+	Search(q Query, offset, limit int) ([]Entry, int, error)
+	// Walk calls fn with every entry from the oldest, it stops at the first error
+	Walk(fn func(e Entry) error) error
+}
+
+// Log chains the entries into the store
+type Log struct {
+	Store Store
+	// Key keys the hashes of the chain, it is kept out of the store so whoever can write to
+	// the store still cannot add or change an entry that verifies
+	Key []byte
+	// Now return the current time, time.Now when nil
+	Now func() time.Time
+}
+
+// NewLog return a Log writing to the store with the hashes keyed by key
+func NewLog(store Store, key []byte) *Log {
+	return &Log{Store: store, Key: key}
+}
+
+// Record appends an entry linked to the last one, if another instance appended
+// at the same time it is linked again to the new last entry
+func (l *Log) Record(actor string, action Action, target, ip string, changes []Change) error {
+	now := time.Now()
+	if l.Now != nil {
+		now = l.Now()
+	}
+
+	for attempt := 0; attempt < 10; attempt++ {
+		last, err := l.Store.Last()
+		if err != nil {
+			return err
+		}
+		e := Entry{
+			Seq:      last.Seq + 1,
+			Time:     now.UTC().Truncate(time.Millisecond),
+			Actor:    actor,
+			Action:   action,
+			Target:   target,
+			Changes:  changes,
+			IP:       ip,
+			PrevHash: last.Hash,
+		}
+		e.Hash = e.ComputeHash(l.Key)
+
+		err = l.Store.Insert(e)
+		if err != ErrConflict {
+			return err
+		}
+	}
+	return ErrConflict
+}
+
+// Verify walks the whole log and checks every entry against its hash and the one before,
+// it return the number of entries checked and the Seq of the first bad one
+func (l *Log) Verify() (checked int64, bad int64, err error) {
+	prev := Entry{}
+	err = l.Store.Walk(func(e Entry) error {
+		if e.Seq != prev.Seq+1 || e.PrevHash != prev.Hash || e.Hash != e.ComputeHash(l.Key) {
+			bad = e.Seq
+			return ErrTampered
+		}
+		checked++
+		prev = e
+		return nil
+	})
+	return checked, bad, err
+}
+
+// Export writes every entry matching the query from the oldest as JSON Lines
+func (l *Log) Export(w io.Writer, q Query) error {
+	encoder := json.NewEncoder(w)
+	return l.Store.Walk(func(e Entry) error {
+		if !q.Match(e) {
+			return nil
+		}
+		return encoder.Encode(e)
+	})
+}
+
+// MemoryStore keeps the entries in memory and is lost on restart
+type MemoryStore struct {
+	mutex   sync.RWMutex
+	entries []Entry
+}
+
+// NewMemoryStore return an empty MemoryStore
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{}
+}
+
+// Last return the newest entry
+func (m *MemoryStore) Last() (Entry, error) {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+	if len(m.entries) == 0 {
+		return Entry{}, nil
+	}
+	return m.entries[len(m.entries)-1], nil
+}
+
+// Insert appends the entry if it comes right after the newest one
+func (m *MemoryStore) Insert(e Entry) error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	if e.Seq != int64(len(m.entries))+1 {
+		if e.Seq <= int64(len(m.entries)) {
+			return ErrConflict
+		}
+		return fmt.Errorf("audit entry %d would leave a gap after %d", e.Seq, len(m.entries))
+	}
+	m.entries = append(m.entries, e)
+	return nil
+}
+
+// Search return a page of the matching entries, newest first
+func (m *MemoryStore) Search(q Query, offset, limit int) ([]Entry, int, error) {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+
+	matches := []Entry{}
+	for i := len(m.entries) - 1; i >= 0; i-- {
+		if q.Match(m.entries[i]) {
+			matches = append(matches, m.entries[i])
+		}
+	}
+	total := len(matches)
+	if offset < 0 {
+		offset = 0
+	}
+	if offset >= total {
+		return []Entry{}, total, nil
+	}
+	end := total
+	if limit > 0 && offset+limit < end {
+		end = offset + limit
+	}
+	return matches[offset:end], total, nil
+}
+
+// Walk calls fn with every entry from the oldest
+func (m *MemoryStore) Walk(fn func(e Entry) error) error {
+	m.mutex.RLock()
+	entries := append([]Entry{}, m.entries...)
+	m.mutex.RUnlock()
+
+	for _, e := range entries {
+		if err := fn(e); err != nil {
+			return err
+		}
+	}
+	return nil
+}
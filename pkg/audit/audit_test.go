@@ -0,0 +1,98 @@
+package audit
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"net/url"
+	"testing"
+	"time"
+
+	. "github.com/franela/goblin"
+)
+
+func TestAudit(t *testing.T) {
+	gob := Goblin(t)
+	now := time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	gob.Describe("Diff Test", func() {
+		gob.It("should only keep the fields that changed", func() {
+			changes := Diff(map[string]string{"Email": "a@a.com", "Exp": "1", "Skill": "Legal"},
+				map[string]string{"Email": "b@b.com", "Exp": "1", "Message": "hi"})
+			gob.Assert(changes).Equal([]Change{
+				{"Email", "a@a.com", "b@b.com"},
+				{"Message", "", "hi"},
+				{"Skill", "Legal", ""},
+			})
+		})
+	})
+
+	gob.Describe("Log Test", func() {
+		store := NewMemoryStore()
+		key := []byte("0123456789abcdef0123456789abcdef")
+		l := NewLog(store, key)
+		l.Now = func() time.Time { return now }
+
+		gob.It("should chain the entries", func() {
+			gob.Assert(l.Record("jiahao", LoginSuccess, "jiahao", "1.1.1.1", nil)).IsNil()
+			now = now.Add(time.Hour)
+			gob.Assert(l.Record("admin", TwoFactorReset, "jiahao", "2.2.2.2", nil)).IsNil()
+			gob.Assert(l.Record("jiahao", ProfileUpdate, "jiahao", "1.1.1.1", []Change{{"Email", "a@a.com", "b@b.com"}})).IsNil()
+
+			entries, total, _ := store.Search(Query{}, 0, 10)
+			gob.Assert(total).Equal(3)
+			gob.Assert(entries[0].Seq).Equal(int64(3))
+			gob.Assert(entries[0].PrevHash).Equal(entries[1].Hash)
+			gob.Assert(entries[2].PrevHash).Equal("")
+
+			checked, _, err := l.Verify()
+			gob.Assert(err).IsNil()
+			gob.Assert(checked).Equal(int64(3))
+		})
+
+		gob.It("should filter the entries", func() {
+			_, total, _ := store.Search(Query{Actor: "jiahao"}, 0, 10)
+			gob.Assert(total).Equal(2)
+			_, total, _ = store.Search(Query{Actions: []Action{TwoFactorReset}, Target: "jiahao"}, 0, 10)
+			gob.Assert(total).Equal(1)
+			_, total, _ = store.Search(QueryFromValues(url.Values{"to": {"2020-12-31"}}), 0, 10)
+			gob.Assert(total).Equal(0)
+		})
+
+		gob.It("should export json lines from the oldest", func() {
+			var b bytes.Buffer
+			gob.Assert(l.Export(&b, Query{})).IsNil()
+			scanner := bufio.NewScanner(&b)
+			seq := int64(0)
+			for scanner.Scan() {
+				var e Entry
+				gob.Assert(json.Unmarshal(scanner.Bytes(), &e)).IsNil()
+				gob.Assert(e.Hash).Equal(e.ComputeHash(key))
+				seq++
+				gob.Assert(e.Seq).Equal(seq)
+			}
+			gob.Assert(seq).Equal(int64(3))
+		})
+
+		gob.It("should find a changed entry", func() {
+			store.entries[1].Target = "someone"
+			_, bad, err := l.Verify()
+			gob.Assert(err).Equal(ErrTampered)
+			gob.Assert(bad).Equal(int64(2))
+
+			// its hash cannot be mended without the key
+			store.entries[1].Hash = store.entries[1].ComputeHash(nil)
+			_, bad, _ = l.Verify()
+			gob.Assert(bad).Equal(int64(2))
+
+			// fixing its hash breaks the link of the next one
+			store.entries[1].Hash = store.entries[1].ComputeHash(key)
+			_, bad, _ = l.Verify()
+			gob.Assert(bad).Equal(int64(3))
+		})
+
+		gob.It("should refuse a sequence number already taken", func() {
+			gob.Assert(store.Insert(Entry{Seq: 2})).Equal(ErrConflict)
+		})
+	})
+}
@@ -0,0 +1,682 @@
+// Package config loads the settings of the server once, from defaults, a YAML or TOML file,
+// the .env file and the environment, and checks them before anything starts
+package config
+
+import (
+	"bytes"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/BurntSushi/toml"
+	"github.com/joho/godotenv"
+	"github.com/teojiahao/HireMe/pkg/content"
+	"github.com/teojiahao/HireMe/pkg/headers"
+	"github.com/teojiahao/HireMe/pkg/logging"
+	"github.com/teojiahao/HireMe/pkg/queue"
+	"github.com/teojiahao/HireMe/pkg/security"
+	"github.com/teojiahao/HireMe/pkg/tracing"
+	"gopkg.in/yaml.v3"
+)
+
+// Config is every setting of the server, each field can be set in the YAML or TOML file by its yaml
+// name or in the environment by its env name
+type Config struct {
+	Port string `yaml:"port" env:"PORT"`
+	// HTTPRedirectPort also listens on plain http to redirect to https when set
+	HTTPRedirectPort string `yaml:"http_redirect_port" env:"HTTP_REDIRECT_PORT"`
+	CertFile         string `yaml:"cert_file" env:"TLS_CERT_FILE"`
+	KeyFile          string `yaml:"key_file" env:"TLS_KEY_FILE"`
+	TemplateDir      string `yaml:"template_dir" env:"TEMPLATE_DIR"`
+	// API and LoginAPI are where the pages reach the api, usually this same server
+	API      string `yaml:"api" env:"API"`
+	LoginAPI string `yaml:"login_api" env:"LOGIN_API"`
+	// AdminUsers can use the admin api and pages
+	AdminUsers []string `yaml:"admin_users" env:"ADMIN_USERS"`
+	// TrustedProxies are the reverse proxies in front of the server, addresses or CIDR ranges,
+	// only the X-Forwarded-For entries they add are used as the ip of the client
+	TrustedProxies []string `yaml:"trusted_proxies" env:"TRUSTED_PROXIES"`
+
+	Server     Server     `yaml:"server"`
+	Google     Google     `yaml:"google"`
+	Database   Database   `yaml:"database"`
+	Encryption Encryption `yaml:"encryption"`
+	Audit      Audit      `yaml:"audit"`
+	Password   Password   `yaml:"password"`
+	// DisposableEmailFile lists the email domains to reject, one per line
+	DisposableEmailFile string    `yaml:"disposable_email_file" env:"DISPOSABLE_EMAIL_FILE"`
+	Content             Content   `yaml:"content"`
+	Activity            Activity  `yaml:"activity"`
+	Alert               Alert     `yaml:"alert"`
+	Report              Report    `yaml:"report"`
+	SMTP                SMTP      `yaml:"smtp"`
+	TwoFactor           TwoFactor `yaml:"two_factor"`
+	Headers             Headers   `yaml:"headers"`
+	Metrics             Metrics   `yaml:"metrics"`
+	Log                 Log       `yaml:"log"`
+	Tracing             Tracing   `yaml:"tracing"`
+}
+
+// Google is the Google Maps settings
+type Google struct {
+	APIKey string `yaml:"api_key" env:"GOOGLE_API"`
+	MapID  string `yaml:"map_id" env:"GOOGLE_MAP_ID"`
+}
+
+// Database is the MySQL settings
+type Database struct {
+	// DSN is the go-sql-driver data source name, user:password@tcp(host:port)/db
+	DSN string `yaml:"dsn" env:"DATABASE_IP"`
+	// MaxOpenConns and MaxIdleConns size the pool shared by every request, 0 is no limit
+	MaxOpenConns           int `yaml:"max_open_conns" env:"DATABASE_MAX_OPEN_CONNS"`
+	MaxIdleConns           int `yaml:"max_idle_conns" env:"DATABASE_MAX_IDLE_CONNS"`
+	ConnMaxLifetimeMinutes int `yaml:"conn_max_lifetime_minutes" env:"DATABASE_CONN_MAX_LIFETIME_MINUTES"`
+}
+
+// Server is how long the http server waits on clients, in seconds
+type Server struct {
+	ReadHeaderTimeout int `yaml:"read_header_timeout_seconds" env:"HTTP_READ_HEADER_TIMEOUT_SECONDS"`
+	ReadTimeout       int `yaml:"read_timeout_seconds" env:"HTTP_READ_TIMEOUT_SECONDS"`
+	WriteTimeout      int `yaml:"write_timeout_seconds" env:"HTTP_WRITE_TIMEOUT_SECONDS"`
+	IdleTimeout       int `yaml:"idle_timeout_seconds" env:"HTTP_IDLE_TIMEOUT_SECONDS"`
+	// ShutdownTimeout is how long in flight requests get to finish on SIGTERM
+	ShutdownTimeout int `yaml:"shutdown_timeout_seconds" env:"HTTP_SHUTDOWN_TIMEOUT_SECONDS"`
+	// DrainDelay is how long /readyz fails before the connections stop, so load balancers see it first
+	DrainDelay int `yaml:"drain_delay_seconds" env:"HTTP_DRAIN_DELAY_SECONDS"`
+}
+
+// Encryption is where the keyring comes from, Keys wins over KeyFile
+type Encryption struct {
+	Keys      string `yaml:"keys" env:"ENCRYPTION_KEYS"`
+	KeyFile   string `yaml:"key_file" env:"ENCRYPTION_KEY_FILE"`
+	LegacyKey string `yaml:"legacy_key" env:"ENCRYPTION_LEGACY_KEY"`
+}
+
+// Audit keys the hash chain of the audit log
+type Audit struct {
+	// HMACKey is base64 of at least 32 bytes, kept apart from the database
+	HMACKey string `yaml:"hmac_key" env:"AUDIT_HMAC_KEY"`
+}
+
+// minimum length of the audit key once decoded
+const minAuditKey = 32
+
+// Password is how passwords are hashed and which ones are accepted
+type Password struct {
+	Algorithm     string  `yaml:"algorithm" env:"PASSWORD_ALGORITHM"`
+	Argon2Memory  uint32  `yaml:"argon2_memory_kib" env:"ARGON2_MEMORY_KIB"`
+	Argon2Time    uint32  `yaml:"argon2_time" env:"ARGON2_TIME"`
+	Argon2Threads uint8   `yaml:"argon2_threads" env:"ARGON2_THREADS"`
+	BcryptCost    int     `yaml:"bcrypt_cost" env:"BCRYPT_COST"`
+	MinLength     int     `yaml:"min_length" env:"PASSWORD_MIN_LENGTH"`
+	MaxLength     int     `yaml:"max_length" env:"PASSWORD_MAX_LENGTH"`
+	RequireDigit  bool    `yaml:"require_digit" env:"PASSWORD_REQUIRE_DIGIT"`
+	RequireLower  bool    `yaml:"require_lower" env:"PASSWORD_REQUIRE_LOWER"`
+	RequireUpper  bool    `yaml:"require_upper" env:"PASSWORD_REQUIRE_UPPER"`
+	RequireSymbol bool    `yaml:"require_symbol" env:"PASSWORD_REQUIRE_SYMBOL"`
+	AllowUnicode  bool    `yaml:"allow_unicode" env:"PASSWORD_ALLOW_UNICODE"`
+	MinEntropy    float64 `yaml:"min_entropy" env:"PASSWORD_MIN_ENTROPY"`
+	// BreachedFile is a sorted SHA-1 hash file of passwords to refuse
+	BreachedFile string `yaml:"breached_file" env:"BREACHED_PASSWORDS_FILE"`
+}
+
+// Content is what the profile message may hold, lengths are counted in characters
+type Content struct {
+	MinLength int `yaml:"message_min_length" env:"MESSAGE_MIN_LENGTH"`
+	MaxLength int `yaml:"message_max_length" env:"MESSAGE_MAX_LENGTH"`
+	// RulesFile is a YAML file of the rules, links are refused and phone numbers masked when empty
+	RulesFile string `yaml:"rules_file" env:"CONTENT_RULES_FILE"`
+}
+
+// Activity is how much history is kept per user, 0 keeps the queue defaults
+type Activity struct {
+	MaxEntries int `yaml:"max_entries" env:"ACTIVITY_MAX_ENTRIES"`
+	MaxDays    int `yaml:"max_days" env:"ACTIVITY_MAX_DAYS"`
+}
+
+// Alert is which logins are flagged as suspicious
+type Alert struct {
+	MaxFailures          int    `yaml:"max_failures" env:"ALERT_MAX_FAILURES"`
+	FailureWindowMinutes int    `yaml:"failure_window_minutes" env:"ALERT_FAILURE_WINDOW_MINUTES"`
+	InactiveDays         int    `yaml:"inactive_days" env:"ALERT_INACTIVE_DAYS"`
+	WebhookURL           string `yaml:"webhook_url" env:"ALERT_WEBHOOK_URL"`
+}
+
+// Report is when reported profiles are hidden and where the moderators hear about them, by
+// email to the ADMIN_USERS when SMTP is set up and by webhook
+type Report struct {
+	// HideAfter hides a profile from the map once this many users reported it, 0 never does
+	HideAfter  int    `yaml:"hide_after" env:"REPORT_HIDE_AFTER"`
+	WebhookURL string `yaml:"webhook_url" env:"REPORT_WEBHOOK_URL"`
+}
+
+// SMTP is where alert emails are sent from, nothing is sent when Addr is empty
+type SMTP struct {
+	Addr     string `yaml:"addr" env:"SMTP_ADDR"`
+	From     string `yaml:"from" env:"SMTP_FROM"`
+	Username string `yaml:"username" env:"SMTP_USERNAME"`
+	Password string `yaml:"password" env:"SMTP_PASSWORD"`
+}
+
+// TwoFactor is the two-factor authentication settings
+type TwoFactor struct {
+	Issuer string `yaml:"issuer" env:"TWO_FACTOR_ISSUER"`
+	// Required hides contact details from users who have not turned it on
+	Required bool `yaml:"required" env:"TWO_FACTOR_REQUIRED"`
+}
+
+// Log is how much is logged and how, json or text (logfmt)
+type Log struct {
+	Level  string `yaml:"level" env:"LOG_LEVEL"`
+	Format string `yaml:"format" env:"LOG_FORMAT"`
+}
+
+// Tracing is where the spans are exported, none, stdout or otlp
+type Tracing struct {
+	Exporter string `yaml:"exporter" env:"TRACING_EXPORTER"`
+	// OTLPEndpoint is the OTLP/HTTP url of the collector, http://localhost:4318 when empty
+	OTLPEndpoint string  `yaml:"otlp_endpoint" env:"TRACING_OTLP_ENDPOINT"`
+	ServiceName  string  `yaml:"service_name" env:"TRACING_SERVICE_NAME"`
+	SampleRatio  float64 `yaml:"sample_ratio" env:"TRACING_SAMPLE_RATIO"`
+}
+
+// Metrics is who can scrape /metrics, anyone when Token is empty
+type Metrics struct {
+	// Token has to be sent as a bearer token in the Authorization header
+	Token string `yaml:"token" env:"METRICS_TOKEN"`
+}
+
+// Headers is the security headers sent with every response
+type Headers struct {
+	HSTSMaxAgeSeconds     int    `yaml:"hsts_max_age_seconds" env:"HSTS_MAX_AGE_SECONDS"`
+	HSTSIncludeSubdomains bool   `yaml:"hsts_include_subdomains" env:"HSTS_INCLUDE_SUBDOMAINS"`
+	HSTSPreload           bool   `yaml:"hsts_preload" env:"HSTS_PRELOAD"`
+	FrameOptions          string `yaml:"frame_options" env:"FRAME_OPTIONS"`
+	ReferrerPolicy        string `yaml:"referrer_policy" env:"REFERRER_POLICY"`
+	PermissionsPolicy     string `yaml:"permissions_policy" env:"PERMISSIONS_POLICY"`
+}
+
+// Default return the settings used for anything not set
+func Default() Config {
+	params := security.DefaultPasswordParams
+	policy := security.DefaultPasswordPolicy
+	return Config{
+		CertFile:    "cert/cert.pem",
+		KeyFile:     "cert/key.pem",
+		TemplateDir: "templates",
+		Database: Database{
+			MaxOpenConns:           25,
+			MaxIdleConns:           25,
+			ConnMaxLifetimeMinutes: 5,
+		},
+		Server: Server{
+			ReadHeaderTimeout: 10,
+			ReadTimeout:       30,
+			WriteTimeout:      60,
+			IdleTimeout:       120,
+			ShutdownTimeout:   30,
+			DrainDelay:        5,
+		},
+		Password: Password{
+			Algorithm:     params.Algorithm,
+			Argon2Memory:  params.Argon2Memory,
+			Argon2Time:    params.Argon2Time,
+			Argon2Threads: params.Argon2Threads,
+			BcryptCost:    params.BcryptCost,
+			MinLength:     policy.MinLength,
+			MaxLength:     policy.MaxLength,
+			RequireDigit:  policy.RequireDigit,
+			RequireLower:  policy.RequireLower,
+			RequireUpper:  policy.RequireUpper,
+			RequireSymbol: policy.RequireSymbol,
+			AllowUnicode:  policy.AllowUnicode,
+			MinEntropy:    policy.MinEntropy,
+		},
+		Content:   Content{MaxLength: content.DefaultPolicy.MaxLength},
+		Report:    Report{HideAfter: 3},
+		TwoFactor: TwoFactor{Issuer: "HireMe"},
+		Log:       Log{Level: "info", Format: "json"},
+		Tracing:   Tracing{Exporter: tracing.None, ServiceName: "hireme", SampleRatio: 1},
+		Headers: Headers{
+			HSTSMaxAgeSeconds:     int(headers.Default.HSTSMaxAge / time.Second),
+			HSTSIncludeSubdomains: headers.Default.HSTSIncludeSubdomains,
+			HSTSPreload:           headers.Default.HSTSPreload,
+			FrameOptions:          headers.Default.FrameOptions,
+			ReferrerPolicy:        headers.Default.ReferrerPolicy,
+			PermissionsPolicy:     headers.Default.PermissionsPolicy,
+		},
+	}
+}
+
+// Errors is every problem found in the settings
+type Errors []error
+
+func (e Errors) Error() string {
+	messages := make([]string, len(e))
+	for i, err := range e {
+		messages[i] = err.Error()
+	}
+	return strings.Join(messages, "; ")
+}
+
+// Load builds the Config from the defaults, then the YAML or TOML file named by CONFIG_FILE, then
+// the dotEnv file and then lookup, usually os.LookupEnv, each one winning over the one before.
+// A missing dotEnv file is fine, any other problem is returned together as Errors.
+func Load(dotEnv string, lookup func(string) (string, bool)) (Config, error) {
+	vars := map[string]string{}
+	if dotEnv != "" {
+		read, err := godotenv.Read(dotEnv)
+		if err != nil && !errors.Is(err, os.ErrNotExist) {
+			return Config{}, fmt.Errorf("%s: %w", dotEnv, err)
+		}
+		if read != nil {
+			vars = read
+		}
+	}
+	// the environment wins over the .env file, the same as godotenv.Load
+	get := func(name string) (string, bool) {
+		if value, ok := lookup(name); ok {
+			return value, true
+		}
+		value, ok := vars[name]
+		return value, ok
+	}
+
+	c := Default()
+	var errs Errors
+	if file, _ := get("CONFIG_FILE"); file != "" {
+		if err := c.readFile(file); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	errs = append(errs, setFromEnv(reflect.ValueOf(&c).Elem(), get)...)
+	errs = append(errs, c.Validate()...)
+	if len(errs) > 0 {
+		return c, errs
+	}
+	return c, nil
+}
+
+// read the YAML file, or the TOML file when it ends in .toml, over the settings,
+// unknown keys are refused to catch typos
+func (c *Config) readFile(path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+
+	// TOML has the same keys as YAML, it goes through the YAML decoder so they are checked the same way
+	if strings.EqualFold(filepath.Ext(path), ".toml") {
+		settings := map[string]interface{}{}
+		if _, err := toml.Decode(string(data), &settings); err != nil {
+			return fmt.Errorf("%s: %w", path, err)
+		}
+		if data, err = yaml.Marshal(settings); err != nil {
+			return fmt.Errorf("%s: %w", path, err)
+		}
+	}
+
+	decoder := yaml.NewDecoder(bytes.NewReader(data))
+	decoder.KnownFields(true)
+	if err := decoder.Decode(c); err != nil {
+		return fmt.Errorf("%s: %w", path, err)
+	}
+	return nil
+}
+
+// set every field with an env tag that get finds, going into nested structs
+func setFromEnv(v reflect.Value, get func(string) (string, bool)) Errors {
+	var errs Errors
+	for i := 0; i < v.NumField(); i++ {
+		field := v.Field(i)
+		name := v.Type().Field(i).Tag.Get("env")
+		if name == "" {
+			if field.Kind() == reflect.Struct {
+				errs = append(errs, setFromEnv(field, get)...)
+			}
+			continue
+		}
+		value, ok := get(name)
+		if !ok {
+			continue
+		}
+		if err := setField(field, value); err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", name, err))
+		}
+	}
+	return errs
+}
+
+func setField(field reflect.Value, value string) error {
+	value = strings.TrimSpace(value)
+	switch field.Kind() {
+	case reflect.String:
+		field.SetString(value)
+	case reflect.Bool:
+		b, err := strconv.ParseBool(value)
+		if err != nil {
+			return fmt.Errorf("%q is not true or false", value)
+		}
+		field.SetBool(b)
+	case reflect.Int:
+		n, err := strconv.ParseInt(value, 10, 64)
+		if err != nil {
+			return fmt.Errorf("%q is not a whole number", value)
+		}
+		field.SetInt(n)
+	case reflect.Uint8, reflect.Uint32:
+		n, err := strconv.ParseUint(value, 10, field.Type().Bits())
+		if err != nil {
+			return fmt.Errorf("%q is not a whole number up to %d bits", value, field.Type().Bits())
+		}
+		field.SetUint(n)
+	case reflect.Float64:
+		n, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			return fmt.Errorf("%q is not a number", value)
+		}
+		field.SetFloat(n)
+	case reflect.Slice:
+		// lists are comma separated
+		list := []string{}
+		for _, item := range strings.Split(value, ",") {
+			if item = strings.TrimSpace(item); item != "" {
+				list = append(list, item)
+			}
+		}
+		field.Set(reflect.ValueOf(list))
+	default:
+		return fmt.Errorf("cannot be set from the environment")
+	}
+	return nil
+}
+
+// ValidateServe return every problem with the settings only the server needs, the port,
+// the certificate, the templates and the api urls, nil when there is none
+func (c Config) ValidateServe() Errors {
+	var errs Errors
+	problem := func(format string, args ...interface{}) {
+		errs = append(errs, fmt.Errorf(format, args...))
+	}
+	fileExists := func(name, path string) {
+		if _, err := os.Stat(path); err != nil {
+			problem("%s: %v", name, err)
+		}
+	}
+
+	if c.Port == "" {
+		problem("PORT: is required")
+	} else if !validPort(c.Port) {
+		problem("PORT: %q is not a port number", c.Port)
+	}
+	if c.HTTPRedirectPort != "" && !validPort(c.HTTPRedirectPort) {
+		problem("HTTP_REDIRECT_PORT: %q is not a port number", c.HTTPRedirectPort)
+	}
+	fileExists("TLS_CERT_FILE", c.CertFile)
+	fileExists("TLS_KEY_FILE", c.KeyFile)
+	fileExists("TEMPLATE_DIR", c.TemplateDir)
+
+	for _, setting := range []struct{ name, value string }{{"API", c.API}, {"LOGIN_API", c.LoginAPI}} {
+		if setting.value == "" {
+			problem("%s: is required", setting.name)
+		} else if u, err := url.Parse(setting.value); err != nil || u.Scheme == "" || u.Host == "" {
+			problem("%s: %q is not a full url", setting.name, setting.value)
+		}
+	}
+	return errs
+}
+
+// Validate return every problem with the settings every command needs, the database, the keys
+// and the rules, nil when there is none. The server checks its own settings with ValidateServe.
+func (c Config) Validate() Errors {
+	var errs Errors
+	problem := func(format string, args ...interface{}) {
+		errs = append(errs, fmt.Errorf(format, args...))
+	}
+	fileExists := func(name, path string) {
+		if _, err := os.Stat(path); err != nil {
+			problem("%s: %v", name, err)
+		}
+	}
+
+	if c.Database.DSN == "" {
+		problem("DATABASE_IP: is required")
+	}
+	if _, err := headers.ParseProxies(c.TrustedProxies); err != nil {
+		problem("TRUSTED_PROXIES: %v", err)
+	}
+
+	if _, err := logging.ParseLevel(c.Log.Level); err != nil {
+		problem("LOG_LEVEL: %v", err)
+	}
+	if c.Log.Format != "json" && c.Log.Format != "text" {
+		problem("LOG_FORMAT: %q is not json or text", c.Log.Format)
+	}
+
+	switch c.Tracing.Exporter {
+	case tracing.None, tracing.Stdout, tracing.OTLP:
+	default:
+		problem("TRACING_EXPORTER: %q is not none, stdout or otlp", c.Tracing.Exporter)
+	}
+	if c.Tracing.OTLPEndpoint != "" {
+		if u, err := url.Parse(c.Tracing.OTLPEndpoint); err != nil || (u.Scheme != "https" && u.Scheme != "http") || u.Host == "" {
+			problem("TRACING_OTLP_ENDPOINT: %q is not an http url", c.Tracing.OTLPEndpoint)
+		}
+	}
+	if c.Tracing.SampleRatio < 0 || c.Tracing.SampleRatio > 1 {
+		problem("TRACING_SAMPLE_RATIO: has to be from 0 to 1")
+	}
+
+	if c.Encryption.Keys == "" && c.Encryption.KeyFile == "" {
+		problem("ENCRYPTION_KEYS: is required, or ENCRYPTION_KEY_FILE")
+	} else if c.Encryption.Keys != "" {
+		if _, _, err := security.ParseKeys(c.Encryption.Keys); err != nil {
+			problem("ENCRYPTION_KEYS: %v", err)
+		}
+	} else {
+		fileExists("ENCRYPTION_KEY_FILE", c.Encryption.KeyFile)
+	}
+	if c.Audit.HMACKey == "" {
+		problem("AUDIT_HMAC_KEY: is required")
+	} else if key, err := base64.StdEncoding.DecodeString(c.Audit.HMACKey); err != nil || len(key) < minAuditKey {
+		problem("AUDIT_HMAC_KEY: has to be base64 of at least %d bytes", minAuditKey)
+	}
+
+	if err := c.PasswordParams().Validate(); err != nil {
+		problem("PASSWORD_ALGORITHM: %v", err)
+	}
+	if c.Password.MinLength < 1 {
+		problem("PASSWORD_MIN_LENGTH: has to be 1 or more")
+	}
+	if c.Password.MaxLength > 0 && c.Password.MaxLength < c.Password.MinLength {
+		problem("PASSWORD_MAX_LENGTH: has to be at least PASSWORD_MIN_LENGTH")
+	}
+	if c.Password.BreachedFile != "" {
+		fileExists("BREACHED_PASSWORDS_FILE", c.Password.BreachedFile)
+	}
+	if c.DisposableEmailFile != "" {
+		fileExists("DISPOSABLE_EMAIL_FILE", c.DisposableEmailFile)
+	}
+	if c.Content.MinLength < 0 {
+		problem("MESSAGE_MIN_LENGTH: cannot be negative")
+	}
+	if c.Content.MaxLength < 1 || c.Content.MaxLength > content.ColumnLength {
+		problem("MESSAGE_MAX_LENGTH: has to be between 1 and %d", content.ColumnLength)
+	} else if c.Content.MaxLength < c.Content.MinLength {
+		problem("MESSAGE_MAX_LENGTH: has to be at least MESSAGE_MIN_LENGTH")
+	}
+	if c.Content.RulesFile != "" {
+		fileExists("CONTENT_RULES_FILE", c.Content.RulesFile)
+	}
+
+	for _, setting := range []struct {
+		name  string
+		value int
+	}{
+		{"ACTIVITY_MAX_ENTRIES", c.Activity.MaxEntries},
+		{"ACTIVITY_MAX_DAYS", c.Activity.MaxDays},
+		{"ALERT_MAX_FAILURES", c.Alert.MaxFailures},
+		{"ALERT_FAILURE_WINDOW_MINUTES", c.Alert.FailureWindowMinutes},
+		{"ALERT_INACTIVE_DAYS", c.Alert.InactiveDays},
+		{"REPORT_HIDE_AFTER", c.Report.HideAfter},
+		{"HSTS_MAX_AGE_SECONDS", c.Headers.HSTSMaxAgeSeconds},
+		{"DATABASE_MAX_OPEN_CONNS", c.Database.MaxOpenConns},
+		{"DATABASE_MAX_IDLE_CONNS", c.Database.MaxIdleConns},
+		{"DATABASE_CONN_MAX_LIFETIME_MINUTES", c.Database.ConnMaxLifetimeMinutes},
+		{"HTTP_READ_HEADER_TIMEOUT_SECONDS", c.Server.ReadHeaderTimeout},
+		{"HTTP_READ_TIMEOUT_SECONDS", c.Server.ReadTimeout},
+		{"HTTP_WRITE_TIMEOUT_SECONDS", c.Server.WriteTimeout},
+		{"HTTP_IDLE_TIMEOUT_SECONDS", c.Server.IdleTimeout},
+		{"HTTP_SHUTDOWN_TIMEOUT_SECONDS", c.Server.ShutdownTimeout},
+		{"HTTP_DRAIN_DELAY_SECONDS", c.Server.DrainDelay},
+	} {
+		if setting.value < 0 {
+			problem("%s: cannot be negative", setting.name)
+		}
+	}
+	if c.Alert.WebhookURL != "" {
+		if u, err := url.Parse(c.Alert.WebhookURL); err != nil || (u.Scheme != "https" && u.Scheme != "http") {
+			problem("ALERT_WEBHOOK_URL: %q is not an http url", c.Alert.WebhookURL)
+		}
+	}
+	if c.Report.WebhookURL != "" {
+		if u, err := url.Parse(c.Report.WebhookURL); err != nil || (u.Scheme != "https" && u.Scheme != "http") {
+			problem("REPORT_WEBHOOK_URL: %q is not an http url", c.Report.WebhookURL)
+		}
+	}
+	if c.SMTP.Addr != "" {
+		if _, port, err := net.SplitHostPort(c.SMTP.Addr); err != nil || !validPort(port) {
+			problem("SMTP_ADDR: %q is not host:port", c.SMTP.Addr)
+		}
+		if c.SMTP.From == "" {
+			problem("SMTP_FROM: is required with SMTP_ADDR")
+		}
+	}
+
+	if c.TwoFactor.Issuer == "" {
+		problem("TWO_FACTOR_ISSUER: cannot be empty")
+	}
+	switch strings.ToUpper(c.Headers.FrameOptions) {
+	case "", "DENY", "SAMEORIGIN":
+	default:
+		problem("FRAME_OPTIONS: %q is not DENY or SAMEORIGIN", c.Headers.FrameOptions)
+	}
+	return errs
+}
+
+func validPort(port string) bool {
+	n, err := strconv.Atoi(port)
+	return err == nil && n > 0 && n < 65536
+}
+
+// PasswordParams return the password hashing params
+func (c Config) PasswordParams() security.PasswordParams {
+	params := security.DefaultPasswordParams
+	params.Algorithm = c.Password.Algorithm
+	params.Argon2Memory = c.Password.Argon2Memory
+	params.Argon2Time = c.Password.Argon2Time
+	params.Argon2Threads = c.Password.Argon2Threads
+	params.BcryptCost = c.Password.BcryptCost
+	return params
+}
+
+// PasswordPolicy return the password policy, opening the breached password file when set
+func (c Config) PasswordPolicy() (security.PasswordPolicy, error) {
+	policy := security.PasswordPolicy{
+		MinLength:     c.Password.MinLength,
+		MaxLength:     c.Password.MaxLength,
+		RequireDigit:  c.Password.RequireDigit,
+		RequireLower:  c.Password.RequireLower,
+		RequireUpper:  c.Password.RequireUpper,
+		RequireSymbol: c.Password.RequireSymbol,
+		AllowUnicode:  c.Password.AllowUnicode,
+		MinEntropy:    c.Password.MinEntropy,
+	}
+	if c.Password.BreachedFile != "" {
+		breached, err := security.OpenBreachedList(c.Password.BreachedFile)
+		if err != nil {
+			return policy, err
+		}
+		policy.Breached = breached
+	}
+	return policy, nil
+}
+
+// ContentPolicy return the policy of the profile message, reading the rules file when set
+func (c Config) ContentPolicy() (content.Policy, error) {
+	policy := content.Policy{
+		MinLength: c.Content.MinLength,
+		MaxLength: c.Content.MaxLength,
+		Rules:     content.DefaultRules(),
+	}
+	if c.Content.RulesFile != "" {
+		rules, err := content.LoadRules(c.Content.RulesFile)
+		if err != nil {
+			return policy, err
+		}
+		policy.Rules = rules
+	}
+	return policy, nil
+}
+
+// Retention return how much activity history is kept
+func (c Config) Retention() queue.Retention {
+	return queue.Retention{
+		MaxEntries: c.Activity.MaxEntries,
+		MaxAge:     time.Duration(c.Activity.MaxDays) * 24 * time.Hour,
+	}
+}
+
+// HTTPServer return a server for the handler with the timeouts set, Addr is left for the caller
+func (c Config) HTTPServer(handler http.Handler) *http.Server {
+	return &http.Server{
+		Handler:           handler,
+		ReadHeaderTimeout: time.Duration(c.Server.ReadHeaderTimeout) * time.Second,
+		ReadTimeout:       time.Duration(c.Server.ReadTimeout) * time.Second,
+		WriteTimeout:      time.Duration(c.Server.WriteTimeout) * time.Second,
+		IdleTimeout:       time.Duration(c.Server.IdleTimeout) * time.Second,
+	}
+}
+
+// TracingOptions return the tracing settings
+func (c Config) TracingOptions() tracing.Options {
+	return tracing.Options{
+		Exporter:    c.Tracing.Exporter,
+		Endpoint:    c.Tracing.OTLPEndpoint,
+		ServiceName: c.Tracing.ServiceName,
+		SampleRatio: c.Tracing.SampleRatio,
+	}
+}
+
+// HeaderConfig return the security headers, the content security policy stays the default
+func (c Config) HeaderConfig() headers.Config {
+	config := headers.Default
+	config.HSTSMaxAge = time.Duration(c.Headers.HSTSMaxAgeSeconds) * time.Second
+	config.HSTSIncludeSubdomains = c.Headers.HSTSIncludeSubdomains
+	config.HSTSPreload = c.Headers.HSTSPreload
+	config.FrameOptions = c.Headers.FrameOptions
+	config.ReferrerPolicy = c.Headers.ReferrerPolicy
+	config.PermissionsPolicy = c.Headers.PermissionsPolicy
+	return config
+}
+
+// Proxies return the TrustedProxies, Validate has checked them
+func (c Config) Proxies() headers.Proxies {
+	proxies, _ := headers.ParseProxies(c.TrustedProxies)
+	return proxies
+}
+
+// AuditKey return the key of the audit log chain
+func (c Config) AuditKey() []byte {
+	key, _ := base64.StdEncoding.DecodeString(c.Audit.HMACKey)
+	return key
+}
@@ -0,0 +1,154 @@
+package config
+
+import (
+	"encoding/base64"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	. "github.com/franela/goblin"
+)
+
+func TestConfig(t *testing.T) {
+	gob := Goblin(t)
+	dir := t.TempDir()
+	cert := filepath.Join(dir, "cert.pem")
+	os.WriteFile(cert, []byte("cert"), 0600)
+	key := "k1:" + base64.StdEncoding.EncodeToString([]byte("0123456789abcdef"))
+
+	// the least a server needs to start
+	env := func(extra map[string]string) func(string) (string, bool) {
+		vars := map[string]string{
+			"PORT":            "5221",
+			"API":             "https://localhost:5221/api/v1/users",
+			"LOGIN_API":       "https://localhost:5221/api/v1/login",
+			"DATABASE_IP":     "root:password@tcp(127.0.0.1:32769)/my_db",
+			"ENCRYPTION_KEYS": key,
+			"AUDIT_HMAC_KEY":  base64.StdEncoding.EncodeToString([]byte("0123456789abcdef0123456789abcdef")),
+			"TLS_CERT_FILE":   cert,
+			"TLS_KEY_FILE":    cert,
+			"TEMPLATE_DIR":    dir,
+		}
+		for k, v := range extra {
+			vars[k] = v
+		}
+		return func(name string) (string, bool) {
+			v, ok := vars[name]
+			return v, ok
+		}
+	}
+
+	gob.Describe("Load Test", func() {
+		gob.It("should keep the defaults for anything not set", func() {
+			c, err := Load("", env(nil))
+			gob.Assert(err).IsNil()
+			gob.Assert(c.Port).Equal("5221")
+			gob.Assert(c.TwoFactor.Issuer).Equal("HireMe")
+			gob.Assert(c.Password.MinLength).Equal(Default().Password.MinLength)
+			gob.Assert(c.HeaderConfig().HSTSMaxAge).Equal(365 * 24 * time.Hour)
+			gob.Assert(c.HTTPServer(nil).ReadHeaderTimeout).Equal(10 * time.Second)
+		})
+
+		gob.It("should read every kind of field from the environment", func() {
+			c, err := Load("", env(map[string]string{
+				"ADMIN_USERS":            " jiahao, admin ,",
+				"TWO_FACTOR_REQUIRED":    "true",
+				"ARGON2_THREADS":         "4",
+				"PASSWORD_MIN_ENTROPY":   "40.5",
+				"ACTIVITY_MAX_DAYS":      "30",
+				"PASSWORD_ALLOW_UNICODE": "1",
+			}))
+			gob.Assert(err).IsNil()
+			gob.Assert(c.AdminUsers).Equal([]string{"jiahao", "admin"})
+			gob.Assert(c.TwoFactor.Required).IsTrue()
+			gob.Assert(c.PasswordParams().Argon2Threads).Equal(uint8(4))
+			gob.Assert(c.Password.MinEntropy).Equal(40.5)
+			gob.Assert(c.Retention().MaxAge).Equal(30 * 24 * time.Hour)
+			gob.Assert(c.Password.AllowUnicode).IsTrue()
+		})
+
+		gob.It("should let the environment win over .env and .env over the yaml file", func() {
+			yamlFile := filepath.Join(dir, "config.yaml")
+			os.WriteFile(yamlFile, []byte("port: \"1000\"\ngoogle:\n  api_key: from-yaml\n  map_id: from-yaml\ntwo_factor:\n  issuer: from-yaml\n"), 0600)
+			dotEnv := filepath.Join(dir, ".env")
+			os.WriteFile(dotEnv, []byte("CONFIG_FILE="+yamlFile+"\nGOOGLE_API=from-dotenv\nTWO_FACTOR_ISSUER=from-dotenv\n"), 0600)
+
+			c, err := Load(dotEnv, env(map[string]string{"TWO_FACTOR_ISSUER": "from-env"}))
+			gob.Assert(err).IsNil()
+			gob.Assert(c.Google.MapID).Equal("from-yaml")
+			gob.Assert(c.Google.APIKey).Equal("from-dotenv")
+			gob.Assert(c.TwoFactor.Issuer).Equal("from-env")
+			// PORT is in the environment too
+			gob.Assert(c.Port).Equal("5221")
+		})
+
+		gob.It("should refuse unknown keys in the yaml file", func() {
+			yamlFile := filepath.Join(dir, "typo.yaml")
+			os.WriteFile(yamlFile, []byte("prot: \"1000\"\n"), 0600)
+			_, err := Load("", env(map[string]string{"CONFIG_FILE": yamlFile}))
+			gob.Assert(err != nil).IsTrue()
+		})
+
+		gob.It("should read a toml file with the yaml keys", func() {
+			tomlFile := filepath.Join(dir, "config.toml")
+			os.WriteFile(tomlFile, []byte("admin_users = [\"jiahao\"]\n\n[google]\nmap_id = \"from-toml\"\n\n[report]\nhide_after = 7\n"), 0600)
+			c, err := Load("", env(map[string]string{"CONFIG_FILE": tomlFile}))
+			gob.Assert(err).IsNil()
+			gob.Assert(c.Google.MapID).Equal("from-toml")
+			gob.Assert(c.Report.HideAfter).Equal(7)
+			gob.Assert(c.AdminUsers).Equal([]string{"jiahao"})
+
+			os.WriteFile(tomlFile, []byte("prot = \"1000\"\n"), 0600)
+			_, err = Load("", env(map[string]string{"CONFIG_FILE": tomlFile}))
+			gob.Assert(err != nil).IsTrue()
+		})
+
+		gob.It("should report every problem at once", func() {
+			c, err := Load("", func(name string) (string, bool) {
+				v, ok := map[string]string{
+					"ARGON2_TIME":        "lots",
+					"FRAME_OPTIONS":      "ALLOW",
+					"API":                "localhost",
+					"SMTP_ADDR":          "smtp.example.com",
+					"TLS_CERT_FILE":      cert,
+					"TLS_KEY_FILE":       cert,
+					"TEMPLATE_DIR":       dir,
+					"ALERT_MAX_FAILURES": "-1",
+				}[name]
+				return v, ok
+			})
+			errs, ok := err.(Errors)
+			gob.Assert(ok).IsTrue()
+
+			message := errs.Error()
+			for _, name := range []string{"ARGON2_TIME", "DATABASE_IP", "ENCRYPTION_KEYS",
+				"AUDIT_HMAC_KEY", "FRAME_OPTIONS", "SMTP_ADDR", "SMTP_FROM", "ALERT_MAX_FAILURES"} {
+				gob.Assert(strings.Contains(message, name+":")).IsTrue()
+			}
+			gob.Assert(len(errs)).Equal(8)
+
+			message = c.ValidateServe().Error()
+			for _, name := range []string{"PORT", "API", "LOGIN_API"} {
+				gob.Assert(strings.Contains(message, name+":")).IsTrue()
+			}
+			gob.Assert(len(c.ValidateServe())).Equal(3)
+		})
+
+		gob.It("should only need the server settings to serve", func() {
+			c, err := Load("", func(name string) (string, bool) {
+				v, ok := map[string]string{
+					"DATABASE_IP":     "root:password@tcp(127.0.0.1:32769)/my_db",
+					"ENCRYPTION_KEYS": key,
+					"AUDIT_HMAC_KEY":  base64.StdEncoding.EncodeToString([]byte("0123456789abcdef0123456789abcdef")),
+				}[name]
+				return v, ok
+			})
+			gob.Assert(err).IsNil()
+			for _, name := range []string{"PORT", "TLS_CERT_FILE", "TLS_KEY_FILE", "TEMPLATE_DIR", "API", "LOGIN_API"} {
+				gob.Assert(strings.Contains(c.ValidateServe().Error(), name+":")).IsTrue()
+			}
+		})
+	})
+}
@@ -0,0 +1,211 @@
+// Package content decides what the profile message may hold, how long it can be and which
+// rules refuse it, star out part of it or send it to the moderators
+package content
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"unicode/utf8"
+)
+
+// ColumnLength is the most characters the Message column holds, no policy can allow more
+const ColumnLength = 500
+
+// Action is what happens to a text matching a rule
+type Action string
+
+// All the actions a rule can take
+const (
+	// Reject refuses the text, the user is told why
+	Reject Action = "reject"
+	// Mask stars out the matches and keeps the rest
+	Mask Action = "mask"
+	// Review keeps the text and files it for the moderators
+	Review Action = "review"
+)
+
+// Valid checks the action is one of Reject, Mask or Review
+func (a Action) Valid() bool {
+	return a == Reject || a == Mask || a == Review
+}
+
+// Rule finds something in a text and decides what happens to it
+type Rule struct {
+	Name   string
+	Action Action
+	// Message tells the user why the text was refused
+	Message string
+	pattern *regexp.Regexp
+	// except skips the matches it matches in full
+	except *regexp.Regexp
+}
+
+// NewRule return a rule matching the regular expression
+func NewRule(name string, action Action, pattern, message string) (Rule, error) {
+	if !action.Valid() {
+		return Rule{}, fmt.Errorf("rule %s: %q is not reject, mask or review", name, action)
+	}
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return Rule{}, fmt.Errorf("rule %s: %w", name, err)
+	}
+	if message == "" {
+		message = "Message is not allowed (" + name + ")"
+	}
+	return Rule{Name: name, Action: action, Message: message, pattern: re}, nil
+}
+
+// NewBlocklist return a rule matching any of the words, as whole words and in any case
+func NewBlocklist(name string, action Action, words []string, message string) (Rule, error) {
+	quoted := []string{}
+	for _, w := range words {
+		if w = strings.TrimSpace(w); w != "" {
+			quoted = append(quoted, regexp.QuoteMeta(w))
+		}
+	}
+	if len(quoted) == 0 {
+		return Rule{}, fmt.Errorf("rule %s: has no words", name)
+	}
+	return NewRule(name, action, `(?i)\b(?:`+strings.Join(quoted, "|")+`)\b`, message)
+}
+
+// phone numbers of 8 to 15 digits, local or with a country code, with spaces, dots,
+// dashes or brackets between the groups
+const phonePattern = `\+?\(?\d{1,4}\)?(?:[\s.-]?\d){6,14}\b`
+
+// links with a scheme, starting with www. or ending in a common top level domain
+const urlPattern = `(?i)\b(?:https?://\S+|www\.\S+|[a-z0-9-]+(?:\.[a-z0-9-]+)*\.(?:com|net|org|io|co|sg|me|info|biz|xyz|ly|app|dev)\b(?:/\S*)?)`
+
+// dates have as many digits as a phone number
+var datePattern = regexp.MustCompile(`^\d{4}[.-]\d{2}[.-]\d{2}$|^\d{2}[.-]\d{2}[.-]\d{4}$`)
+
+// NewPhoneRule return a rule finding phone numbers
+func NewPhoneRule(action Action) (Rule, error) {
+	rule, err := NewRule("phone", action, phonePattern, "Message cannot contain phone numbers, use the email field to be contacted")
+	rule.except = datePattern
+	return rule, err
+}
+
+// NewURLRule return a rule finding links
+func NewURLRule(action Action) (Rule, error) {
+	return NewRule("url", action, urlPattern, "Message cannot contain links")
+}
+
+// Match return the parts of the text the rule finds
+func (r Rule) Match(text string) []string {
+	if r.pattern == nil {
+		return nil
+	}
+	found := []string{}
+	for _, match := range r.pattern.FindAllString(text, -1) {
+		if !r.skip(match) {
+			found = append(found, match)
+		}
+	}
+	return found
+}
+
+func (r Rule) skip(match string) bool {
+	return r.except != nil && r.except.MatchString(match)
+}
+
+// star out every match of the rule
+func (r Rule) mask(text string) string {
+	return r.pattern.ReplaceAllStringFunc(text, func(match string) string {
+		if r.skip(match) {
+			return match
+		}
+		return strings.Repeat("*", utf8.RuneCountInString(match))
+	})
+}
+
+// Violation is a rule the text broke
+type Violation struct {
+	// Rule is the name of the rule, min_length and max_length for the length limits
+	Rule    string
+	Action  Action
+	Message string
+}
+
+// Result is what the policy made of a text
+type Result struct {
+	// Text is the text with the matches of the mask rules starred out
+	Text string
+	// Violations are the rules the text broke in the order of the policy, the length limits last
+	Violations []Violation
+}
+
+// filter return the violations with the action
+func (r Result) filter(action Action) []Violation {
+	found := []Violation{}
+	for _, v := range r.Violations {
+		if v.Action == action {
+			found = append(found, v)
+		}
+	}
+	return found
+}
+
+// Rejected return the violations refusing the text
+func (r Result) Rejected() []Violation {
+	return r.filter(Reject)
+}
+
+// Review return the violations the moderators should look at
+func (r Result) Review() []Violation {
+	return r.filter(Review)
+}
+
+// Policy is the length limits of the message, counted in characters, and the rules it is checked against
+type Policy struct {
+	MinLength int
+	MaxLength int
+	Rules     []Rule
+}
+
+// Check runs every rule over the text, masks what the mask rules find and then checks the length
+func (p Policy) Check(text string) Result {
+	result := Result{Text: text, Violations: []Violation{}}
+	for _, rule := range p.Rules {
+		if len(rule.Match(result.Text)) == 0 {
+			continue
+		}
+		result.Violations = append(result.Violations, Violation{rule.Name, rule.Action, rule.Message})
+		if rule.Action == Mask {
+			result.Text = rule.mask(result.Text)
+		}
+	}
+
+	length := utf8.RuneCountInString(result.Text)
+	if length < p.MinLength {
+		result.Violations = append(result.Violations, Violation{"min_length", Reject,
+			fmt.Sprintf("Message has to be at least %d characters", p.MinLength)})
+	}
+	if p.MaxLength > 0 && length > p.MaxLength {
+		result.Violations = append(result.Violations, Violation{"max_length", Reject,
+			fmt.Sprintf("Message can be at most %d characters, it has %d", p.MaxLength, length)})
+	}
+	return result
+}
+
+// DefaultPolicy is the policy used when none is configured, links are refused and phone numbers starred out
+var DefaultPolicy = Policy{
+	MaxLength: 50,
+	Rules:     DefaultRules(),
+}
+
+// DefaultRules return the rules used when no rules file is given
+func DefaultRules() []Rule {
+	phone, _ := NewPhoneRule(Mask)
+	url, _ := NewURLRule(Reject)
+	return []Rule{url, phone}
+}
+
+// Validate checks the lengths fit the message column
+func (p Policy) Validate() error {
+	if p.MinLength < 0 || p.MaxLength < 1 || p.MaxLength > ColumnLength || p.MaxLength < p.MinLength {
+		return fmt.Errorf("message max length has to be between the min length and %d", ColumnLength)
+	}
+	return nil
+}
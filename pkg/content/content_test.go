@@ -0,0 +1,118 @@
+package content
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	. "github.com/franela/goblin"
+)
+
+func TestContent(t *testing.T) {
+	gob := Goblin(t)
+	names := func(violations []Violation) []string {
+		n := []string{}
+		for _, v := range violations {
+			n = append(n, v.Rule)
+		}
+		return n
+	}
+
+	gob.Describe("Detect Test", func() {
+		gob.It("should find phone numbers but not years or dates", func() {
+			phone, _ := NewPhoneRule(Mask)
+			for _, text := range []string{"call 9123 4567", "+65 9123-4567", "(065) 91234567", "whatsapp 6591234567"} {
+				gob.Assert(len(phone.Match(text))).Equal(1)
+			}
+			for _, text := range []string{"5 years in IT", "since 2019", "free from 2021-01-01", "back on 01.02.2021"} {
+				gob.Assert(len(phone.Match(text))).Equal(0)
+			}
+		})
+
+		gob.It("should find links", func() {
+			url, _ := NewURLRule(Reject)
+			for _, text := range []string{"see https://example.org/cv", "www.example.com", "my site jiahao.dev", "portfolio.sg/me"} {
+				gob.Assert(len(url.Match(text))).Equal(1)
+			}
+			for _, text := range []string{"Looking for a law firm", "Node.js and Go", "3.5 years"} {
+				gob.Assert(len(url.Match(text))).Equal(0)
+			}
+		})
+	})
+
+	gob.Describe("Policy Test", func() {
+		gob.It("should mask, reject and review by rule", func() {
+			spam, _ := NewBlocklist("spam", Review, []string{"crypto", "get rich"}, "")
+			p := Policy{MaxLength: 50, Rules: append(DefaultRules(), spam)}
+
+			result := p.Check("Call 9123 4567 about Crypto")
+			gob.Assert(result.Text).Equal("Call ********* about Crypto")
+			gob.Assert(names(result.Violations)).Equal([]string{"phone", "spam"})
+			gob.Assert(len(result.Rejected())).Equal(0)
+			gob.Assert(names(result.Review())).Equal([]string{"spam"})
+
+			result = p.Check("see www.example.com")
+			gob.Assert(names(result.Rejected())).Equal([]string{"url"})
+			gob.Assert(result.Rejected()[0].Message).Equal("Message cannot contain links")
+
+			// blocked words are whole words only
+			gob.Assert(len(p.Check("cryptography researcher").Violations)).Equal(0)
+		})
+
+		gob.It("should report the length instead of cutting the message", func() {
+			p := Policy{MinLength: 5, MaxLength: 10}
+			result := p.Check("ünïcödé chars")
+			gob.Assert(result.Text).Equal("ünïcödé chars")
+			gob.Assert(result.Rejected()[0].Message).Equal("Message can be at most 10 characters, it has 13")
+			gob.Assert(names(p.Check("hi").Rejected())).Equal([]string{"min_length"})
+			gob.Assert(len(p.Check("ünïcödé").Violations)).Equal(0)
+		})
+
+		gob.It("should refuse limits the column cannot hold", func() {
+			gob.Assert(Policy{MaxLength: ColumnLength + 1}.Validate()).IsNotNil()
+			gob.Assert(Policy{MinLength: 20, MaxLength: 10}.Validate()).IsNotNil()
+			gob.Assert(DefaultPolicy.Validate()).IsNil()
+		})
+	})
+
+	gob.Describe("Rules File Test", func() {
+		gob.It("should load the rules in order", func() {
+			file := filepath.Join(t.TempDir(), "rules.yaml")
+			os.WriteFile(file, []byte(`rules:
+  - name: links
+    detect: url
+    action: review
+  - name: swearing
+    words: [darn, heck]
+    action: mask
+  - name: money
+    pattern: '(?i)\$\d+ per day'
+    action: reject
+    message: Message cannot promise money
+`), 0600)
+			rules, err := LoadRules(file)
+			gob.Assert(err).IsNil()
+			p := Policy{MaxLength: 100, Rules: rules}
+
+			result := p.Check("Heck, earn $500 per day at www.example.com")
+			gob.Assert(result.Text).Equal("****, earn $500 per day at www.example.com")
+			gob.Assert(names(result.Review())).Equal([]string{"links"})
+			gob.Assert(result.Rejected()[0].Message).Equal("Message cannot promise money")
+		})
+
+		gob.It("should refuse a rule it cannot use", func() {
+			for _, rule := range []string{
+				"  - name: x\n    detect: fax\n    action: reject\n",
+				"  - name: x\n    words: [a]\n    action: delete\n",
+				"  - name: x\n    words: [a]\n    pattern: b\n    action: mask\n",
+				"  - name: x\n    pattern: '('\n    action: mask\n",
+				"  - name: x\n    patern: a\n    action: mask\n",
+			} {
+				file := filepath.Join(t.TempDir(), "rules.yaml")
+				os.WriteFile(file, []byte("rules:\n"+rule), 0600)
+				_, err := LoadRules(file)
+				gob.Assert(err).IsNotNil()
+			}
+		})
+	})
+}
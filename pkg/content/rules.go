@@ -0,0 +1,89 @@
+package content
+
+import (
+	"fmt"
+	"os"
+
+	"gopkg.in/yaml.v3"
+)
+
+// ruleSpec is a rule as written in the rules file, it finds one of a built in detector,
+// a list of words or a regular expression
+type ruleSpec struct {
+	Name string `yaml:"name"`
+	// Detect is phone or url
+	Detect  string   `yaml:"detect"`
+	Words   []string `yaml:"words"`
+	Pattern string   `yaml:"pattern"`
+	Action  Action   `yaml:"action"`
+	Message string   `yaml:"message"`
+}
+
+// LoadRules reads the rules from a YAML file, a list of rules under the rules key, in the order they run
+func LoadRules(path string) ([]Rule, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var file struct {
+		Rules []ruleSpec `yaml:"rules"`
+	}
+	decoder := yaml.NewDecoder(f)
+	// unknown keys are refused to catch typos
+	decoder.KnownFields(true)
+	if err := decoder.Decode(&file); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+
+	rules := []Rule{}
+	for i, spec := range file.Rules {
+		if spec.Name == "" {
+			return nil, fmt.Errorf("%s: rule %d has no name", path, i+1)
+		}
+		rule, err := spec.rule()
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+		rules = append(rules, rule)
+	}
+	return rules, nil
+}
+
+// build the rule from the one way it finds text
+func (s ruleSpec) rule() (Rule, error) {
+	if !s.Action.Valid() {
+		return Rule{}, fmt.Errorf("rule %s: %q is not reject, mask or review", s.Name, s.Action)
+	}
+	ways := 0
+	for _, set := range []bool{s.Detect != "", len(s.Words) > 0, s.Pattern != ""} {
+		if set {
+			ways++
+		}
+	}
+	if ways != 1 {
+		return Rule{}, fmt.Errorf("rule %s: needs exactly one of detect, words or pattern", s.Name)
+	}
+
+	var rule Rule
+	switch s.Detect {
+	case "":
+		if len(s.Words) > 0 {
+			return NewBlocklist(s.Name, s.Action, s.Words, s.Message)
+		}
+		return NewRule(s.Name, s.Action, s.Pattern, s.Message)
+	case "phone":
+		rule, _ = NewPhoneRule(s.Action)
+	case "url":
+		rule, _ = NewURLRule(s.Action)
+	default:
+		return Rule{}, fmt.Errorf("rule %s: cannot detect %q, only phone or url", s.Name, s.Detect)
+	}
+	// the built in rules keep their message unless the file gives one
+	rule.Name = s.Name
+	if s.Message != "" {
+		rule.Message = s.Message
+	}
+	return rule, nil
+}
@@ -0,0 +1,162 @@
+package database
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/teojiahao/HireMe/pkg/metrics"
+	"github.com/teojiahao/HireMe/pkg/queue"
+)
+
+// layout of a DATETIME(3) column when the DSN does not set parseTime
+const sqlTimeLayout = "2006-01-02 15:04:05.999"
+
+// sqlTime scans a DATETIME column whether or not parseTime is set on the DSN
+type sqlTime struct {
+	time.Time
+}
+
+// Scan implements sql.Scanner
+func (t *sqlTime) Scan(value interface{}) error {
+	switch v := value.(type) {
+	case time.Time:
+		t.Time = v
+	case []byte:
+		parsed, err := time.ParseInLocation(sqlTimeLayout, string(v), time.UTC)
+		if err != nil {
+			return err
+		}
+		t.Time = parsed
+	case nil:
+		t.Time = time.Time{}
+	default:
+		return fmt.Errorf("cannot scan %T into time", value)
+	}
+	return nil
+}
+
+// format the time for a DATETIME(3) column
+func formatTime(t time.Time) string {
+	return t.UTC().Format(sqlTimeLayout)
+}
+
+// ActivityStore keeps the user activity history in the Activity table so it survive a restart
+type ActivityStore struct {
+	db        *DB
+	Retention queue.Retention
+}
+
+// NewActivityStore return an ActivityStore using the retention given
+func NewActivityStore(db *DB, retention queue.Retention) *ActivityStore {
+	return &ActivityStore{db: db, Retention: retention}
+}
+
+// Add insert the history and drop whatever is over the retention limit
+func (a *ActivityStore) Add(username string, h queue.History) error {
+	defer metrics.ObserveQuery("activity_add")()
+	db := a.db.pool
+
+	payload, err := json.Marshal(h.Payload)
+	if err != nil {
+		return err
+	}
+
+	_, err = db.Exec("INSERT INTO Activity (Username, Kind, Time, IP, UserAgent, Payload) VALUES (?, ?, ?, ?, ?, ?)",
+		username, string(h.Kind), formatTime(h.Time), h.IP, truncate(h.UserAgent, 255), payload)
+	if err != nil {
+		return err
+	}
+
+	// keep only the newest entries, the derived table is needed as MySQL cannot LIMIT inside IN
+	_, err = db.Exec(`DELETE FROM Activity WHERE Username=? AND ID NOT IN (
+		SELECT ID FROM (SELECT ID FROM Activity WHERE Username=? ORDER BY ID DESC LIMIT ?) newest)`,
+		username, username, a.Retention.Entries())
+	if err != nil {
+		return err
+	}
+
+	if a.Retention.MaxAge > 0 {
+		_, err = db.Exec("DELETE FROM Activity WHERE Username=? AND Time < ?",
+			username, formatTime(time.Now().Add(-a.Retention.MaxAge)))
+	}
+	return err
+}
+
+// Search return the newest matching history first, skipping offset of them, and the total number of matches
+func (a *ActivityStore) Search(username string, q queue.Query, offset, limit int) ([]queue.History, int, error) {
+	defer metrics.ObserveQuery("activity_search")()
+	db := a.db.pool
+
+	where := []string{"Username=?"}
+	args := []interface{}{username}
+	if len(q.Kinds) > 0 {
+		where = append(where, "Kind IN (?"+strings.Repeat(", ?", len(q.Kinds)-1)+")")
+		for _, k := range q.Kinds {
+			args = append(args, string(k))
+		}
+	}
+	if !q.From.IsZero() {
+		where = append(where, "Time >= ?")
+		args = append(args, formatTime(q.From))
+	}
+	if !q.To.IsZero() {
+		where = append(where, "Time <= ?")
+		args = append(args, formatTime(q.To))
+	}
+	if q.Text != "" {
+		like := "%" + strings.ToLower(q.Text) + "%"
+		where = append(where, "(LOWER(Payload) LIKE ? OR LOWER(IP) LIKE ? OR LOWER(UserAgent) LIKE ?)")
+		args = append(args, like, like, like)
+	}
+	if a.Retention.MaxAge > 0 {
+		where = append(where, "Time >= ?")
+		args = append(args, formatTime(time.Now().Add(-a.Retention.MaxAge)))
+	}
+	condition := strings.Join(where, " AND ")
+
+	var total int
+	err := db.QueryRow("SELECT COUNT(*) FROM Activity WHERE "+condition, args...).Scan(&total)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	if limit <= 0 {
+		limit = total
+	}
+	results, err := db.Query("SELECT Kind, Time, IP, UserAgent, Payload FROM Activity WHERE "+condition+" ORDER BY ID DESC LIMIT ? OFFSET ?",
+		append(args, limit, offset)...)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer results.Close()
+
+	history := []queue.History{}
+	for results.Next() {
+		var h queue.History
+		var kind string
+		var when sqlTime
+		var payload []byte
+		if err := results.Scan(&kind, &when, &h.IP, &h.UserAgent, &payload); err != nil {
+			return nil, 0, err
+		}
+		h.Kind = queue.Kind(kind)
+		h.Time = when.Time
+		if len(payload) > 0 {
+			if err := json.Unmarshal(payload, &h.Payload); err != nil {
+				return nil, 0, err
+			}
+		}
+		history = append(history, h)
+	}
+	return history, total, results.Err()
+}
+
+// cut the string to fit a VARCHAR column
+func truncate(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+	return s[:n]
+}
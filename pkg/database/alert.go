@@ -0,0 +1,76 @@
+package database
+
+import (
+	"fmt"
+
+	"github.com/teojiahao/HireMe/pkg/alert"
+	"github.com/teojiahao/HireMe/pkg/metrics"
+	"github.com/teojiahao/HireMe/pkg/queue"
+)
+
+// how many pending alerts are shown to the user
+const pendingAlerts = 50
+
+// AlertStore keeps the alerts in the Alerts table for the user to review
+type AlertStore struct {
+	db *DB
+}
+
+// NewAlertStore return an AlertStore
+func NewAlertStore(db *DB) *AlertStore {
+	return &AlertStore{db: db}
+}
+
+// Notify insert the alert
+func (s *AlertStore) Notify(a alert.Alert) error {
+	defer metrics.ObserveQuery("alert_notify")()
+	db := s.db.pool
+
+	_, err := db.Exec("INSERT INTO Alerts (ID, Username, Reason, Time, IP, UserAgent, Confirmed) VALUES (?, ?, ?, ?, ?, ?, ?)",
+		a.ID, a.Username, string(a.Reason), formatTime(a.Event.Time), a.Event.IP, truncate(a.Event.UserAgent, 255), a.Confirmed)
+	return err
+}
+
+// Pending return the alerts the user has not confirmed, newest first
+func (s *AlertStore) Pending(username string) ([]alert.Alert, error) {
+	defer metrics.ObserveQuery("alert_pending")()
+	db := s.db.pool
+
+	results, err := db.Query("SELECT ID, Reason, Time, IP, UserAgent FROM Alerts WHERE Username=? AND Confirmed=FALSE ORDER BY Time DESC LIMIT ?", username, pendingAlerts)
+	if err != nil {
+		return nil, err
+	}
+	defer results.Close()
+
+	alerts := []alert.Alert{}
+	for results.Next() {
+		a := alert.Alert{Username: username, Event: queue.History{Kind: queue.LoginSuccess}}
+		var reason string
+		var when sqlTime
+		if err := results.Scan(&a.ID, &reason, &when, &a.Event.IP, &a.Event.UserAgent); err != nil {
+			return nil, err
+		}
+		a.Reason = alert.Reason(reason)
+		a.Event.Time = when.Time
+		if a.Reason == alert.RepeatedFailures {
+			a.Event.Kind = queue.LoginFailure
+		}
+		alerts = append(alerts, a)
+	}
+	return alerts, results.Err()
+}
+
+// Confirm marks the alert as done by the user
+func (s *AlertStore) Confirm(username, id string) error {
+	defer metrics.ObserveQuery("alert_confirm")()
+	db := s.db.pool
+
+	result, err := db.Exec("UPDATE Alerts SET Confirmed=TRUE WHERE Username=? AND ID=?", username, id)
+	if err != nil {
+		return err
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return fmt.Errorf("alert not found")
+	}
+	return nil
+}
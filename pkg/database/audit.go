@@ -0,0 +1,170 @@
+package database
+
+import (
+	"database/sql"
+	"encoding/json"
+	"strings"
+
+	"github.com/go-sql-driver/mysql"
+	"github.com/teojiahao/HireMe/pkg/audit"
+	"github.com/teojiahao/HireMe/pkg/metrics"
+)
+
+// MySQL error number of a duplicate primary key
+const errDuplicateEntry = 1062
+
+// AuditStore keeps the audit log in the AuditLog table, it only ever inserts and selects
+// so the database user can be denied UPDATE and DELETE on it
+type AuditStore struct {
+	db *DB
+}
+
+// NewAuditStore return an AuditStore
+func NewAuditStore(db *DB) *AuditStore {
+	return &AuditStore{db: db}
+}
+
+const auditColumns = "Seq, Time, Actor, Action, Target, Changes, IP, PrevHash, Hash"
+
+func scanAudit(scanner interface{ Scan(...interface{}) error }) (audit.Entry, error) {
+	var e audit.Entry
+	var when sqlTime
+	var action string
+	var changes []byte
+	err := scanner.Scan(&e.Seq, &when, &e.Actor, &action, &e.Target, &changes, &e.IP, &e.PrevHash, &e.Hash)
+	if err != nil {
+		return audit.Entry{}, err
+	}
+	e.Time = when.Time
+	e.Action = audit.Action(action)
+	if len(changes) > 0 {
+		if err := json.Unmarshal(changes, &e.Changes); err != nil {
+			return audit.Entry{}, err
+		}
+	}
+	return e, nil
+}
+
+// Last return the entry with the highest Seq, the zero Entry when there is none
+func (s *AuditStore) Last() (audit.Entry, error) {
+	defer metrics.ObserveQuery("audit_last")()
+	db := s.db.pool
+
+	e, err := scanAudit(db.QueryRow("SELECT " + auditColumns + " FROM AuditLog ORDER BY Seq DESC LIMIT 1"))
+	if err == sql.ErrNoRows {
+		return audit.Entry{}, nil
+	}
+	return e, err
+}
+
+// Insert adds the entry, audit.ErrConflict when another instance took the Seq first
+func (s *AuditStore) Insert(e audit.Entry) error {
+	defer metrics.ObserveQuery("audit_insert")()
+	db := s.db.pool
+
+	changes, err := json.Marshal(e.Changes)
+	if err != nil {
+		return err
+	}
+	_, err = db.Exec("INSERT INTO AuditLog ("+auditColumns+") VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)",
+		e.Seq, formatTime(e.Time), e.Actor, string(e.Action), e.Target, changes, e.IP, e.PrevHash, e.Hash)
+	if mysqlErr, ok := err.(*mysql.MySQLError); ok && mysqlErr.Number == errDuplicateEntry {
+		return audit.ErrConflict
+	}
+	return err
+}
+
+// Search return the newest matching entries first, skipping offset of them, and the total number of matches
+func (s *AuditStore) Search(q audit.Query, offset, limit int) ([]audit.Entry, int, error) {
+	defer metrics.ObserveQuery("audit_search")()
+	db := s.db.pool
+
+	where := []string{"TRUE"}
+	args := []interface{}{}
+	if q.Actor != "" {
+		where = append(where, "Actor=?")
+		args = append(args, q.Actor)
+	}
+	if q.Target != "" {
+		where = append(where, "Target=?")
+		args = append(args, q.Target)
+	}
+	if len(q.Actions) > 0 {
+		where = append(where, "Action IN (?"+strings.Repeat(", ?", len(q.Actions)-1)+")")
+		for _, a := range q.Actions {
+			args = append(args, string(a))
+		}
+	}
+	if !q.From.IsZero() {
+		where = append(where, "Time >= ?")
+		args = append(args, formatTime(q.From))
+	}
+	if !q.To.IsZero() {
+		where = append(where, "Time <= ?")
+		args = append(args, formatTime(q.To))
+	}
+	condition := strings.Join(where, " AND ")
+
+	var total int
+	err := db.QueryRow("SELECT COUNT(*) FROM AuditLog WHERE "+condition, args...).Scan(&total)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	if limit <= 0 {
+		limit = total
+	}
+	results, err := db.Query("SELECT "+auditColumns+" FROM AuditLog WHERE "+condition+" ORDER BY Seq DESC LIMIT ? OFFSET ?",
+		append(args, limit, offset)...)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer results.Close()
+
+	entries := []audit.Entry{}
+	for results.Next() {
+		e, err := scanAudit(results)
+		if err != nil {
+			return nil, 0, err
+		}
+		entries = append(entries, e)
+	}
+	return entries, total, results.Err()
+}
+
+// Walk calls fn with every entry from the oldest, reading a batch at a time
+func (s *AuditStore) Walk(fn func(e audit.Entry) error) error {
+	defer metrics.ObserveQuery("audit_walk")()
+	db := s.db.pool
+
+	last := int64(0)
+	for {
+		results, err := db.Query("SELECT "+auditColumns+" FROM AuditLog WHERE Seq > ? ORDER BY Seq LIMIT 500", last)
+		if err != nil {
+			return err
+		}
+		batch := []audit.Entry{}
+		for results.Next() {
+			e, err := scanAudit(results)
+			if err != nil {
+				results.Close()
+				return err
+			}
+			batch = append(batch, e)
+		}
+		results.Close()
+		if err := results.Err(); err != nil {
+			return err
+		}
+		if len(batch) == 0 {
+			return nil
+		}
+
+		for _, e := range batch {
+			if err := fn(e); err != nil {
+				return err
+			}
+			last = e.Seq
+		}
+	}
+}
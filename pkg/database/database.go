@@ -2,14 +2,19 @@
 package database
 
 import (
+	"context"
 	"database/sql"
 	"fmt"
 	"log"
-	"os"
 	"strings"
 	"sync"
+	"time"
 
+	"github.com/teojiahao/HireMe/pkg/config"
+	"github.com/teojiahao/HireMe/pkg/metrics"
 	"github.com/teojiahao/HireMe/pkg/security"
+	"github.com/teojiahao/HireMe/pkg/tracing"
+	"go.opentelemetry.io/otel/attribute"
 )
 
 // User struct for db
@@ -26,6 +31,10 @@ type User struct {
 	Message        string
 	Email          string
 	AccessKey      []byte
+	// Disabled users cannot log in and their key is refused
+	Disabled bool
+	// Hidden profiles were taken off the map by a moderator
+	Hidden bool
 }
 
 // UserJSON for RESTAPI
@@ -39,30 +48,81 @@ type UserJSON struct {
 	UnemployedDate string
 	Message        string
 	Email          string
+	// JobTypes, Categories and Skills are what the user picked, the api fills them
+	JobTypes   []string
+	Categories []string
+	Skills     []string
 }
 
-// OpenSQL return a opened db
-func OpenSQL() *sql.DB {
-	db, err := sql.Open("mysql", os.Getenv("DATABASE_IP"))
+// columns of Users in the order scanUser reads them
+const userColumns = "Username, Pass, Display, CoordX, CoordY, JobType, Skill, Exp, UnemployedDate, Message, Email, AccessKey, Disabled, Hidden"
 
+// scanUser reads a row of userColumns
+func scanUser(row interface{ Scan(...interface{}) error }) (User, error) {
+	var user User
+	err := row.Scan(&user.Username, &user.Password, &user.Display, &user.CoordX, &user.CoordY, &user.JobType, &user.Skill, &user.Exp, &user.UnemployedDate, &user.Message, &user.Email, &user.AccessKey, &user.Disabled, &user.Hidden)
+	return user, err
+}
+
+// DB is the connection pool every query and store goes through, the keyring
+// seals and opens the secrets in the rows
+type DB struct {
+	pool    *sql.DB
+	keyring *security.Keyring
+}
+
+// Open opens the connection pool, it is closed by Close once nothing uses it anymore
+func Open(c config.Database, keyring *security.Keyring) (*DB, error) {
+	if keyring == nil {
+		return nil, security.ErrNoKeyring
+	}
+	db, err := sql.Open("mysql", c.DSN)
 	if err != nil {
-		log.Panic(err.Error())
-	} /*else {
-		fmt.Println("Database opened!")
-	}*/
-	return db
+		return nil, err
+	}
+	db.SetMaxOpenConns(c.MaxOpenConns)
+	db.SetMaxIdleConns(c.MaxIdleConns)
+	db.SetConnMaxLifetime(time.Duration(c.ConnMaxLifetimeMinutes) * time.Minute)
+	metrics.RegisterDB(db)
+	return &DB{pool: db, keyring: keyring}, nil
+}
+
+// Ping checks that the database can be reached
+func (d *DB) Ping(ctx context.Context) error {
+	return d.pool.PingContext(ctx)
+}
+
+// Close closes the pool once the server stopped using it
+func (d *DB) Close() error {
+	return d.pool.Close()
+}
+
+// observe times the query by name and traces it when done during a request, call the
+// func it returns once the rows are read
+func observe(ctx context.Context, name string) (context.Context, func()) {
+	done := metrics.ObserveQuery(name)
+	// some of the queries panic on error, a client going away should not cancel them
+	ctx, span := tracing.StartChild(context.WithoutCancel(ctx), "db "+name,
+		attribute.String("db.system.name", "mysql"),
+		attribute.String("db.operation.name", name),
+	)
+	return ctx, func() {
+		span.End()
+		done()
+	}
 }
 
 // InsertUser takes in the username, password and key and store into db
-func InsertUser(username string, pass []byte, key []byte, errChan chan error) {
+func (d *DB) InsertUser(ctx context.Context, username string, pass []byte, key []byte, errChan chan error) {
 	var mutex sync.Mutex
-	db := OpenSQL()
-	defer db.Close()
-	query := `INSERT INTO Users VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`
+	ctx, done := observe(ctx, "insert_user")
+	defer done()
+	db := d.pool
+	query := "INSERT INTO Users (" + userColumns + ") VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)"
 	mutex.Lock()
 	defer mutex.Unlock()
-	statement, _ := db.Prepare(query)
-	_, err := statement.Exec(username, pass, "No", 0, 0, "", "", 0, "", "", "", key)
+	statement, _ := db.PrepareContext(ctx, query)
+	_, err := statement.ExecContext(ctx, username, pass, "No", 0, 0, "", "", 0, "", "", "", key, false, false)
 	if err != nil {
 		errChan <- fmt.Errorf("409 - Duplicate Username")
 		return
@@ -71,31 +131,44 @@ func InsertUser(username string, pass []byte, key []byte, errChan chan error) {
 }
 
 // UpdateUser takes in the username, password and key and store into db
-func UpdateUser(username string, display string, coordX, coordY float64, jobType string, skill string, exp int, unemployedDate string, message string, email string) {
-	db := OpenSQL()
-	defer db.Close()
-	query := fmt.Sprintf("UPDATE Users SET Display='%s', CoordX='%v', CoordY='%v', JobType='%s', Skill='%s', Exp='%v', UnemployedDate='%s', Message='%s', Email='%s' WHERE Username=?", display, coordX, coordY, jobType, skill, exp, unemployedDate, message, email)
+func (d *DB) UpdateUser(ctx context.Context, username string, display string, coordX, coordY float64, jobType string, skill string, exp int, unemployedDate string, message string, email string) {
+	ctx, done := observe(ctx, "update_user")
+	defer done()
+	db := d.pool
+	// an email can have a ' so the values cannot be put in the query itself
+	query := "UPDATE Users SET Display=?, CoordX=?, CoordY=?, JobType=?, Skill=?, Exp=?, UnemployedDate=?, Message=?, Email=? WHERE Username=?"
 
-	_, err := db.Query(query, username)
+	_, err := db.ExecContext(ctx, query, display, coordX, coordY, jobType, skill, exp, unemployedDate, message, email, username)
 
 	if err != nil {
 		log.Panic(fmt.Sprintf("%s", err.Error()))
 	}
 }
 
+// UpdatePassword replace the password hash of the user
+func (d *DB) UpdatePassword(ctx context.Context, username string, pass []byte) error {
+	ctx, done := observe(ctx, "update_password")
+	defer done()
+	db := d.pool
+
+	_, err := db.ExecContext(ctx, "UPDATE Users SET Pass=? WHERE Username=?", pass, username)
+	return err
+}
+
 // GetAllUser get all the users details in db and return back a map of user
-func GetAllUser() map[string]User {
-	db := OpenSQL()
-	defer db.Close()
-	results, err := db.Query("Select * from my_db.Users")
+func (d *DB) GetAllUser(ctx context.Context) map[string]User {
+	ctx, done := observe(ctx, "get_all_user")
+	defer done()
+	db := d.pool
+	results, err := db.QueryContext(ctx, "Select "+userColumns+" from my_db.Users")
 	users := map[string]User{}
 
 	if err != nil {
 		log.Panic(fmt.Sprintf("%s", err.Error()))
 	}
+	defer results.Close()
 	for results.Next() {
-		var user User
-		err := results.Scan(&user.Username, &user.Password, &user.Display, &user.CoordX, &user.CoordY, &user.JobType, &user.Skill, &user.Exp, &user.UnemployedDate, &user.Message, &user.Email, &user.AccessKey)
+		user, err := scanUser(results)
 		if err != nil {
 			panic(err.Error)
 		}
@@ -105,52 +178,109 @@ func GetAllUser() map[string]User {
 }
 
 // UserInfoJSON get all the users details in db and return back a map of user
-func UserInfoJSON() map[string]UserJSON {
-	db := OpenSQL()
-	defer db.Close()
-	results, err := db.Query("Select * from my_db.Users")
+func (d *DB) UserInfoJSON(ctx context.Context) map[string]UserJSON {
+	ctx, done := observe(ctx, "user_info_json")
+	defer done()
+	db := d.pool
+	results, err := db.QueryContext(ctx, "Select "+userColumns+" from my_db.Users WHERE Disabled=FALSE AND Hidden=FALSE")
 	users := map[string]UserJSON{}
 
 	if err != nil {
 		log.Panic(fmt.Sprintf("%s", err.Error()))
 	}
+	defer results.Close()
 	for results.Next() {
-		var user User
-		err := results.Scan(&user.Username, &user.Password, &user.Display, &user.CoordX, &user.CoordY, &user.JobType, &user.Skill, &user.Exp, &user.UnemployedDate, &user.Message, &user.Email, &user.AccessKey)
+		user, err := scanUser(results)
 		if err != nil {
 			log.Panic(fmt.Sprintf("%s", err.Error()))
 		}
 		if user.Display == "Yes" {
-			users[user.Username] = UserJSON{user.Username, user.CoordX, user.CoordY, user.JobType, user.Skill, user.Exp, user.UnemployedDate, user.Message, user.Email}
+			users[user.Username] = UserJSON{Username: user.Username, CoordX: user.CoordX, CoordY: user.CoordY, JobType: user.JobType, Skill: user.Skill,
+				Exp: user.Exp, UnemployedDate: user.UnemployedDate, Message: user.Message, Email: user.Email}
 		}
 	}
 	return users
 }
 
 // CheckAPIKey checks whether the key exist in the db
-func CheckAPIKey(key string) bool {
-	db := OpenSQL()
-	defer db.Close()
-	results, err := db.Query("Select * from my_db.Users")
+func (d *DB) CheckAPIKey(ctx context.Context, key string) bool {
+	_, ok := d.UserFromAPIKey(ctx, key)
+	return ok
+}
+
+// UserFromAPIKey return the username the key belongs to
+func (d *DB) UserFromAPIKey(ctx context.Context, key string) (string, bool) {
+	ctx, done := observe(ctx, "user_from_api_key")
+	defer done()
+	if key == "" {
+		return "", false
+	}
+	db := d.pool
+	// a revoked key is NULL, it never decrypts to the key given
+	results, err := db.QueryContext(ctx, "Select "+userColumns+" from my_db.Users WHERE Disabled=FALSE AND AccessKey IS NOT NULL")
 
 	if err != nil {
 		panic(err.Error)
 	}
+	defer results.Close()
 
 	// check if the user key is inside db
 	for results.Next() {
-		var user User
-		err := results.Scan(&user.Username, &user.Password, &user.Display, &user.CoordX, &user.CoordY, &user.JobType, &user.Skill, &user.Exp, &user.UnemployedDate, &user.Message, &user.Email, &user.AccessKey)
+		user, err := scanUser(results)
 		if err != nil {
 			panic(err.Error)
 		}
 
-		decryptedKey, _ := security.Decrypt(user.AccessKey, "")
+		decryptedKey, err := d.keyring.Decrypt(user.AccessKey)
+		if err != nil {
+			continue
+		}
 
 		if strings.Compare(string(decryptedKey), key) == 0 {
-			return true
+			return user.Username, true
 		}
 	}
-	log.Println("Invalid Accesskey:", key)
-	return false
+	return "", false
+}
+
+// CheckUserAPIKey checks whether the key belongs to the user
+func (d *DB) CheckUserAPIKey(ctx context.Context, username, key string) bool {
+	ctx, done := observe(ctx, "check_user_api_key")
+	defer done()
+	db := d.pool
+
+	var accessKey []byte
+	err := db.QueryRowContext(ctx, "Select AccessKey from my_db.Users WHERE Username=? AND Disabled=FALSE", username).Scan(&accessKey)
+	if err != nil {
+		return false
+	}
+
+	decryptedKey, err := d.keyring.Decrypt(accessKey)
+	if err != nil {
+		return false
+	}
+	return key != "" && strings.Compare(string(decryptedKey), key) == 0
+}
+
+// UserExists checks if there is an account with the username, disabled ones included
+func (d *DB) UserExists(username string) bool {
+	defer metrics.ObserveQuery("user_exists")()
+	db := d.pool
+
+	var found int
+	err := db.QueryRow("Select 1 from my_db.Users WHERE Username=?", username).Scan(&found)
+	return err == nil
+}
+
+// UserEmail return the email the user gave in the profile, empty when there is none
+func (d *DB) UserEmail(username string) string {
+	defer metrics.ObserveQuery("user_email")()
+	db := d.pool
+
+	var email string
+	err := db.QueryRow("Select Email from my_db.Users WHERE Username=?", username).Scan(&email)
+	if err != nil {
+		return ""
+	}
+	return email
 }
@@ -0,0 +1,160 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+)
+
+// Migration is a change to the schema, applied once in the order of the versions
+type Migration struct {
+	Version    int
+	Name       string
+	Statements []string
+}
+
+// Migrations bring an empty database, or one made by hand from the README before, to the
+// schema the server needs. New ones are only ever appended.
+var Migrations = []Migration{
+	{1, "create tables", []string{
+		`CREATE TABLE IF NOT EXISTS Users (Username VARCHAR(30) NOT NULL PRIMARY KEY, Pass varbinary(255), Display VARCHAR(10), CoordX DECIMAL(20,10), CoordY DECIMAL(20,10), JobType VARCHAR(200), Skill VARCHAR(2000), Exp INT, UnemployedDate VARCHAR(20), Message VARCHAR(50), Email VARCHAR(254), AccessKey varbinary(255))`,
+		`CREATE TABLE IF NOT EXISTS Activity (ID BIGINT NOT NULL AUTO_INCREMENT PRIMARY KEY, Username VARCHAR(30) NOT NULL, Kind VARCHAR(32) NOT NULL, Time DATETIME(3) NOT NULL, IP VARCHAR(45), UserAgent VARCHAR(255), Payload TEXT, INDEX (Username, Time))`,
+		`CREATE TABLE IF NOT EXISTS Alerts (ID VARCHAR(36) NOT NULL PRIMARY KEY, Username VARCHAR(30) NOT NULL, Reason VARCHAR(32) NOT NULL, Time DATETIME(3) NOT NULL, IP VARCHAR(45), UserAgent VARCHAR(255), Confirmed BOOLEAN NOT NULL DEFAULT FALSE, INDEX (Username, Confirmed))`,
+		`CREATE TABLE IF NOT EXISTS LoginAttempts (ThrottleKey VARCHAR(100) NOT NULL PRIMARY KEY, Failures INT NOT NULL, Last DATETIME(3) NOT NULL, Until DATETIME(3) NOT NULL)`,
+		`CREATE TABLE IF NOT EXISTS TwoFactor (Username VARCHAR(30) NOT NULL PRIMARY KEY, Secret varbinary(255) NOT NULL, Enabled BOOLEAN NOT NULL DEFAULT FALSE, LastStep BIGINT NOT NULL DEFAULT 0, RecoveryCodes TEXT)`,
+		`CREATE TABLE IF NOT EXISTS AuditLog (Seq BIGINT NOT NULL PRIMARY KEY, Time DATETIME(3) NOT NULL, Actor VARCHAR(30) NOT NULL, Action VARCHAR(32) NOT NULL, Target VARCHAR(64) NOT NULL, Changes TEXT, IP VARCHAR(45), PrevHash CHAR(64) NOT NULL, Hash CHAR(64) NOT NULL, INDEX (Actor), INDEX (Target), INDEX (Time))`,
+	}},
+	// databases made before the disposable email check had a shorter column
+	{2, "widen user email", []string{
+		`ALTER TABLE Users MODIFY Email VARCHAR(254)`,
+	}},
+	{3, "add user disabled", []string{
+		`ALTER TABLE Users ADD COLUMN Disabled BOOLEAN NOT NULL DEFAULT FALSE`,
+	}},
+	{4, "add reports and hidden profiles", []string{
+		`CREATE TABLE IF NOT EXISTS Reports (ID VARCHAR(36) NOT NULL PRIMARY KEY, Target VARCHAR(30) NOT NULL, Reporter VARCHAR(30) NOT NULL, Reason VARCHAR(32) NOT NULL, Details VARCHAR(500), Time DATETIME(3) NOT NULL, Outcome VARCHAR(16) NOT NULL DEFAULT '', ResolvedBy VARCHAR(30) NOT NULL DEFAULT '', ResolvedAt DATETIME(3), INDEX (Target, Outcome), INDEX (Reporter))`,
+		// a profile hidden by a moderator stays off the map whatever the user picks
+		`ALTER TABLE Users ADD COLUMN Hidden BOOLEAN NOT NULL DEFAULT FALSE`,
+	}},
+	// the content policy decides how long the message can be, up to content.ColumnLength
+	{5, "widen user message", []string{
+		`ALTER TABLE Users MODIFY Message VARCHAR(500)`,
+	}},
+	// the job types and categories picked were kept joined with ", " and a name can hold a comma,
+	// linkUserTaxonomy moves them to the link tables, JobType and Skill stay as the text last saved
+	{6, "add job taxonomy", append([]string{
+		`CREATE TABLE IF NOT EXISTS JobTypes (ID INT NOT NULL AUTO_INCREMENT PRIMARY KEY, Name VARCHAR(100) NOT NULL UNIQUE)`,
+		`CREATE TABLE IF NOT EXISTS Categories (ID INT NOT NULL AUTO_INCREMENT PRIMARY KEY, Name VARCHAR(100) NOT NULL UNIQUE)`,
+		`CREATE TABLE IF NOT EXISTS Skills (ID INT NOT NULL AUTO_INCREMENT PRIMARY KEY, CategoryID INT NOT NULL, Name VARCHAR(100) NOT NULL UNIQUE, INDEX (CategoryID))`,
+		`CREATE TABLE IF NOT EXISTS UserJobTypes (Username VARCHAR(30) NOT NULL, JobTypeID INT NOT NULL, PRIMARY KEY (Username, JobTypeID), INDEX (JobTypeID))`,
+		`CREATE TABLE IF NOT EXISTS UserCategories (Username VARCHAR(30) NOT NULL, CategoryID INT NOT NULL, PRIMARY KEY (Username, CategoryID), INDEX (CategoryID))`,
+		`CREATE TABLE IF NOT EXISTS UserSkills (Username VARCHAR(30) NOT NULL, SkillID INT NOT NULL, PRIMARY KEY (Username, SkillID), INDEX (SkillID))`,
+		`ALTER TABLE Users MODIFY JobType VARCHAR(2000)`,
+	}, taxonomyDefaults()...)},
+}
+
+// dataSteps move the rows a migration needs moved, once its statements ran. They can run
+// again if the migration stopped half way.
+var dataSteps = map[int]func(ctx context.Context, conn *sql.Conn) error{
+	6: linkUserTaxonomy,
+}
+
+// AppliedMigration is a migration done and when
+type AppliedMigration struct {
+	Migration
+	Applied time.Time
+}
+
+// appliedVersions return when each version was applied, nothing when migrate never ran
+func (d *DB) appliedVersions(ctx context.Context) (map[int]time.Time, error) {
+	db := d.pool
+
+	var tables int
+	err := db.QueryRowContext(ctx, "SELECT COUNT(*) FROM information_schema.tables WHERE table_schema=DATABASE() AND table_name='SchemaMigrations'").Scan(&tables)
+	if err != nil || tables == 0 {
+		return map[int]time.Time{}, err
+	}
+
+	results, err := db.QueryContext(ctx, "SELECT Version, Applied FROM SchemaMigrations")
+	if err != nil {
+		return nil, err
+	}
+	defer results.Close()
+	applied := map[int]time.Time{}
+	for results.Next() {
+		var version int
+		var at sqlTime
+		if err := results.Scan(&version, &at); err != nil {
+			return nil, err
+		}
+		applied[version] = at.Time
+	}
+	return applied, results.Err()
+}
+
+// MigrationStatus return the migrations applied, with their time, and the ones pending
+func (d *DB) MigrationStatus(ctx context.Context) ([]AppliedMigration, []Migration, error) {
+	applied, err := d.appliedVersions(ctx)
+	if err != nil {
+		return nil, nil, err
+	}
+	done := []AppliedMigration{}
+	pending := []Migration{}
+	for _, m := range Migrations {
+		if at, ok := applied[m.Version]; ok {
+			done = append(done, AppliedMigration{m, at})
+		} else {
+			pending = append(pending, m)
+		}
+	}
+	return done, pending, nil
+}
+
+// Migrate applies the pending migrations in order and return the ones it applied. A lock
+// in the database keeps two instances from migrating at the same time.
+func (d *DB) Migrate(ctx context.Context) ([]Migration, error) {
+	conn, err := d.pool.Conn(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	var locked int
+	if err := conn.QueryRowContext(ctx, "SELECT GET_LOCK('hireme_migrate', 30)").Scan(&locked); err != nil {
+		return nil, err
+	}
+	if locked != 1 {
+		return nil, fmt.Errorf("another migration is running")
+	}
+	defer conn.ExecContext(context.WithoutCancel(ctx), "SELECT RELEASE_LOCK('hireme_migrate')")
+
+	if _, err := conn.ExecContext(ctx, "CREATE TABLE IF NOT EXISTS SchemaMigrations (Version INT NOT NULL PRIMARY KEY, Name VARCHAR(100) NOT NULL, Applied DATETIME(3) NOT NULL)"); err != nil {
+		return nil, err
+	}
+	_, pending, err := d.MigrationStatus(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	done := []Migration{}
+	for _, m := range pending {
+		// MySQL commits every schema change on its own, so a migration is recorded once all its statements ran
+		for _, statement := range m.Statements {
+			if _, err := conn.ExecContext(ctx, statement); err != nil {
+				return done, fmt.Errorf("migration %d %s: %w", m.Version, m.Name, err)
+			}
+		}
+		if step, ok := dataSteps[m.Version]; ok {
+			if err := step(ctx, conn); err != nil {
+				return done, fmt.Errorf("migration %d %s: %w", m.Version, m.Name, err)
+			}
+		}
+		if _, err := conn.ExecContext(ctx, "INSERT INTO SchemaMigrations (Version, Name, Applied) VALUES (?, ?, ?)",
+			m.Version, m.Name, formatTime(time.Now())); err != nil {
+			return done, err
+		}
+		done = append(done, m)
+	}
+	return done, nil
+}
@@ -0,0 +1,184 @@
+package database
+
+import (
+	"database/sql"
+	"time"
+
+	"github.com/teojiahao/HireMe/pkg/metrics"
+	"github.com/teojiahao/HireMe/pkg/report"
+)
+
+// ReportStore keeps the reported profiles in the Reports table so every instance shares the queue
+type ReportStore struct {
+	db *DB
+}
+
+// NewReportStore return a ReportStore
+func NewReportStore(db *DB) *ReportStore {
+	return &ReportStore{db: db}
+}
+
+// Add insert the report unless the reporter has an open report on the profile. The row of
+// the profile in Users is locked until the insert is done so the reports of a profile are
+// filed one at a time and each sees the reports filed before it.
+func (s *ReportStore) Add(r report.Report) ([]report.Report, error) {
+	defer metrics.ObserveQuery("report_add")()
+	db := s.db.pool
+
+	tx, err := db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	var username string
+	if err := tx.QueryRow("SELECT Username FROM Users WHERE Username=? FOR UPDATE", r.Target).Scan(&username); err != nil && err != sql.ErrNoRows {
+		return nil, err
+	}
+	open, err := openReports(tx, r.Target)
+	if err != nil {
+		return nil, err
+	}
+	for _, o := range open {
+		if o.Reporter == r.Reporter {
+			return nil, report.ErrAlreadyReported
+		}
+	}
+
+	if _, err := tx.Exec("INSERT INTO Reports (ID, Target, Reporter, Reason, Details, Time, Outcome, ResolvedBy) VALUES (?, ?, ?, ?, ?, ?, ?, ?)",
+		r.ID, r.Target, r.Reporter, string(r.Reason), truncate(r.Details, 500), formatTime(r.Time), string(r.Outcome), r.ResolvedBy); err != nil {
+		return nil, err
+	}
+	return append(open, r), tx.Commit()
+}
+
+// Cases return a page of the cases in the order of report.Group and the total number of cases
+func (s *ReportStore) Cases(offset, limit int) ([]report.Case, int, error) {
+	defer metrics.ObserveQuery("report_cases")()
+	db := s.db.pool
+
+	var total int
+	if err := db.QueryRow("SELECT COUNT(DISTINCT Target) FROM Reports WHERE Outcome=''").Scan(&total); err != nil {
+		return nil, 0, err
+	}
+	if limit <= 0 {
+		limit = total
+	}
+
+	results, err := db.Query(`SELECT Target FROM Reports WHERE Outcome='' GROUP BY Target
+		ORDER BY COUNT(DISTINCT IF(Reason=?, NULL, Reporter)) DESC, MIN(Time) LIMIT ? OFFSET ?`, string(report.Flagged), limit, offset)
+	if err != nil {
+		return nil, 0, err
+	}
+	targets := []string{}
+	for results.Next() {
+		var target string
+		if err := results.Scan(&target); err != nil {
+			results.Close()
+			return nil, 0, err
+		}
+		targets = append(targets, target)
+	}
+	results.Close()
+	if err := results.Err(); err != nil {
+		return nil, 0, err
+	}
+
+	cases := []report.Case{}
+	for _, target := range targets {
+		open, err := s.Open(target)
+		if err != nil {
+			return nil, 0, err
+		}
+		if len(open) > 0 {
+			cases = append(cases, report.Case{Target: target, Reports: open})
+		}
+	}
+	return cases, total, nil
+}
+
+// Open return the open reports of the profile, oldest first
+func (s *ReportStore) Open(target string) ([]report.Report, error) {
+	defer metrics.ObserveQuery("report_open")()
+	return openReports(s.db.pool, target)
+}
+
+// openReports reads the open reports of the profile, oldest first, in or out of a transaction
+func openReports(db interface {
+	Query(query string, args ...interface{}) (*sql.Rows, error)
+}, target string) ([]report.Report, error) {
+	results, err := db.Query("SELECT ID, Reporter, Reason, Details, Time FROM Reports WHERE Target=? AND Outcome='' ORDER BY Time", target)
+	if err != nil {
+		return nil, err
+	}
+	defer results.Close()
+
+	open := []report.Report{}
+	for results.Next() {
+		r := report.Report{Target: target}
+		var reason string
+		var details sql.NullString
+		var when sqlTime
+		if err := results.Scan(&r.ID, &r.Reporter, &reason, &details, &when); err != nil {
+			return nil, err
+		}
+		r.Reason = report.Reason(reason)
+		r.Details = details.String
+		r.Time = when.Time
+		open = append(open, r)
+	}
+	return open, results.Err()
+}
+
+// Resolve closes every open report of the profile with the outcome and return how many it closed
+func (s *ReportStore) Resolve(target string, outcome report.Outcome, by string, at time.Time) (int, error) {
+	defer metrics.ObserveQuery("report_resolve")()
+	db := s.db.pool
+
+	result, err := db.Exec("UPDATE Reports SET Outcome=?, ResolvedBy=?, ResolvedAt=? WHERE Target=? AND Outcome=''",
+		string(outcome), by, formatTime(at), target)
+	if err != nil {
+		return 0, err
+	}
+	n, err := result.RowsAffected()
+	return int(n), err
+}
+
+// ByReporter return a page of the reports filed by the user, newest first, and their total
+func (s *ReportStore) ByReporter(reporter string, offset, limit int) ([]report.Report, int, error) {
+	defer metrics.ObserveQuery("report_by_reporter")()
+	db := s.db.pool
+
+	var total int
+	if err := db.QueryRow("SELECT COUNT(*) FROM Reports WHERE Reporter=?", reporter).Scan(&total); err != nil {
+		return nil, 0, err
+	}
+	if limit <= 0 {
+		limit = total
+	}
+
+	results, err := db.Query(`SELECT ID, Target, Reason, Details, Time, Outcome, ResolvedBy, ResolvedAt FROM Reports
+		WHERE Reporter=? ORDER BY Time DESC LIMIT ? OFFSET ?`, reporter, limit, offset)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer results.Close()
+
+	filed := []report.Report{}
+	for results.Next() {
+		r := report.Report{Reporter: reporter}
+		var reason, outcome string
+		var details sql.NullString
+		var when, resolved sqlTime
+		if err := results.Scan(&r.ID, &r.Target, &reason, &details, &when, &outcome, &r.ResolvedBy, &resolved); err != nil {
+			return nil, 0, err
+		}
+		r.Reason = report.Reason(reason)
+		r.Details = details.String
+		r.Time = when.Time
+		r.Outcome = report.Outcome(outcome)
+		r.ResolvedAt = resolved.Time
+		filed = append(filed, r)
+	}
+	return filed, total, results.Err()
+}
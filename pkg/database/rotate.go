@@ -0,0 +1,182 @@
+package database
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/teojiahao/HireMe/pkg/security"
+)
+
+// Rotation walks every row with encrypted fields and seals them again under the primary key
+type Rotation struct {
+	// DB is the database rotated
+	DB *DB
+	// BatchSize is the number of rows read at a time
+	BatchSize int
+	// Verify only checks that the primary key opens every ciphertext, nothing is written
+	Verify bool
+	// After resumes the walk from the row after this username
+	After string
+	// Progress is called after every batch
+	Progress func(p RotateProgress)
+}
+
+// RotateProgress is how far the rotation has gone
+type RotateProgress struct {
+	// Total is the number of rows when the rotation started
+	Total int
+	// Done is the number of rows looked at
+	Done int
+	// Resealed is the number of rows written under the primary key
+	Resealed int
+	// Failed lists the rows with a ciphertext that cannot be opened, or when verifying is not
+	// sealed under the primary key, with every column that failed
+	Failed []string
+	// Last is the username of the last row looked at, pass it as After to resume
+	Last string
+}
+
+// reseal return the value sealed under the primary key, and whether it changed. When verifying
+// nothing is sealed and a value the primary key does not open is an error.
+func reseal(keyring *security.Keyring, sealed []byte, verify bool) ([]byte, bool, error) {
+	if len(sealed) == 0 || keyring.SealedWithPrimary(sealed) {
+		return sealed, false, nil
+	}
+	data, err := keyring.Decrypt(sealed)
+	if err != nil {
+		return nil, false, err
+	}
+	if verify {
+		if id, err := security.KeyID(sealed); err == nil {
+			return nil, false, fmt.Errorf("sealed under key %q, not the primary key", id)
+		}
+		return nil, false, errors.New("sealed under the legacy key, not the primary key")
+	}
+	resealed, err := keyring.Encrypt(data)
+	return resealed, err == nil, err
+}
+
+// resealTwoFactor seals the two-factor secret of the user again, it return whether it wrote the row
+func resealTwoFactor(db *sql.DB, keyring *security.Keyring, username string, verify bool) (bool, error) {
+	var sealed []byte
+	err := db.QueryRow("SELECT Secret FROM TwoFactor WHERE Username=?", username).Scan(&sealed)
+	if err == sql.ErrNoRows {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+
+	secret, changed, err := reseal(keyring, sealed, verify)
+	if err != nil || !changed {
+		return false, err
+	}
+	result, err := db.Exec("UPDATE TwoFactor SET Secret=? WHERE Username=? AND Secret<=>?", secret, username, sealed)
+	if err != nil {
+		return false, err
+	}
+	n, _ := result.RowsAffected()
+	return n > 0, nil
+}
+
+// Run walks the Users table ordered by username, the Pass and AccessKey columns and the
+// TwoFactor secret of the user are sealed again when they are not under the primary key yet. It is safe to run while the server is up, a row
+// changed meanwhile is left alone as it is already sealed under the primary key.
+func (r *Rotation) Run() (RotateProgress, error) {
+	keyring := r.DB.keyring
+	batchSize := r.BatchSize
+	if batchSize <= 0 {
+		batchSize = 100
+	}
+
+	db := r.DB.pool
+
+	progress := RotateProgress{Last: r.After, Failed: []string{}}
+	if err := db.QueryRow("SELECT COUNT(*) FROM Users").Scan(&progress.Total); err != nil {
+		return progress, err
+	}
+	if r.After != "" {
+		var skipped int
+		if err := db.QueryRow("SELECT COUNT(*) FROM Users WHERE Username<=?", r.After).Scan(&skipped); err != nil {
+			return progress, err
+		}
+		progress.Done = skipped
+	}
+
+	for {
+		results, err := db.Query("SELECT Username, Pass, AccessKey FROM Users WHERE Username>? ORDER BY Username LIMIT ?", progress.Last, batchSize)
+		if err != nil {
+			return progress, err
+		}
+
+		type row struct {
+			username  string
+			pass, key []byte
+		}
+		rows := []row{}
+		for results.Next() {
+			var rw row
+			if err := results.Scan(&rw.username, &rw.pass, &rw.key); err != nil {
+				results.Close()
+				return progress, err
+			}
+			rows = append(rows, rw)
+		}
+		results.Close()
+		if err := results.Err(); err != nil {
+			return progress, err
+		}
+		if len(rows) == 0 {
+			return progress, nil
+		}
+
+		for _, rw := range rows {
+			progress.Done++
+			progress.Last = rw.username
+
+			// every column is looked at so one failing does not hide the others,
+			// a column that failed keeps its value
+			problems := []string{}
+			twoFactorChanged, err := resealTwoFactor(db, keyring, rw.username, r.Verify)
+			if err != nil {
+				problems = append(problems, fmt.Sprintf("TwoFactor: %v", err))
+			}
+			pass, passChanged, err := reseal(keyring, rw.pass, r.Verify)
+			if err != nil {
+				problems = append(problems, fmt.Sprintf("Pass: %v", err))
+				pass = rw.pass
+			}
+			key, keyChanged, err := reseal(keyring, rw.key, r.Verify)
+			if err != nil {
+				problems = append(problems, fmt.Sprintf("AccessKey: %v", err))
+				key = rw.key
+			}
+			if len(problems) > 0 {
+				progress.Failed = append(progress.Failed, rw.username+": "+strings.Join(problems, "; "))
+			}
+
+			if !passChanged && !keyChanged {
+				if twoFactorChanged {
+					progress.Resealed++
+				}
+				continue
+			}
+
+			// only write if nobody changed the row since it was read
+			result, err := db.Exec("UPDATE Users SET Pass=?, AccessKey=? WHERE Username=? AND Pass<=>? AND AccessKey<=>?",
+				pass, key, rw.username, rw.pass, rw.key)
+			if err != nil {
+				return progress, err
+			}
+			if n, _ := result.RowsAffected(); n > 0 || twoFactorChanged {
+				progress.Resealed++
+			}
+		}
+
+		if r.Progress != nil {
+			r.Progress(progress)
+		}
+	}
+}
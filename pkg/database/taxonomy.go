@@ -0,0 +1,314 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+
+	"github.com/go-sql-driver/mysql"
+	"github.com/teojiahao/HireMe/pkg/metrics"
+	"github.com/teojiahao/HireMe/pkg/taxonomy"
+)
+
+// taxonomyTable is where a list and the picks of it are kept
+type taxonomyTable struct {
+	name  string
+	links string
+	id    string
+	// order the names are listed in
+	order string
+}
+
+var taxonomyTables = map[taxonomy.Kind]taxonomyTable{
+	taxonomy.JobType:  {"JobTypes", "UserJobTypes", "JobTypeID", "ID"},
+	taxonomy.Category: {"Categories", "UserCategories", "CategoryID", "Name"},
+	taxonomy.Skill:    {"Skills", "UserSkills", "SkillID", "Name"},
+}
+
+// TaxonomyStore keeps the lists in the JobTypes, Categories and Skills tables and the picks of
+// the users in a link table for each
+type TaxonomyStore struct {
+	db *DB
+}
+
+// NewTaxonomyStore return a TaxonomyStore
+func NewTaxonomyStore(db *DB) *TaxonomyStore {
+	return &TaxonomyStore{db: db}
+}
+
+// duplicate turns a duplicate name into taxonomy.ErrExists
+func duplicate(err error) error {
+	if mysqlErr, ok := err.(*mysql.MySQLError); ok && mysqlErr.Number == errDuplicateEntry {
+		return taxonomy.ErrExists
+	}
+	return err
+}
+
+// names return the first column of every row
+func names(results *sql.Rows, err error) ([]string, error) {
+	if err != nil {
+		return nil, err
+	}
+	defer results.Close()
+	found := []string{}
+	for results.Next() {
+		var name string
+		if err := results.Scan(&name); err != nil {
+			return nil, err
+		}
+		found = append(found, name)
+	}
+	return found, results.Err()
+}
+
+// Taxonomy return every list
+func (s *TaxonomyStore) Taxonomy() (taxonomy.Taxonomy, error) {
+	defer metrics.ObserveQuery("taxonomy_get")()
+	db := s.db.pool
+
+	var t taxonomy.Taxonomy
+	var err error
+	if t.JobTypes, err = names(db.Query("SELECT Name FROM JobTypes ORDER BY ID")); err != nil {
+		return t, err
+	}
+	if t.Categories, err = names(db.Query("SELECT Name FROM Categories ORDER BY Name")); err != nil {
+		return t, err
+	}
+
+	results, err := db.Query("SELECT c.Name, s.Name FROM Skills s JOIN Categories c ON c.ID=s.CategoryID ORDER BY s.Name")
+	if err != nil {
+		return t, err
+	}
+	defer results.Close()
+	t.Skills = map[string][]string{}
+	for results.Next() {
+		var category, skill string
+		if err := results.Scan(&category, &skill); err != nil {
+			return t, err
+		}
+		t.Skills[category] = append(t.Skills[category], skill)
+	}
+	return t, results.Err()
+}
+
+// Add puts the name in the list of the kind, category is the one a skill belongs to
+func (s *TaxonomyStore) Add(kind taxonomy.Kind, name, category string) error {
+	defer metrics.ObserveQuery("taxonomy_add")()
+	db := s.db.pool
+
+	switch kind {
+	case taxonomy.JobType, taxonomy.Category:
+		_, err := db.Exec("INSERT INTO "+taxonomyTables[kind].name+" (Name) VALUES (?)", name)
+		return duplicate(err)
+	case taxonomy.Skill:
+		result, err := db.Exec("INSERT INTO Skills (CategoryID, Name) SELECT ID, ? FROM Categories WHERE Name=?", name, category)
+		if err != nil {
+			return duplicate(err)
+		}
+		if n, err := result.RowsAffected(); err != nil || n == 0 {
+			return taxonomy.ErrNotFound
+		}
+		return nil
+	}
+	return taxonomy.ErrNotFound
+}
+
+// Rename changes the name, the links hold the id so the users keep their picks
+func (s *TaxonomyStore) Rename(kind taxonomy.Kind, name, to string) error {
+	defer metrics.ObserveQuery("taxonomy_rename")()
+	db := s.db.pool
+
+	table, ok := taxonomyTables[kind]
+	if !ok {
+		return taxonomy.ErrNotFound
+	}
+	result, err := db.Exec("UPDATE "+table.name+" SET Name=? WHERE Name=?", to, name)
+	if err != nil {
+		return duplicate(err)
+	}
+	if n, err := result.RowsAffected(); err != nil || n == 0 {
+		return taxonomy.ErrNotFound
+	}
+	return nil
+}
+
+// Remove takes the name out of the list and out of the picks, a category goes with its skills
+func (s *TaxonomyStore) Remove(kind taxonomy.Kind, name string) error {
+	defer metrics.ObserveQuery("taxonomy_remove")()
+	db := s.db.pool
+
+	table, ok := taxonomyTables[kind]
+	if !ok {
+		return taxonomy.ErrNotFound
+	}
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var id int64
+	err = tx.QueryRow("SELECT ID FROM "+table.name+" WHERE Name=?", name).Scan(&id)
+	if err == sql.ErrNoRows {
+		return taxonomy.ErrNotFound
+	}
+	if err != nil {
+		return err
+	}
+	statements := []string{}
+	if kind == taxonomy.Category {
+		statements = append(statements,
+			"DELETE FROM UserSkills WHERE SkillID IN (SELECT ID FROM Skills WHERE CategoryID=?)",
+			"DELETE FROM Skills WHERE CategoryID=?")
+	}
+	statements = append(statements,
+		"DELETE FROM "+table.links+" WHERE "+table.id+"=?",
+		"DELETE FROM "+table.name+" WHERE ID=?")
+	for _, statement := range statements {
+		if _, err := tx.Exec(statement, id); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// Pick replace what the user picked, the names not in the lists are left out
+func (s *TaxonomyStore) Pick(username string, sel taxonomy.Selection) error {
+	defer metrics.ObserveQuery("taxonomy_pick")()
+	db := s.db.pool
+
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	for kind, picked := range map[taxonomy.Kind][]string{
+		taxonomy.JobType:  sel.JobTypes,
+		taxonomy.Category: sel.Categories,
+		taxonomy.Skill:    sel.Skills,
+	} {
+		table := taxonomyTables[kind]
+		if _, err := tx.Exec("DELETE FROM "+table.links+" WHERE Username=?", username); err != nil {
+			return err
+		}
+		for _, name := range picked {
+			if _, err := tx.Exec("INSERT IGNORE INTO "+table.links+" (Username, "+table.id+") SELECT ?, ID FROM "+table.name+" WHERE Name=?",
+				username, name); err != nil {
+				return err
+			}
+		}
+	}
+	return tx.Commit()
+}
+
+// picks return the picks of the users matching the where clause by username
+func (s *TaxonomyStore) picks(where string, args ...interface{}) (map[string]taxonomy.Selection, error) {
+	picks := map[string]taxonomy.Selection{}
+	for _, kind := range []taxonomy.Kind{taxonomy.JobType, taxonomy.Category, taxonomy.Skill} {
+		table := taxonomyTables[kind]
+		results, err := s.db.pool.Query(fmt.Sprintf("SELECT l.Username, t.Name FROM %s l JOIN %s t ON t.ID=l.%s %s ORDER BY t.%s",
+			table.links, table.name, table.id, where, table.order), args...)
+		if err != nil {
+			return nil, err
+		}
+		for results.Next() {
+			var username, name string
+			if err := results.Scan(&username, &name); err != nil {
+				results.Close()
+				return nil, err
+			}
+			sel := picks[username]
+			switch kind {
+			case taxonomy.JobType:
+				sel.JobTypes = append(sel.JobTypes, name)
+			case taxonomy.Category:
+				sel.Categories = append(sel.Categories, name)
+			case taxonomy.Skill:
+				sel.Skills = append(sel.Skills, name)
+			}
+			picks[username] = sel
+		}
+		results.Close()
+		if err := results.Err(); err != nil {
+			return nil, err
+		}
+	}
+	return picks, nil
+}
+
+// Picked return what the user picked
+func (s *TaxonomyStore) Picked(username string) (taxonomy.Selection, error) {
+	defer metrics.ObserveQuery("taxonomy_picked")()
+	picks, err := s.picks("WHERE l.Username=?", username)
+	return picks[username], err
+}
+
+// Picks return what every user picked by username
+func (s *TaxonomyStore) Picks() (map[string]taxonomy.Selection, error) {
+	defer metrics.ObserveQuery("taxonomy_picks")()
+	return s.picks("")
+}
+
+// taxonomyDefaults are the statements putting the built in lists in new tables
+func taxonomyDefaults() []string {
+	values := func(names []string) string {
+		quoted := []string{}
+		for _, name := range names {
+			quoted = append(quoted, "('"+strings.ReplaceAll(name, "'", "''")+"')")
+		}
+		return strings.Join(quoted, ", ")
+	}
+	return []string{
+		"INSERT IGNORE INTO JobTypes (Name) VALUES " + values(taxonomy.DefaultJobTypes),
+		"INSERT IGNORE INTO Categories (Name) VALUES " + values(taxonomy.DefaultCategories),
+	}
+}
+
+// linkUserTaxonomy moves the job types and categories the profiles kept joined with ", " in
+// Users.JobType and Users.Skill to the link tables. The names not in the lists are added so no
+// pick is lost, an admin can remove them after.
+func linkUserTaxonomy(ctx context.Context, conn *sql.Conn) error {
+	type joined struct{ username, jobTypes, categories string }
+	results, err := conn.QueryContext(ctx, "SELECT Username, COALESCE(JobType, ''), COALESCE(Skill, '') FROM Users")
+	if err != nil {
+		return err
+	}
+	users := []joined{}
+	for results.Next() {
+		var u joined
+		if err := results.Scan(&u.username, &u.jobTypes, &u.categories); err != nil {
+			results.Close()
+			return err
+		}
+		users = append(users, u)
+	}
+	results.Close()
+	if err := results.Err(); err != nil {
+		return err
+	}
+
+	for kind, known := range map[taxonomy.Kind][]string{taxonomy.JobType: taxonomy.DefaultJobTypes, taxonomy.Category: taxonomy.DefaultCategories} {
+		table := taxonomyTables[kind]
+		for _, u := range users {
+			list := u.jobTypes
+			if kind == taxonomy.Category {
+				list = u.categories
+			}
+			for _, name := range taxonomy.Split(list, known) {
+				name, err := taxonomy.Clean(name)
+				if err != nil {
+					continue
+				}
+				if _, err := conn.ExecContext(ctx, "INSERT IGNORE INTO "+table.name+" (Name) VALUES (?)", name); err != nil {
+					return err
+				}
+				if _, err := conn.ExecContext(ctx, "INSERT IGNORE INTO "+table.links+" (Username, "+table.id+") SELECT ?, ID FROM "+table.name+" WHERE Name=?",
+					u.username, name); err != nil {
+					return err
+				}
+			}
+		}
+	}
+	return nil
+}
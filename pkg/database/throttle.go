@@ -0,0 +1,82 @@
+package database
+
+import (
+	"database/sql"
+	"time"
+
+	"github.com/teojiahao/HireMe/pkg/metrics"
+	"github.com/teojiahao/HireMe/pkg/throttle"
+)
+
+// ThrottleStore keeps the failed login attempts in the LoginAttempts table
+// so every instance sees the same limits
+type ThrottleStore struct {
+	db *DB
+}
+
+// NewThrottleStore return a ThrottleStore
+func NewThrottleStore(db *DB) *ThrottleStore {
+	return &ThrottleStore{db: db}
+}
+
+// Get return the record of the key, the zero Record when there is none
+func (s *ThrottleStore) Get(key string) (throttle.Record, error) {
+	defer metrics.ObserveQuery("throttle_get")()
+	db := s.db.pool
+
+	var r throttle.Record
+	var last, until sqlTime
+	err := db.QueryRow("SELECT Failures, Last, Until FROM LoginAttempts WHERE ThrottleKey=?", key).Scan(&r.Failures, &last, &until)
+	if err == sql.ErrNoRows {
+		return throttle.Record{}, nil
+	}
+	if err != nil {
+		return throttle.Record{}, err
+	}
+	r.Last = last.Time
+	r.Until = until.Time
+	return r, nil
+}
+
+// Fail adds a failure to the key with one upsert, the row stays locked until Until is set from
+// the count stored so instances failing the same key at once each see their own count
+func (s *ThrottleStore) Fail(key string, now time.Time, reset time.Duration, delay func(failures int) time.Duration) (throttle.Record, error) {
+	defer metrics.ObserveQuery("throttle_fail")()
+	db := s.db.pool
+
+	tx, err := db.Begin()
+	if err != nil {
+		return throttle.Record{}, err
+	}
+	defer tx.Rollback()
+
+	// with no reset no failure is old enough to start again
+	resetBefore := time.Unix(0, 0)
+	if reset > 0 {
+		resetBefore = now.Add(-reset)
+	}
+	if _, err := tx.Exec(`INSERT INTO LoginAttempts (ThrottleKey, Failures, Last, Until) VALUES (?, 1, ?, ?)
+		ON DUPLICATE KEY UPDATE Failures=IF(Last < ?, 1, Failures+1), Last=VALUES(Last)`,
+		key, formatTime(now), formatTime(now), formatTime(resetBefore)); err != nil {
+		return throttle.Record{}, err
+	}
+
+	r := throttle.Record{Last: now}
+	if err := tx.QueryRow("SELECT Failures FROM LoginAttempts WHERE ThrottleKey=?", key).Scan(&r.Failures); err != nil {
+		return throttle.Record{}, err
+	}
+	r.Until = now.Add(delay(r.Failures))
+	if _, err := tx.Exec("UPDATE LoginAttempts SET Until=? WHERE ThrottleKey=?", formatTime(r.Until), key); err != nil {
+		return throttle.Record{}, err
+	}
+	return r, tx.Commit()
+}
+
+// Delete removes the record of the key
+func (s *ThrottleStore) Delete(key string) error {
+	defer metrics.ObserveQuery("throttle_delete")()
+	db := s.db.pool
+
+	_, err := db.Exec("DELETE FROM LoginAttempts WHERE ThrottleKey=?", key)
+	return err
+}
@@ -0,0 +1,72 @@
+package database
+
+import (
+	"database/sql"
+	"strings"
+
+	"github.com/teojiahao/HireMe/pkg/metrics"
+	"github.com/teojiahao/HireMe/pkg/totp"
+)
+
+// TwoFactorStore keeps the two-factor enrolments in the TwoFactor table,
+// the secret is sealed with the keyring like the other secrets
+type TwoFactorStore struct {
+	db *DB
+}
+
+// NewTwoFactorStore return a TwoFactorStore
+func NewTwoFactorStore(db *DB) *TwoFactorStore {
+	return &TwoFactorStore{db: db}
+}
+
+// Get return the enrolment of the user, totp.ErrNotEnrolled when there is none
+func (s *TwoFactorStore) Get(username string) (totp.Enrolment, error) {
+	defer metrics.ObserveQuery("twofactor_get")()
+	db := s.db.pool
+
+	var e totp.Enrolment
+	var sealed []byte
+	var recovery string
+	err := db.QueryRow("SELECT Secret, Enabled, LastStep, RecoveryCodes FROM TwoFactor WHERE Username=?", username).
+		Scan(&sealed, &e.Enabled, &e.LastStep, &recovery)
+	if err == sql.ErrNoRows {
+		return totp.Enrolment{}, totp.ErrNotEnrolled
+	}
+	if err != nil {
+		return totp.Enrolment{}, err
+	}
+
+	e.Secret, err = s.db.keyring.Decrypt(sealed)
+	if err != nil {
+		return totp.Enrolment{}, err
+	}
+	if recovery != "" {
+		e.Recovery = strings.Split(recovery, ",")
+	}
+	return e, nil
+}
+
+// Put saves the enrolment of the user
+func (s *TwoFactorStore) Put(username string, e totp.Enrolment) error {
+	sealed, err := s.db.keyring.Encrypt(e.Secret)
+	if err != nil {
+		return err
+	}
+
+	defer metrics.ObserveQuery("twofactor_put")()
+	db := s.db.pool
+
+	_, err = db.Exec(`INSERT INTO TwoFactor (Username, Secret, Enabled, LastStep, RecoveryCodes) VALUES (?, ?, ?, ?, ?)
+		ON DUPLICATE KEY UPDATE Secret=VALUES(Secret), Enabled=VALUES(Enabled), LastStep=VALUES(LastStep), RecoveryCodes=VALUES(RecoveryCodes)`,
+		username, sealed, e.Enabled, e.LastStep, strings.Join(e.Recovery, ","))
+	return err
+}
+
+// Delete removes the enrolment of the user
+func (s *TwoFactorStore) Delete(username string) error {
+	defer metrics.ObserveQuery("twofactor_delete")()
+	db := s.db.pool
+
+	_, err := db.Exec("DELETE FROM TwoFactor WHERE Username=?", username)
+	return err
+}
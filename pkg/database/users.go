@@ -0,0 +1,82 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+
+	"github.com/teojiahao/HireMe/pkg/throttle"
+)
+
+// ErrNoUser is returned when the username is not in the Users table
+var ErrNoUser = errors.New("no such user")
+
+// GetUser return the user, ErrNoUser when there is none
+func (d *DB) GetUser(ctx context.Context, username string) (User, error) {
+	ctx, done := observe(ctx, "get_user")
+	defer done()
+	db := d.pool
+
+	user, err := scanUser(db.QueryRowContext(ctx, "Select "+userColumns+" from my_db.Users WHERE Username=?", username))
+	if err == sql.ErrNoRows {
+		return User{}, ErrNoUser
+	}
+	return user, err
+}
+
+// SetDisabled disables or enables the user
+func (d *DB) SetDisabled(ctx context.Context, username string, disabled bool) error {
+	ctx, done := observe(ctx, "set_disabled")
+	defer done()
+	db := d.pool
+
+	_, err := db.ExecContext(ctx, "UPDATE Users SET Disabled=? WHERE Username=?", disabled, username)
+	return err
+}
+
+// SetHidden takes the profile of the user off the map, or puts it back
+func (d *DB) SetHidden(ctx context.Context, username string, hidden bool) error {
+	ctx, done := observe(ctx, "set_hidden")
+	defer done()
+	db := d.pool
+
+	_, err := db.ExecContext(ctx, "UPDATE Users SET Hidden=? WHERE Username=?", hidden, username)
+	return err
+}
+
+// SetAccessKey replace the sealed key of the user, nil revokes it
+func (d *DB) SetAccessKey(ctx context.Context, username string, key []byte) error {
+	ctx, done := observe(ctx, "set_access_key")
+	defer done()
+	db := d.pool
+
+	_, err := db.ExecContext(ctx, "UPDATE Users SET AccessKey=? WHERE Username=?", key, username)
+	return err
+}
+
+// DeleteUser removes the user with the two-factor secret, the alerts, the activity, the job
+// picks, the reports and the failed logins of the user, the audit log keeps its entries
+func (d *DB) DeleteUser(ctx context.Context, username string) error {
+	ctx, done := observe(ctx, "delete_user")
+	defer done()
+	db := d.pool
+
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	for _, table := range []string{"TwoFactor", "Alerts", "Activity", "UserJobTypes", "UserCategories", "UserSkills", "Users"} {
+		if _, err := tx.ExecContext(ctx, "DELETE FROM "+table+" WHERE Username=?", username); err != nil {
+			return err
+		}
+	}
+	// the reports by and about the user and the failed logins of the account name them too
+	if _, err := tx.ExecContext(ctx, "DELETE FROM Reports WHERE Target=? OR Reporter=?", username, username); err != nil {
+		return err
+	}
+	if _, err := tx.ExecContext(ctx, "DELETE FROM LoginAttempts WHERE ThrottleKey=?", throttle.AccountPrefix+username); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
@@ -0,0 +1,72 @@
+package email
+
+import (
+	"bufio"
+	"os"
+	"strings"
+
+	"golang.org/x/net/idna"
+)
+
+// DisposableList holds the domains of disposable email providers
+type DisposableList struct {
+	domains map[string]bool
+}
+
+// NewDisposableList return a list of the domains given
+func NewDisposableList(domains ...string) *DisposableList {
+	l := &DisposableList{domains: map[string]bool{}}
+	for _, domain := range domains {
+		l.add(domain)
+	}
+	return l
+}
+
+// LoadDisposableList reads a file with one domain per line, blank lines and lines starting with # are skipped
+func LoadDisposableList(path string) (*DisposableList, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	l := NewDisposableList()
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		l.add(line)
+	}
+	return l, scanner.Err()
+}
+
+// add keeps the domain in the same form Parse gives
+func (l *DisposableList) add(domain string) {
+	domain = strings.TrimSuffix(strings.TrimSpace(domain), ".")
+	if ascii, err := idna.Lookup.ToASCII(domain); err == nil {
+		domain = ascii
+	}
+	l.domains[strings.ToLower(domain)] = true
+}
+
+// Contains checks the domain and every domain above it, so "mail.tempmail.com" matches "tempmail.com"
+func (l *DisposableList) Contains(domain string) bool {
+	domain = strings.ToLower(domain)
+	for {
+		if l.domains[domain] {
+			return true
+		}
+		dot := strings.IndexByte(domain, '.')
+		if dot < 0 {
+			return false
+		}
+		domain = domain[dot+1:]
+	}
+}
+
+// Len return the number of domains in the list
+func (l *DisposableList) Len() int {
+	return len(l.domains)
+}
@@ -0,0 +1,219 @@
+// Package email parses and normalizes email addresses following RFC 5322, without the obsolete forms
+package email
+
+import (
+	"errors"
+	"strings"
+
+	"golang.org/x/net/idna"
+)
+
+// limits of RFC 5321
+const (
+	maxLength      = 254
+	maxLocalLength = 64
+	maxLabelLength = 63
+)
+
+// The rules an address can fail, each error says which one
+var (
+	ErrEmpty         = errors.New("E-mail is empty")
+	ErrTooLong       = errors.New("E-mail is longer than 254 characters")
+	ErrMissingAt     = errors.New("E-mail needs an @ between the name and the domain")
+	ErrLocalEmpty    = errors.New("E-mail needs a name before the @")
+	ErrLocalTooLong  = errors.New("E-mail name before the @ is longer than 64 characters")
+	ErrLocalDots     = errors.New("E-mail name cannot start or end with a dot or have two dots in a row")
+	ErrLocalChars    = errors.New("E-mail name has a character that is not allowed, use quotes around it")
+	ErrQuoted        = errors.New("E-mail name has a quote that is not closed or escaped")
+	ErrDomainEmpty   = errors.New("E-mail needs a domain after the @")
+	ErrDomainLiteral = errors.New("E-mail domain cannot be an ip address")
+	ErrDomainIDN     = errors.New("E-mail domain is not a valid domain name")
+	ErrDomainLabel   = errors.New("E-mail domain parts have to be 1 to 63 letters, numbers or hyphens, not starting or ending with a hyphen")
+	ErrDomainTLD     = errors.New("E-mail domain needs a top level domain like .com")
+	ErrDisposable    = errors.New("E-mail from a disposable email provider is not accepted")
+)
+
+// Address is a parsed email address
+type Address struct {
+	// Local is the part before the @, kept as given as it can be case sensitive
+	Local string
+	// Domain is lowercase and in ASCII, internationalized domains are in punycode
+	Domain string
+}
+
+// String return the normalized address
+func (a Address) String() string {
+	return a.Local + "@" + a.Domain
+}
+
+// UnicodeDomain return the domain as it is shown to people, e.g. "bücher.example" for "xn--bcher-kva.example"
+func (a Address) UnicodeDomain() string {
+	domain, err := idna.Display.ToUnicode(a.Domain)
+	if err != nil {
+		return a.Domain
+	}
+	return domain
+}
+
+// Parse checks the address and return it normalized, surrounding spaces are ignored
+func Parse(s string) (Address, error) {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return Address{}, ErrEmpty
+	}
+
+	// the domain cannot have an @ so the last one splits the address, the name can when quoted
+	at := strings.LastIndexByte(s, '@')
+	if at < 0 {
+		return Address{}, ErrMissingAt
+	}
+	local, domain := s[:at], s[at+1:]
+
+	if err := checkLocal(local); err != nil {
+		return Address{}, err
+	}
+	domain, err := normalizeDomain(domain)
+	if err != nil {
+		return Address{}, err
+	}
+
+	a := Address{Local: local, Domain: domain}
+	if len(a.String()) > maxLength {
+		return Address{}, ErrTooLong
+	}
+	return a, nil
+}
+
+// atext of RFC 5322, the characters allowed in a name without quotes
+func isAtext(c byte) bool {
+	switch {
+	case 'a' <= c && c <= 'z', 'A' <= c && c <= 'Z', '0' <= c && c <= '9':
+		return true
+	}
+	return strings.IndexByte("!#$%&'*+-/=?^_`{|}~", c) >= 0
+}
+
+// checkLocal accepts a dot-atom or a quoted-string
+func checkLocal(local string) error {
+	if local == "" {
+		return ErrLocalEmpty
+	}
+	if len(local) > maxLocalLength {
+		return ErrLocalTooLong
+	}
+
+	if strings.HasPrefix(local, `"`) {
+		return checkQuoted(local)
+	}
+
+	for _, atom := range strings.Split(local, ".") {
+		if atom == "" {
+			return ErrLocalDots
+		}
+		for i := 0; i < len(atom); i++ {
+			if !isAtext(atom[i]) {
+				if atom[i] == '"' {
+					return ErrQuoted
+				}
+				return ErrLocalChars
+			}
+		}
+	}
+	return nil
+}
+
+// checkQuoted accepts printable ASCII and spaces between the quotes, a quote or backslash has to be escaped
+func checkQuoted(local string) error {
+	if len(local) < 2 || !strings.HasSuffix(local, `"`) {
+		return ErrQuoted
+	}
+	for i := 1; i < len(local)-1; i++ {
+		c := local[i]
+		switch {
+		case c == '\\':
+			i++
+			if i == len(local)-1 || local[i] < ' ' || local[i] > '~' {
+				return ErrQuoted
+			}
+		case c == '"':
+			return ErrQuoted
+		case c < ' ' || c > '~':
+			return ErrLocalChars
+		}
+	}
+	return nil
+}
+
+// normalizeDomain return the domain in lowercase ASCII
+func normalizeDomain(domain string) (string, error) {
+	if domain == "" {
+		return "", ErrDomainEmpty
+	}
+	if strings.HasPrefix(domain, "[") {
+		return "", ErrDomainLiteral
+	}
+
+	// plain ASCII labels are checked first so the error names the rule they break
+	for _, label := range strings.Split(domain, ".") {
+		if isASCII(label) {
+			if err := checkLabel(strings.ToLower(label)); err != nil {
+				return "", err
+			}
+		}
+	}
+
+	ascii, err := idna.Lookup.ToASCII(domain)
+	if err != nil {
+		return "", ErrDomainIDN
+	}
+	ascii = strings.ToLower(ascii)
+
+	labels := strings.Split(ascii, ".")
+	for _, label := range labels {
+		if err := checkLabel(label); err != nil {
+			return "", err
+		}
+	}
+
+	// a top level domain is never all numbers, that would be an ip address
+	tld := labels[len(labels)-1]
+	if len(labels) < 2 || strings.Trim(tld, "0123456789") == "" {
+		return "", ErrDomainTLD
+	}
+	return ascii, nil
+}
+
+// checkLabel accepts letters, numbers and hyphens not at either end
+func checkLabel(label string) error {
+	if label == "" || len(label) > maxLabelLength || label[0] == '-' || label[len(label)-1] == '-' {
+		return ErrDomainLabel
+	}
+	for i := 0; i < len(label); i++ {
+		c := label[i]
+		if !('a' <= c && c <= 'z' || '0' <= c && c <= '9' || c == '-') {
+			return ErrDomainLabel
+		}
+	}
+	return nil
+}
+
+func isASCII(s string) bool {
+	for i := 0; i < len(s); i++ {
+		if s[i] >= 0x80 {
+			return false
+		}
+	}
+	return true
+}
+
+// Validate parses the address and rejects domains in the disposable list, a nil list turns the check off
+func Validate(s string, disposable *DisposableList) (Address, error) {
+	a, err := Parse(s)
+	if err != nil {
+		return Address{}, err
+	}
+	if disposable != nil && disposable.Contains(a.Domain) {
+		return Address{}, ErrDisposable
+	}
+	return a, nil
+}
@@ -0,0 +1,89 @@
+package email
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	. "github.com/franela/goblin"
+)
+
+func TestEmail(t *testing.T) {
+	gob := Goblin(t)
+
+	gob.Describe("Parse Test", func() {
+		gob.It("should accept valid addresses", func() {
+			for _, s := range []string{
+				"abc@asda.com",
+				"jane.doe+jobs@example.travel",
+				"o'brien@example.company",
+				"user@sub.domain.co.uk",
+				`"john doe"@example.com`,
+				`"a\"b"@example.com`,
+				"x@a-b.io",
+			} {
+				_, err := Parse(s)
+				gob.Assert(err).IsNil()
+			}
+		})
+
+		gob.It("should normalize the domain only", func() {
+			a, _ := Parse("  Jane@Example.COM ")
+			gob.Assert(a.String()).Equal("Jane@example.com")
+		})
+
+		gob.It("should convert internationalized domains", func() {
+			a, err := Parse("info@Bücher.example")
+			gob.Assert(err).IsNil()
+			gob.Assert(a.Domain).Equal("xn--bcher-kva.example")
+			gob.Assert(a.UnicodeDomain()).Equal("bücher.example")
+		})
+
+		gob.It("should say which rule failed", func() {
+			for s, want := range map[string]error{
+				"":                               ErrEmpty,
+				"abc":                            ErrMissingAt,
+				"@example.com":                   ErrLocalEmpty,
+				".abc@example.com":               ErrLocalDots,
+				"a..b@example.com":               ErrLocalDots,
+				"a b c@example.com":              ErrLocalChars,
+				"a\"bc@example.com":              ErrQuoted,
+				`"abc@example.com`:               ErrQuoted,
+				"abc@asd@asd":                    ErrLocalChars,
+				"abc@":                           ErrDomainEmpty,
+				"abc@[127.0.0.1]":                ErrDomainLiteral,
+				"abc@ .com":                      ErrDomainLabel,
+				"abc@xn--a.com":                  ErrDomainIDN,
+				"abc@\u0661\u0662a.com":          ErrDomainIDN,
+				"abc@-asd.com":                   ErrDomainLabel,
+				"abc@asd..com":                   ErrDomainLabel,
+				"abc@asd_1.com":                  ErrDomainLabel,
+				"abc@asd":                        ErrDomainTLD,
+				"abc@1.2.3.4":                    ErrDomainTLD,
+				strings.Repeat("a", 65) + "@a.b": ErrLocalTooLong,
+				"a@" + strings.Repeat(strings.Repeat("a", 50)+".", 5) + "com": ErrTooLong,
+			} {
+				_, err := Parse(s)
+				gob.Assert(err).Equal(want)
+			}
+		})
+	})
+
+	gob.Describe("Disposable Test", func() {
+		gob.It("should reject disposable domains and their subdomains", func() {
+			file := filepath.Join(t.TempDir(), "disposable.txt")
+			os.WriteFile(file, []byte("# throwaway\nTempMail.com\n\nmailinator.com\n"), 0600)
+			l, err := LoadDisposableList(file)
+			gob.Assert(err).IsNil()
+			gob.Assert(l.Len()).Equal(2)
+
+			_, err = Validate("abc@tempmail.com", l)
+			gob.Assert(err).Equal(ErrDisposable)
+			_, err = Validate("abc@inbox.MAILINATOR.com", l)
+			gob.Assert(err).Equal(ErrDisposable)
+			_, err = Validate("abc@nottempmail.com", l)
+			gob.Assert(err).IsNil()
+		})
+	})
+}
@@ -3,23 +3,31 @@ package handler
 
 import (
 	"bytes"
+	"encoding/base64"
 	"encoding/json"
 	"fmt"
+	"html/template"
 	"io/ioutil"
-	"log"
+	"log/slog"
 	"net/http"
-	"os"
+	"net/url"
+	"strings"
 	"time"
 
 	uuid "github.com/satori/go.uuid"
+	qrcode "github.com/skip2/go-qrcode"
+	"github.com/teojiahao/HireMe/pkg/api"
+	"github.com/teojiahao/HireMe/pkg/audit"
 	"github.com/teojiahao/HireMe/pkg/database"
+	"github.com/teojiahao/HireMe/pkg/logging"
 	"github.com/teojiahao/HireMe/pkg/queue"
 	"github.com/teojiahao/HireMe/pkg/security"
+	"github.com/teojiahao/HireMe/pkg/totp"
 )
 
 // Signup page send a POST to REST API
-func Signup(res http.ResponseWriter, req *http.Request) {
-	if alreadyLoggedIn(req) {
+func (s *Server) Signup(res http.ResponseWriter, req *http.Request) {
+	if s.alreadyLoggedIn(req) {
 		http.Redirect(res, req, "/", http.StatusSeeOther)
 		return
 	}
@@ -27,17 +35,21 @@ func Signup(res http.ResponseWriter, req *http.Request) {
 	if req.Method == http.MethodPost {
 		// get form values
 		username := bm.Sanitize(req.FormValue("username"))
-		password := bm.Sanitize(req.FormValue("password"))
+		// the password is only hashed, never shown, so it is kept as typed
+		password := req.FormValue("password")
 
 		if username != "" {
-			//check password
-			if err := security.CheckPassword(password); err != nil {
-				//http.Error(res, fmt.Sprintf("%v", err), http.StatusForbidden)
-				tpl.ExecuteTemplate(res, "signup.gohtml", fmt.Sprintf("%v", err))
+			//check password, showing every rule it breaks at once
+			if violations := s.passwords.Policy.Check(password); len(violations) > 0 {
+				messages := []string{}
+				for _, v := range violations {
+					messages = append(messages, v.Message)
+				}
+				s.pages.ExecuteTemplate(res, "signup.gohtml", messages)
 				return
 			}
 
-			hashPassword, err := security.HashPassword(password, "")
+			hashPassword, err := s.passwords.Hash(password)
 			if err != nil {
 				http.Error(res, "Internal server error", http.StatusInternalServerError)
 				return
@@ -47,47 +59,82 @@ func Signup(res http.ResponseWriter, req *http.Request) {
 				Username: username,
 				Password: hashPassword,
 			})
-			jsonResp, err := http.Post(baseURL+"/"+username, "application/json", bytes.NewBuffer(jsonValue))
+			request, err := http.NewRequestWithContext(req.Context(), http.MethodPost, s.baseURL+"/"+username, bytes.NewBuffer(jsonValue))
+			if err != nil {
+				http.Error(res, "Internal server error", http.StatusInternalServerError)
+				return
+			}
+			request.Header.Set("Content-Type", "application/json")
+			request.Header.Set("X-Forwarded-For", s.clientIP(req))
+			jsonResp, err := s.client.Do(request)
 			if err != nil {
 				http.Error(res, "Internal server error", http.StatusInternalServerError)
 				return
 			}
 			if jsonResp.StatusCode == 409 {
 				//http.Error(res, "Username already taken", http.StatusForbidden)
-				tpl.ExecuteTemplate(res, "signup.gohtml", "Username already taken")
+				s.pages.ExecuteTemplate(res, "signup.gohtml", []string{"Username already taken"})
 				return
 			}
 
-			// get encrypted key from API
-			key, _ := ioutil.ReadAll(jsonResp.Body)
-			jsonResp.Body.Close()
-			secretKey, _ := security.Decrypt(key, "")
-
-			// create session
-			id := uuid.NewV4()
-			myCookie := &http.Cookie{
-				Name:  "myCookie",
-				Value: id.String(),
-			}
-			http.SetCookie(res, myCookie)
-			mapSessions[myCookie.Value] = Session{username, string(secretKey)}
-
-			if _, ok := mapHistory[username]; !ok {
-				mapHistory[username] = &queue.Queue{}
-			}
-			currentTime := time.Now()
-			mapHistory[username].Enqueue(queue.History{Time: fmt.Sprintf(currentTime.Format("2006-01-02 3:04PM")), Activity: "Sign up"})
+			s.startSession(res, jsonResp, username)
+			s.recordActivity(req, username, queue.Signup, nil)
 		}
 		// redirect to main index
 		http.Redirect(res, req, "/updateProfile", http.StatusSeeOther)
 		return
 	}
-	tpl.ExecuteTemplate(res, "signup.gohtml", nil)
+	s.pages.ExecuteTemplate(res, "signup.gohtml", nil)
+}
+
+// pending logins wait this long for the two-factor code
+const twoFactorTimeout = 5 * time.Minute
+
+// a login with the right password waiting for the two-factor code
+type pendingLogin struct {
+	Username string
+	// Password is sealed as it has to be sent to the api again with the code
+	Password []byte
+	Expires  time.Time
+}
+
+// send the login to the api, code is empty until it asks for one
+func (s *Server) apiLogin(req *http.Request, username, password, code string) (*http.Response, error) {
+	jsonValue, _ := json.Marshal(api.LoginRequest{
+		User: database.User{
+			Username: username,
+			Password: []byte(password),
+		},
+		Code: code,
+	})
+	request, err := http.NewRequestWithContext(req.Context(), http.MethodPost, s.loginURL, bytes.NewBuffer(jsonValue))
+	if err != nil {
+		return nil, err
+	}
+	request.Header.Set("Content-Type", "application/json")
+	// let the api throttle by the ip of the user instead of ours
+	request.Header.Set("X-Forwarded-For", s.clientIP(req))
+	return s.client.Do(request)
+}
+
+// create the session with the encrypted key the api gave back
+func (s *Server) startSession(res http.ResponseWriter, jsonResp *http.Response, username string) {
+	key, _ := ioutil.ReadAll(jsonResp.Body)
+	jsonResp.Body.Close()
+	secretKey, _ := s.keyring.Decrypt(key)
+
+	id := uuid.NewV4()
+	myCookie := &http.Cookie{
+		Name:  "myCookie",
+		Value: id.String(),
+	}
+	http.SetCookie(res, myCookie)
+	s.sessions.Put(myCookie.Value, Session{username, string(secretKey)})
 }
 
 // Login page send a POST to REST API
-func Login(res http.ResponseWriter, req *http.Request) {
-	if alreadyLoggedIn(req) {
+func (s *Server) Login(res http.ResponseWriter, req *http.Request) {
+	if s.alreadyLoggedIn(req) {
 		http.Redirect(res, req, "/", http.StatusSeeOther)
 		return
 	}
@@ -100,76 +147,166 @@ func Login(res http.ResponseWriter, req *http.Request) {
 		}()
 
 		username := bm.Sanitize(req.FormValue("username"))
-		password := bm.Sanitize(req.FormValue("password"))
+		password := req.FormValue("password")
 
-		// check for ASCII
-		if !security.IsASCII(username) || !security.IsASCII(password) {
+		// check for ASCII, passwords may use more when the policy allows it
+		if !security.IsASCII(username) || (!s.passwords.Policy.AllowUnicode && !security.IsASCII(password)) {
 			//http.Error(res, "ASCII Character only", http.StatusForbidden)
-			tpl.ExecuteTemplate(res, "login.gohtml", "ASCII Character only")
+			s.pages.ExecuteTemplate(res, "login.gohtml", "ASCII Character only")
 			return
 		}
 
 		// send user details to API
-		jsonValue, _ := json.Marshal(database.User{
-			Username: username,
-			Password: []byte(password),
-		})
-		jsonResp, err := http.Post(os.Getenv("LOGIN_API"), "application/json", bytes.NewBuffer(jsonValue))
+		jsonResp, err := s.apiLogin(req, username, password, "")
 		if err != nil {
-			log.Println(err)
+			slog.ErrorContext(req.Context(), "logging in", "username", username, "error", err)
 			http.Error(res, "Internal server error", http.StatusInternalServerError)
 			return
 		}
+		if jsonResp.StatusCode == http.StatusTooManyRequests {
+			jsonResp.Body.Close()
+			<-timer
+			s.pages.ExecuteTemplate(res, "login.gohtml", fmt.Sprintf("Too many failed logins, try again in %s seconds", jsonResp.Header.Get("Retry-After")))
+			return
+		}
 		if jsonResp.StatusCode == 403 {
-			currentTime := time.Now()
-			if _, ok := mapHistory[username]; !ok {
-				mapHistory[username] = &queue.Queue{}
+			body, _ := ioutil.ReadAll(jsonResp.Body)
+			jsonResp.Body.Close()
+			if strings.HasPrefix(string(body), "403 - Account disabled") {
+				<-timer
+				s.pages.ExecuteTemplate(res, "login.gohtml", "This account has been disabled")
+				return
+			}
+			// anyone can type any username, only the accounts there are get the failure in their history
+			if s.exists != nil && s.exists(username) {
+				s.recordActivity(req, username, queue.LoginFailure, nil)
 			}
-			mapHistory[username].Enqueue(queue.History{Time: fmt.Sprintf(currentTime.Format("2006-01-02 3:04PM")), Activity: `<p style="color:red;">Failed to login</p>`})
 			<-timer
 			//http.Error(res, "Username and/or password do not match", http.StatusForbidden)
-			tpl.ExecuteTemplate(res, "login.gohtml", "Username and/or password do not match")
+			s.pages.ExecuteTemplate(res, "login.gohtml", "Username and/or password do not match")
 			return
 		}
+		if jsonResp.StatusCode == http.StatusUnauthorized {
+			jsonResp.Body.Close()
+			sealed, err := s.keyring.Encrypt([]byte(password))
+			if err != nil {
+				slog.ErrorContext(req.Context(), "sealing pending login", "error", err)
+				http.Error(res, "Internal server error", http.StatusInternalServerError)
+				return
+			}
 
-		// get encrypted key from API
-		key, _ := ioutil.ReadAll(jsonResp.Body)
-		jsonResp.Body.Close()
-		secretKey, _ := security.Decrypt(key, "")
+			// remember the login until the code is given on the next page
+			id := uuid.NewV4()
+			s.pendingMutex.Lock()
+			s.pendingLogins[id.String()] = pendingLogin{username, sealed, time.Now().Add(twoFactorTimeout)}
+			s.pendingMutex.Unlock()
+			http.SetCookie(res, &http.Cookie{
+				Name:     "twoFactorCookie",
+				Value:    id.String(),
+				Path:     "/login",
+				MaxAge:   int(twoFactorTimeout / time.Second),
+				HttpOnly: true,
+			})
+			http.Redirect(res, req, "/login/2fa", http.StatusSeeOther)
+			return
+		}
 
-		// create session
-		id := uuid.NewV4()
-		myCookie := &http.Cookie{
-			Name:  "myCookie",
-			Value: id.String(),
+		s.startSession(res, jsonResp, username)
+		s.recordActivity(req, username, queue.LoginSuccess, nil)
+
+		http.Redirect(res, req, "/", http.StatusSeeOther)
+		return
+	}
+	s.pages.ExecuteTemplate(res, "login.gohtml", nil)
+}
+
+// return the pending login of the browser, expired ones are dropped on the way
+func (s *Server) getPendingLogin(req *http.Request) (string, pendingLogin, bool) {
+	myCookie, err := req.Cookie("twoFactorCookie")
+	if err != nil {
+		return "", pendingLogin{}, false
+	}
+
+	s.pendingMutex.Lock()
+	defer s.pendingMutex.Unlock()
+	now := time.Now()
+	for id, p := range s.pendingLogins {
+		if now.After(p.Expires) {
+			delete(s.pendingLogins, id)
 		}
-		http.SetCookie(res, myCookie)
-		mapSessions[myCookie.Value] = Session{username, string(secretKey)}
+	}
+	p, ok := s.pendingLogins[myCookie.Value]
+	return myCookie.Value, p, ok
+}
 
-		currentTime := time.Now()
-		if _, ok := mapHistory[username]; !ok {
-			mapHistory[username] = &queue.Queue{}
+// LoginTwoFactor page ask for the code from the authenticator app, or a recovery code,
+// after the password was accepted
+func (s *Server) LoginTwoFactor(res http.ResponseWriter, req *http.Request) {
+	id, pending, ok := s.getPendingLogin(req)
+	if !ok {
+		http.Redirect(res, req, "/login", http.StatusSeeOther)
+		return
+	}
+
+	if req.Method == http.MethodPost {
+		timer := make(chan string, 1)
+		go func() {
+			time.Sleep(1 * time.Second)
+			timer <- "times up"
+		}()
+
+		password, err := s.keyring.Decrypt(pending.Password)
+		if err != nil {
+			slog.ErrorContext(req.Context(), "opening pending login", "error", err)
+			http.Error(res, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+		jsonResp, err := s.apiLogin(req, pending.Username, string(password), strings.TrimSpace(req.FormValue("code")))
+		if err != nil {
+			slog.ErrorContext(req.Context(), "logging in", "username", pending.Username, "error", err)
+			http.Error(res, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+		if jsonResp.StatusCode == http.StatusTooManyRequests {
+			jsonResp.Body.Close()
+			<-timer
+			s.pages.ExecuteTemplate(res, "loginTwoFactor.gohtml", fmt.Sprintf("Too many failed logins, try again in %s seconds", jsonResp.Header.Get("Retry-After")))
+			return
+		}
+		if jsonResp.StatusCode != http.StatusOK {
+			jsonResp.Body.Close()
+			s.recordActivity(req, pending.Username, queue.LoginFailure, map[string][]string{"reason": {"two-factor code"}})
+			<-timer
+			s.pages.ExecuteTemplate(res, "loginTwoFactor.gohtml", "Invalid code")
+			return
 		}
-		mapHistory[username].Enqueue(queue.History{Time: fmt.Sprintf(currentTime.Format("2006-01-02 3:04PM")), Activity: `<p style="color:green;">Successfully login</p>`})
+
+		s.pendingMutex.Lock()
+		delete(s.pendingLogins, id)
+		s.pendingMutex.Unlock()
+		http.SetCookie(res, &http.Cookie{Name: "twoFactorCookie", Path: "/login", MaxAge: -1})
+
+		s.startSession(res, jsonResp, pending.Username)
+		s.recordActivity(req, pending.Username, queue.LoginSuccess, nil)
 
 		http.Redirect(res, req, "/", http.StatusSeeOther)
 		return
 	}
-	tpl.ExecuteTemplate(res, "login.gohtml", nil)
+	s.pages.ExecuteTemplate(res, "loginTwoFactor.gohtml", nil)
 }
 
 // Logout page remove the cookies from the browser
-func Logout(res http.ResponseWriter, req *http.Request) {
-	if !alreadyLoggedIn(req) {
+func (s *Server) Logout(res http.ResponseWriter, req *http.Request) {
+	if !s.alreadyLoggedIn(req) {
 		http.Redirect(res, req, "/", http.StatusSeeOther)
 		return
 	}
 
-	myUser := getUserFromCookie(res, req)
+	myUser := s.getUserFromCookie(res, req)
 
 	myCookie, _ := req.Cookie("myCookie")
 	// delete the session
-	delete(mapSessions, myCookie.Value)
+	s.sessions.Delete(myCookie.Value)
 	// remove the cookie
 	myCookie = &http.Cookie{
 		Name:   "myCookie",
@@ -178,14 +315,13 @@ func Logout(res http.ResponseWriter, req *http.Request) {
 	}
 	http.SetCookie(res, myCookie)
 
-	currentTime := time.Now()
-	mapHistory[myUser.Username].Enqueue(queue.History{Time: fmt.Sprintf(currentTime.Format("2006-01-02 3:04PM")), Activity: "Logout"})
+	s.recordActivity(req, myUser.Username, queue.Logout, nil)
 
 	http.Redirect(res, req, "/", http.StatusSeeOther)
 }
 
 // check if cookie exist
-func getUserFromCookie(res http.ResponseWriter, req *http.Request) Session {
+func (s *Server) getUserFromCookie(res http.ResponseWriter, req *http.Request) Session {
 	// get current session cookie
 	myCookie, err := req.Cookie("myCookie")
 	if err != nil {
@@ -198,27 +334,130 @@ func getUserFromCookie(res http.ResponseWriter, req *http.Request) Session {
 	}
 
 	// if the User exists already, get username
-	username, ok := mapSessions[myCookie.Value]
+	username, ok := s.sessions.Get(myCookie.Value)
 	if !ok {
 		return username
 	}
+	logging.SetUser(req.Context(), username.Username)
 	return username
 }
 
 // check if user already logged in
-func alreadyLoggedIn(req *http.Request) bool {
+func (s *Server) alreadyLoggedIn(req *http.Request) bool {
 	myCookie, err := req.Cookie("myCookie")
 	if err != nil {
 		return false
 	}
-	session := mapSessions[myCookie.Value]
-	// send user details to API
-	response, err := http.Get(baseURL + "/" + session.Username)
+	session, ok := s.sessions.Get(myCookie.Value)
+	if !ok {
+		return false
+	}
+	// send user details to API, with the key so a disabled user or a revoked key ends the session
+	request, err := http.NewRequestWithContext(req.Context(), http.MethodGet, s.baseURL+"/"+session.Username+"?accessKey="+url.QueryEscape(session.Accesskey), nil)
 	if err != nil {
 		return false
 	}
+	response, err := s.client.Do(request)
+	if err != nil {
+		return false
+	}
+	response.Body.Close()
 	if response.StatusCode == 404 {
+		s.sessions.Delete(myCookie.Value)
 		return false
 	}
 	return true
 }
+
+// record the action of the user to itself in the audit log, failing to do so should not fail the request
+func (s *Server) recordAudit(req *http.Request, username string, action audit.Action) {
+	if err := s.audit.Record(username, action, username, s.clientIP(req), nil); err != nil {
+		slog.ErrorContext(req.Context(), "recording audit entry", "action", action, "error", err)
+	}
+}
+
+// TwoFactorSetup page lets the user turn two-factor authentication on and off
+// and get new recovery codes
+func (s *Server) TwoFactorSetup(res http.ResponseWriter, req *http.Request) {
+	if !s.alreadyLoggedIn(req) {
+		http.Redirect(res, req, "/login", http.StatusSeeOther)
+		return
+	}
+	myUser := s.getUserFromCookie(res, req)
+
+	data := struct {
+		Enabled       bool
+		Remaining     int
+		Secret        string
+		URI           template.URL
+		QR            template.URL
+		RecoveryCodes []string
+		Error         string
+	}{}
+
+	if req.Method == http.MethodPost {
+		code := strings.TrimSpace(req.FormValue("code"))
+		var err error
+		switch req.FormValue("action") {
+		case "begin":
+			_, _, err = s.twoFactor.Begin(myUser.Username)
+		case "confirm":
+			data.RecoveryCodes, err = s.twoFactor.Confirm(myUser.Username, code)
+			if err == nil {
+				s.recordActivity(req, myUser.Username, queue.TwoFactor, map[string][]string{"action": {"turned on"}})
+				s.recordAudit(req, myUser.Username, audit.TwoFactorEnable)
+			}
+		case "recovery":
+			if err = s.twoFactor.Verify(myUser.Username, code); err == nil {
+				data.RecoveryCodes, err = s.twoFactor.RegenerateRecoveryCodes(myUser.Username)
+			}
+			if err == nil {
+				s.recordActivity(req, myUser.Username, queue.TwoFactor, map[string][]string{"action": {"new recovery codes"}})
+				s.recordAudit(req, myUser.Username, audit.TwoFactorRecover)
+			}
+		case "disable":
+			if err = s.twoFactor.Verify(myUser.Username, code); err == nil {
+				err = s.twoFactor.Reset(myUser.Username)
+			}
+			if err == nil {
+				s.recordActivity(req, myUser.Username, queue.TwoFactor, map[string][]string{"action": {"turned off"}})
+				s.recordAudit(req, myUser.Username, audit.TwoFactorDisable)
+			}
+		}
+
+		switch err {
+		case nil:
+		case totp.ErrInvalidCode, totp.ErrNotEnrolled, totp.ErrEnabled:
+			data.Error = err.Error()
+		default:
+			slog.ErrorContext(req.Context(), "changing two-factor", "error", err)
+			http.Error(res, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+	}
+
+	enrolment, err := s.twoFactor.Store.Get(myUser.Username)
+	if err != nil && err != totp.ErrNotEnrolled {
+		slog.ErrorContext(req.Context(), "reading two-factor enrolment", "error", err)
+		http.Error(res, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	data.Enabled = enrolment.Enabled
+	data.Remaining = len(enrolment.Recovery)
+	// show the secret to scan until a code from it confirms the setup
+	action := req.FormValue("action")
+	if !data.Enabled && len(enrolment.Secret) > 0 && req.Method == http.MethodPost && (action == "begin" || action == "confirm") {
+		data.Secret = totp.EncodeSecret(enrolment.Secret)
+		uri := totp.URI(s.twoFactor.Issuer, myUser.Username, enrolment.Secret)
+		// otpauth and data urls are blocked by html/template unless marked as safe
+		data.URI = template.URL(uri)
+		png, err := qrcode.Encode(uri, qrcode.Medium, 256)
+		if err != nil {
+			slog.ErrorContext(req.Context(), "drawing two-factor qr code", "error", err)
+		} else {
+			data.QR = template.URL("data:image/png;base64," + base64.StdEncoding.EncodeToString(png))
+		}
+	}
+
+	s.pages.ExecuteTemplate(res, "twoFactor.gohtml", data)
+}
@@ -0,0 +1,555 @@
+package handler
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"html/template"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/teojiahao/HireMe/pkg/api"
+	"github.com/teojiahao/HireMe/pkg/audit"
+	"github.com/teojiahao/HireMe/pkg/queue"
+	"github.com/teojiahao/HireMe/pkg/report"
+	"github.com/teojiahao/HireMe/pkg/taxonomy"
+)
+
+// number of audit entries shown per page
+const auditPageSize = 20
+
+// return the logged in user when it is one of the ADMIN_USERS, other users get a 404
+func (s *Server) adminUser(res http.ResponseWriter, req *http.Request) (Session, bool) {
+	if !s.alreadyLoggedIn(req) {
+		http.NotFound(res, req)
+		return Session{}, false
+	}
+	myUser := s.getUserFromCookie(res, req)
+	if !s.isAdmin(myUser.Username) {
+		http.NotFound(res, req)
+		return Session{}, false
+	}
+	return myUser, true
+}
+
+// checks if the user is one of the ADMIN_USERS
+func (s *Server) isAdmin(username string) bool {
+	for _, admin := range s.admins {
+		if username != "" && admin == username {
+			return true
+		}
+	}
+	return false
+}
+
+// AuditLog page lets an admin search the audit log newest first and check the hash chain
+func (s *Server) AuditLog(res http.ResponseWriter, req *http.Request) {
+	if _, ok := s.adminUser(res, req); !ok {
+		return
+	}
+
+	page, _ := strconv.Atoi(req.FormValue("page"))
+	if page < 1 {
+		page = 1
+	}
+	req.ParseForm()
+	// keep the search when moving between pages and exporting
+	search := url.Values{}
+	for _, k := range []string{"actor", "action", "target", "from", "to"} {
+		for _, v := range req.Form[k] {
+			search.Add(k, v)
+		}
+	}
+
+	entries, total, err := s.audit.Store.Search(audit.QueryFromValues(search), (page-1)*auditPageSize, auditPageSize)
+	if err != nil {
+		slog.ErrorContext(req.Context(), "searching audit log", "error", err)
+		http.Error(res, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	data := struct {
+		Entries  []audit.Entry
+		Actions  []audit.Action
+		Search   url.Values
+		Selected string
+		Query    template.URL
+		Total    int
+		Page     int
+		PrevPage int
+		NextPage int
+		// Verified is set once the admin asks for the chain to be checked
+		Verified bool
+		Checked  int64
+		BadSeq   int64
+	}{
+		Entries:  entries,
+		Actions:  audit.Actions,
+		Search:   search,
+		Selected: search.Get("action"),
+		Query:    template.URL(search.Encode()),
+		Total:    total,
+		Page:     page,
+	}
+	if page > 1 {
+		data.PrevPage = page - 1
+	}
+	if page*auditPageSize < total {
+		data.NextPage = page + 1
+	}
+
+	if req.FormValue("verify") != "" {
+		data.Checked, data.BadSeq, err = s.audit.Verify()
+		if err != nil && err != audit.ErrTampered {
+			slog.ErrorContext(req.Context(), "verifying audit log", "error", err)
+			http.Error(res, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+		data.Verified = true
+	}
+
+	s.pages.ExecuteTemplate(res, "audit.gohtml", data)
+}
+
+// AuditExport download the audit entries matching the search as JSON Lines, oldest first
+func (s *Server) AuditExport(res http.ResponseWriter, req *http.Request) {
+	if _, ok := s.adminUser(res, req); !ok {
+		return
+	}
+
+	req.ParseForm()
+	res.Header().Set("Content-Type", "application/x-ndjson")
+	res.Header().Set("Content-Disposition", `attachment; filename="audit.jsonl"`)
+	if err := s.audit.Export(res, audit.QueryFromValues(req.Form)); err != nil {
+		slog.ErrorContext(req.Context(), "exporting audit log", "error", err)
+	}
+}
+
+// number of users and reports shown per page of the admin console
+const adminPageSize = 20
+
+// sameOrigin checks a form posted to the admin console comes from this site, the browser
+// sends the Origin of a POST or at least the Referer
+func sameOrigin(req *http.Request) bool {
+	from := req.Header.Get("Origin")
+	if from == "" {
+		from = req.Header.Get("Referer")
+	}
+	u, err := url.Parse(from)
+	return from != "" && err == nil && u.Host == req.Host
+}
+
+// send the request to the admin api with the key of the admin and decode the answer into
+// v when it is a 200, body is sent as JSON when not nil
+func (s *Server) adminAPI(req *http.Request, admin Session, method, path string, query url.Values, body, v interface{}) (int, error) {
+	if query == nil {
+		query = url.Values{}
+	}
+	query.Set("accessKey", admin.Accesskey)
+	var reqBody io.Reader
+	if body != nil {
+		jsonValue, _ := json.Marshal(body)
+		reqBody = bytes.NewBuffer(jsonValue)
+	}
+	request, err := http.NewRequestWithContext(req.Context(), method, s.adminURL+path+"?"+query.Encode(), reqBody)
+	if err != nil {
+		return 0, err
+	}
+	if body != nil {
+		request.Header.Set("Content-Type", "application/json")
+	}
+	response, err := s.client.Do(request)
+	if err != nil {
+		return 0, err
+	}
+	defer response.Body.Close()
+	if response.StatusCode == http.StatusOK && v != nil {
+		return response.StatusCode, json.NewDecoder(response.Body).Decode(v)
+	}
+	return response.StatusCode, nil
+}
+
+// change the profile or account of the user through the admin api
+func (s *Server) adminChange(req *http.Request, admin Session, username string, change api.AdminChange) error {
+	status, err := s.adminAPI(req, admin, http.MethodPatch, "/users/"+url.PathEscape(username), nil, change, nil)
+	if err == nil && status != http.StatusOK {
+		err = fmt.Errorf("admin api answered %d", status)
+	}
+	return err
+}
+
+// AdminUsers page lets an admin search the users by username, email and message and by
+// whether they are shown, hidden or disabled, with the number of users reporting each
+func (s *Server) AdminUsers(res http.ResponseWriter, req *http.Request) {
+	admin, ok := s.adminUser(res, req)
+	if !ok {
+		return
+	}
+
+	page, _ := strconv.Atoi(req.FormValue("page"))
+	if page < 1 {
+		page = 1
+	}
+	// keep the search when moving between pages
+	search := url.Values{}
+	for _, k := range []string{"q", "status"} {
+		if v := req.FormValue(k); v != "" {
+			search.Set(k, v)
+		}
+	}
+	query := url.Values{"page": {strconv.Itoa(page)}, "limit": {strconv.Itoa(adminPageSize)}}
+	for k, v := range search {
+		query[k] = v
+	}
+
+	var found api.ManagedUsers
+	status, err := s.adminAPI(req, admin, http.MethodGet, "/users", query, nil, &found)
+	if err == nil && status != http.StatusOK {
+		err = fmt.Errorf("admin api answered %d", status)
+	}
+	if err != nil {
+		slog.ErrorContext(req.Context(), "searching users", "error", err)
+		http.Error(res, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	cases, _, err := s.reports.Cases(0, 0)
+	if err != nil {
+		slog.ErrorContext(req.Context(), "reading reports", "error", err)
+	}
+	reported := map[string]int{}
+	for _, c := range cases {
+		reported[c.Target] = c.Reporters()
+	}
+
+	data := struct {
+		Users    []api.ManagedUser
+		Reported map[string]int
+		Statuses []string
+		Search   url.Values
+		Selected string
+		Query    template.URL
+		Total    int
+		Page     int
+		PrevPage int
+		NextPage int
+	}{
+		Users:    found.Users,
+		Reported: reported,
+		Statuses: []string{api.StatusShown, api.StatusHidden, api.StatusDisabled},
+		Search:   search,
+		Selected: search.Get("status"),
+		Query:    template.URL(search.Encode()),
+		Total:    found.Total,
+		Page:     page,
+	}
+	if page > 1 {
+		data.PrevPage = page - 1
+	}
+	if page*adminPageSize < found.Total {
+		data.NextPage = page + 1
+	}
+
+	s.pages.ExecuteTemplate(res, "adminUsers.gohtml", data)
+}
+
+// AdminUser page show a user to an admin with the open reports and the activity history, a POST
+// hides or shows the profile, disables or enables the account, logs the user out everywhere
+// or resets the two-factor authentication
+func (s *Server) AdminUser(res http.ResponseWriter, req *http.Request) {
+	admin, ok := s.adminUser(res, req)
+	if !ok {
+		return
+	}
+	username := mux.Vars(req)["username"]
+	userPath := "/users/" + url.PathEscape(username)
+
+	if req.Method == http.MethodPost {
+		if !sameOrigin(req) {
+			http.Error(res, "Forbidden", http.StatusForbidden)
+			return
+		}
+		yes, no := true, false
+		var err error
+		switch req.FormValue("action") {
+		case "hide":
+			err = s.adminChange(req, admin, username, api.AdminChange{Hidden: &yes})
+		case "show":
+			err = s.adminChange(req, admin, username, api.AdminChange{Hidden: &no})
+		case "disable":
+			err = s.adminChange(req, admin, username, api.AdminChange{Disabled: &yes})
+			// the other instances end theirs on the next page the user opens
+			s.sessions.DeleteUser(username)
+		case "enable":
+			err = s.adminChange(req, admin, username, api.AdminChange{Disabled: &no})
+		case "logout":
+			var status int
+			status, err = s.adminAPI(req, admin, http.MethodDelete, userPath+"/key", nil, nil, nil)
+			if err == nil && status != http.StatusOK {
+				err = fmt.Errorf("admin api answered %d", status)
+			}
+			s.sessions.DeleteUser(username)
+		case "reset2fa":
+			var status int
+			status, err = s.adminAPI(req, admin, http.MethodDelete, "/2fa/"+url.PathEscape(username), nil, nil, nil)
+			if err == nil && status != http.StatusOK {
+				err = fmt.Errorf("admin api answered %d", status)
+			}
+		default:
+			http.Error(res, "Unknown action", http.StatusBadRequest)
+			return
+		}
+		if err != nil {
+			slog.ErrorContext(req.Context(), "changing user", "username", username, "action", req.FormValue("action"), "error", err)
+			http.Error(res, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+		http.Redirect(res, req, "/admin/users/"+url.PathEscape(username), http.StatusSeeOther)
+		return
+	}
+
+	var user api.ManagedUser
+	status, err := s.adminAPI(req, admin, http.MethodGet, userPath, nil, nil, &user)
+	if status == http.StatusNotFound {
+		http.NotFound(res, req)
+		return
+	}
+	if err == nil && status != http.StatusOK {
+		err = fmt.Errorf("admin api answered %d", status)
+	}
+	if err != nil {
+		slog.ErrorContext(req.Context(), "reading user", "username", username, "error", err)
+		http.Error(res, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	open, err := s.reports.Open(username)
+	if err != nil {
+		slog.ErrorContext(req.Context(), "reading reports", "error", err)
+	}
+
+	page, _ := strconv.Atoi(req.FormValue("page"))
+	if page < 1 {
+		page = 1
+	}
+	req.ParseForm()
+	search := url.Values{}
+	for _, k := range []string{"kind", "q", "from", "to"} {
+		for _, v := range req.Form[k] {
+			search.Add(k, v)
+		}
+	}
+	history, total, err := s.activities.Search(username, queue.QueryFromValues(search), (page-1)*activityPageSize, activityPageSize)
+	if err != nil {
+		slog.ErrorContext(req.Context(), "searching activity", "error", err)
+		http.Error(res, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	data := struct {
+		User     api.ManagedUser
+		Reports  []report.Report
+		History  []queue.History
+		Kinds    []queue.Kind
+		Search   url.Values
+		Selected string
+		Query    template.URL
+		Page     int
+		PrevPage int
+		NextPage int
+	}{
+		User:     user,
+		Reports:  open,
+		History:  history,
+		Kinds:    queue.Kinds,
+		Search:   search,
+		Selected: search.Get("kind"),
+		Query:    template.URL(search.Encode()),
+		Page:     page,
+	}
+	if page > 1 {
+		data.PrevPage = page - 1
+	}
+	if page*activityPageSize < total {
+		data.NextPage = page + 1
+	}
+
+	s.pages.ExecuteTemplate(res, "adminUser.gohtml", data)
+}
+
+// AdminReports page show the reported profiles, the ones reported by the most users first. A POST
+// closes the reports of a profile, dismissing them or hiding the profile or disabling the account.
+func (s *Server) AdminReports(res http.ResponseWriter, req *http.Request) {
+	admin, ok := s.adminUser(res, req)
+	if !ok {
+		return
+	}
+
+	if req.Method == http.MethodPost {
+		if !sameOrigin(req) {
+			http.Error(res, "Forbidden", http.StatusForbidden)
+			return
+		}
+		target := req.FormValue("target")
+		yes, no := true, false
+		var outcome report.Outcome
+		var err error
+		switch req.FormValue("action") {
+		case "dismiss":
+			outcome = report.Dismissed
+			// put back a profile the reports hid on their own
+			var open []report.Report
+			open, err = s.reports.Open(target)
+			if err == nil && s.hideAfter > 0 && (report.Case{Target: target, Reports: open}).Reporters() >= s.hideAfter {
+				err = s.adminChange(req, admin, target, api.AdminChange{Hidden: &no})
+			}
+		case "hide":
+			outcome = report.Hidden
+			err = s.adminChange(req, admin, target, api.AdminChange{Hidden: &yes})
+		case "disable":
+			outcome = report.Disabled
+			err = s.adminChange(req, admin, target, api.AdminChange{Disabled: &yes})
+			s.sessions.DeleteUser(target)
+		default:
+			http.Error(res, "Unknown action", http.StatusBadRequest)
+			return
+		}
+		if err == nil {
+			var closed int
+			closed, err = s.reports.Resolve(target, outcome, admin.Username, time.Now())
+			if err == nil && closed > 0 {
+				if err := s.audit.Record(admin.Username, audit.ReportResolve, target, s.clientIP(req),
+					[]audit.Change{{Field: "Outcome", After: string(outcome)}}); err != nil {
+					slog.ErrorContext(req.Context(), "recording audit entry", "action", audit.ReportResolve, "error", err)
+				}
+			}
+		}
+		if err != nil {
+			slog.ErrorContext(req.Context(), "resolving reports", "target", target, "error", err)
+			http.Error(res, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+		http.Redirect(res, req, "/admin/reports", http.StatusSeeOther)
+		return
+	}
+
+	page, _ := strconv.Atoi(req.FormValue("page"))
+	if page < 1 {
+		page = 1
+	}
+	cases, total, err := s.reports.Cases((page-1)*adminPageSize, adminPageSize)
+	if err != nil {
+		slog.ErrorContext(req.Context(), "reading reports", "error", err)
+		http.Error(res, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	data := struct {
+		Cases    []report.Case
+		Total    int
+		Page     int
+		PrevPage int
+		NextPage int
+	}{
+		Cases: cases,
+		Total: total,
+		Page:  page,
+	}
+	if page > 1 {
+		data.PrevPage = page - 1
+	}
+	if page*adminPageSize < total {
+		data.NextPage = page + 1
+	}
+
+	s.pages.ExecuteTemplate(res, "adminReports.gohtml", data)
+}
+
+// AdminTaxonomy page lists the job types, categories and skills to the admins, a POST adds,
+// renames or removes a name. The users keep their picks through a rename and lose them on a remove.
+func (s *Server) AdminTaxonomy(res http.ResponseWriter, req *http.Request) {
+	admin, ok := s.adminUser(res, req)
+	if !ok {
+		return
+	}
+
+	problem := ""
+	if req.Method == http.MethodPost {
+		if !sameOrigin(req) {
+			http.Error(res, "Forbidden", http.StatusForbidden)
+			return
+		}
+		kind := taxonomy.Kind(req.FormValue("kind"))
+		if !kind.Valid() {
+			http.Error(res, "Unknown list", http.StatusBadRequest)
+			return
+		}
+		name := req.FormValue("name")
+		var action audit.Action
+		var changes []audit.Change
+		var err, invalid error
+		switch req.FormValue("action") {
+		case "add":
+			if name, invalid = taxonomy.Clean(name); invalid == nil {
+				category := req.FormValue("category")
+				err = s.taxonomy.Add(kind, name, category)
+				changes = []audit.Change{{Field: "Name", After: name}}
+				if kind == taxonomy.Skill {
+					changes = append(changes, audit.Change{Field: "Category", After: category})
+				}
+			}
+			action = audit.TaxonomyAdd
+		case "rename":
+			var to string
+			if to, invalid = taxonomy.Clean(req.FormValue("to")); invalid == nil {
+				err = s.taxonomy.Rename(kind, name, to)
+				changes = []audit.Change{{Field: "Name", Before: name, After: to}}
+			}
+			action = audit.TaxonomyRename
+		case "remove":
+			err = s.taxonomy.Remove(kind, name)
+			changes = []audit.Change{{Field: "Name", Before: name}}
+			action = audit.TaxonomyRemove
+		default:
+			http.Error(res, "Unknown action", http.StatusBadRequest)
+			return
+		}
+
+		switch {
+		case invalid != nil:
+			problem = invalid.Error()
+		case err == taxonomy.ErrExists, err == taxonomy.ErrNotFound:
+			problem = fmt.Sprintf("%s %s", kind.Label(), err)
+		case err != nil:
+			slog.ErrorContext(req.Context(), "changing taxonomy", "kind", kind, "error", err)
+			http.Error(res, "Internal server error", http.StatusInternalServerError)
+			return
+		default:
+			if err := s.audit.Record(admin.Username, action, string(kind), s.clientIP(req), changes); err != nil {
+				slog.ErrorContext(req.Context(), "recording audit entry", "action", action, "error", err)
+			}
+			http.Redirect(res, req, "/admin/taxonomy", http.StatusSeeOther)
+			return
+		}
+	}
+
+	lists, err := s.taxonomy.Taxonomy()
+	if err != nil {
+		slog.ErrorContext(req.Context(), "reading taxonomy", "error", err)
+		http.Error(res, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	if problem != "" {
+		res.WriteHeader(http.StatusUnprocessableEntity)
+	}
+	s.pages.ExecuteTemplate(res, "adminTaxonomy.gohtml", struct {
+		taxonomy.Taxonomy
+		Error string
+	}{lists, problem})
+}
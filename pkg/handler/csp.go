@@ -0,0 +1,13 @@
+package handler
+
+// MapPolicy is the Content-Security-Policy of the index page. The map scripts carry the nonce
+// of the request and 'strict-dynamic' lets the scripts Google Maps loads run, the rest follows
+// the allowlist Google Maps documents.
+const MapPolicy = "script-src 'nonce-{nonce}' 'strict-dynamic' https: 'unsafe-eval' blob:; " +
+	"style-src 'self' 'unsafe-inline' https://fonts.googleapis.com; " +
+	"img-src 'self' data: https://*.googleapis.com https://*.gstatic.com *.google.com *.googleusercontent.com https://cdn.discordapp.com; " +
+	"font-src https://fonts.gstatic.com; " +
+	"connect-src 'self' https://*.googleapis.com *.google.com https://*.gstatic.com data: blob:; " +
+	"frame-src *.google.com; " +
+	"worker-src blob:; " +
+	"default-src 'self'; object-src 'none'; base-uri 'self'; form-action 'self'; frame-ancestors 'none'"
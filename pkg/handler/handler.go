@@ -3,40 +3,41 @@ package handler
 import (
 	"bytes"
 	"context"
-	"crypto/tls"
+	"encoding/csv"
 	"encoding/json"
 	"fmt"
+	"html/template"
+	"io"
 	"io/ioutil"
-	"log"
+	"log/slog"
 	"net/http"
-	"os"
-	"sort"
+	"net/url"
+	"path/filepath"
 	"strconv"
 	"strings"
 	"sync"
-	"text/template"
 	"time"
 
-	"github.com/joho/godotenv"
+	"github.com/teojiahao/HireMe/pkg/alert"
+	"github.com/teojiahao/HireMe/pkg/api"
 	"github.com/teojiahao/HireMe/pkg/database"
+	"github.com/teojiahao/HireMe/pkg/email"
+	"github.com/teojiahao/HireMe/pkg/headers"
 	"github.com/teojiahao/HireMe/pkg/queue"
-	"github.com/teojiahao/HireMe/pkg/security"
+	"github.com/teojiahao/HireMe/pkg/taxonomy"
+	"github.com/teojiahao/HireMe/pkg/tracing"
 
 	"github.com/microcosm-cc/bluemonday"
-	"googlemaps.github.io/maps"
+	"go.opentelemetry.io/otel/attribute"
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
 )
 
-var (
-	tpl         *template.Template
-	mapSessions = map[string]Session{}
-	baseURL     string
-	jobType     []string
-	jobCategory []string
-	mapHistory  = map[string]*queue.Queue{}
-	mapMutex    sync.RWMutex
-	wg          sync.WaitGroup
-	bm          = bluemonday.UGCPolicy()
-)
+// sanitizes what users type in, it keeps no state between requests
+var bm = bluemonday.UGCPolicy()
+
+// number of history shown per activity page
+const activityPageSize = 10
 
 // Session struct
 type Session struct {
@@ -44,210 +45,394 @@ type Session struct {
 	Accesskey string
 }
 
-// init load up env file
-func init() {
-	err := godotenv.Load()
+// pages holds every page parsed along with the shared layout
+type pages map[string]*template.Template
+
+// functions the pages can use
+var templateFuncs = template.FuncMap{
+	"rich": richText,
+	// the picks of a profile
+	"join": func(names []string) string { return strings.Join(names, ", ") },
+	"has":  func(names []string, name string) bool { return taxonomy.Any(names, []string{name}) },
+}
+
+// richText marks the few fields that may carry formatting as safe html. It is sanitized and parsed
+// again so a tag left open or a stray closing tag cannot change the page around it.
+func richText(s string) template.HTML {
+	nodes, err := html.ParseFragment(strings.NewReader(bm.Sanitize(s)), &html.Node{
+		Type:     html.ElementNode,
+		Data:     "div",
+		DataAtom: atom.Div,
+	})
 	if err != nil {
-		log.Fatal("Error loading .env file")
+		return template.HTML(template.HTMLEscapeString(s))
 	}
+	var b bytes.Buffer
+	for _, node := range nodes {
+		html.Render(&b, node)
+	}
+	return template.HTML(b.String())
+}
 
-	baseURL = os.Getenv("API")
-	jobType = []string{"Full–time", "Part-time", "Contractor", "Internship"}
-	jobCategory = []string{"Restaurant and Hospitality", "Sales and Retail", "Education", "Admin and Office", "Healthcare", "Cleaning and Facilities", "Transportation and Logistics", "Manufacturing and Warehouse", "Customer Service", "Personal Care and Services", "Art, Fashion and Design", "Human Resources", "Advertising and Marketing", "Management", "Accounting and Finance", "Business Operations", "Protective Services", "Science and Engineering", "Animal Care", "Computer and IT", "Sports Fitness and Recreation", "Installation, Maintenance and Repair", "Legal", "Media, Communications and Writing", "Construction", "Entertainment and Travel", "Farming and Outdoors", "Energy and Mining", "Property", "Social Services and Non-Profit"}
-	sort.Strings(jobCategory)
+// parsePages parses every page in dir with layout.gohtml, a page fills in the title,
+// head and content templates of the layout
+func parsePages(dir string) (pages, error) {
+	layout, err := template.New("layout.gohtml").Funcs(templateFuncs).ParseFiles(filepath.Join(dir, "layout.gohtml"))
+	if err != nil {
+		return nil, err
+	}
+	files, err := filepath.Glob(filepath.Join(dir, "*.gohtml"))
+	if err != nil {
+		return nil, err
+	}
 
-	tpl = template.Must(template.ParseGlob("templates/*"))
-	http.DefaultTransport.(*http.Transport).TLSClientConfig = &tls.Config{InsecureSkipVerify: true}
+	p := pages{}
+	for _, file := range files {
+		name := filepath.Base(file)
+		if name == "layout.gohtml" {
+			continue
+		}
+		page, err := template.Must(layout.Clone()).ParseFiles(file)
+		if err != nil {
+			return nil, err
+		}
+		p[name] = page
+	}
+	return p, nil
 }
 
-func checkSubstrings(str string, subs []string) bool {
-	for _, sub := range subs {
-		if strings.Contains(str, sub) {
-			return true
-		}
+// ExecuteTemplate renders the page inside the layout
+func (p pages) ExecuteTemplate(w io.Writer, name string, data interface{}) error {
+	page, ok := p[name]
+	if !ok {
+		return fmt.Errorf("page %s not found", name)
 	}
-	return false
+	err := page.ExecuteTemplate(w, "layout", data)
+	if err != nil {
+		slog.Error("rendering page", "page", name, "error", err)
+	}
+	return err
+}
+
+// userFilter drops the users failing any of the filters, each filter runs in its own goroutine
+type userFilter struct {
+	users map[string]database.UserJSON
+	mutex sync.RWMutex
+	wg    sync.WaitGroup
+}
+
+// run removes the users keep return false for
+func (f *userFilter) run(keep func(v database.UserJSON) bool) {
+	f.wg.Add(1)
+	go func() {
+		defer f.wg.Done()
+		drop := []string{}
+		f.mutex.RLock()
+		for k, v := range f.users {
+			if !keep(v) {
+				drop = append(drop, k)
+			}
+		}
+		f.mutex.RUnlock()
+
+		f.mutex.Lock()
+		for _, k := range drop {
+			delete(f.users, k)
+		}
+		f.mutex.Unlock()
+	}()
+}
+
+// wait for every filter to finish
+func (f *userFilter) wait() {
+	f.wg.Wait()
 }
 
-func safeMapDelete(filterUser map[string]database.UserJSON, username string) {
-	mapMutex.Lock()
-	delete(filterUser, username)
-	mapMutex.Unlock()
+// return the number of days since the date, false when it is not a date
+func daysSince(date string) (int, bool) {
+	then, err := time.Parse("2006-01-02", date)
+	if err != nil {
+		return 0, false
+	}
+	return int(time.Since(then).Hours() / 24), true
 }
 
 // Index page is the main feature of this application
-func Index(res http.ResponseWriter, req *http.Request) {
-	myUser := getUserFromCookie(res, req)
+func (s *Server) Index(res http.ResponseWriter, req *http.Request) {
+	myUser := s.getUserFromCookie(res, req)
 
-	userJSON := getUsers("", "")
+	// the key lets the api give the emails to a user with two-factor authentication
+	userJSON := s.getUsers(req.Context(), "", url.QueryEscape(myUser.Accesskey))
 	filterUser := map[string]database.UserJSON{}
 	err := json.Unmarshal([]byte(userJSON), &filterUser)
 	if err != nil {
-		log.Println(err)
+		slog.ErrorContext(req.Context(), "reading users", "error", err)
 	}
 
-	activity := ""
 	req.ParseForm()
+	_, span := tracing.Start(req.Context(), "index filter", attribute.Int("users", len(filterUser)))
+	criteria := map[string][]string{}
+	// every request filters its own copy, so the filters of one never wait on another
+	filter := &userFilter{users: filterUser}
+	// a user is kept when they picked any of the names checked, names are compared whole
 	if len(req.Form["Type"]) > 0 {
 		jType := req.Form["Type"]
-		wg.Add(1)
-		go func() {
-			mapMutex.RLock()
-			for k, v := range filterUser {
-				if !checkSubstrings(v.JobType, jType) {
-					mapMutex.RUnlock()
-					safeMapDelete(filterUser, k)
-					mapMutex.RLock()
-				}
-			}
-			activity += strings.Join(jType, ", ") + " "
-
-			mapMutex.RUnlock()
-			wg.Done()
-		}()
+		criteria["type"] = jType
+		filter.run(func(v database.UserJSON) bool { return taxonomy.Any(v.JobTypes, jType) })
 	}
 
 	if len(req.Form["Category"]) > 0 {
 		cat := req.Form["Category"]
-		wg.Add(1)
-		go func() {
-			mapMutex.RLock()
-			for k, v := range filterUser {
-				if !checkSubstrings(v.Skill, cat) {
-					mapMutex.RUnlock()
-					safeMapDelete(filterUser, k)
-					mapMutex.RLock()
-				}
-			}
+		criteria["category"] = cat
+		filter.run(func(v database.UserJSON) bool { return taxonomy.Any(v.Categories, cat) })
+	}
 
-			activity += strings.Join(cat, ", ") + " "
-			mapMutex.RUnlock()
-			wg.Done()
-		}()
+	if len(req.Form["Skill"]) > 0 {
+		skill := req.Form["Skill"]
+		criteria["skill"] = skill
+		filter.run(func(v database.UserJSON) bool { return taxonomy.Any(v.Skills, skill) })
 	}
 
 	if req.FormValue("exp") != "" {
 		exp, _ := strconv.Atoi(bm.Sanitize(req.FormValue("exp")))
-		wg.Add(1)
-		go func() {
-			mapMutex.RLock()
-			for k, v := range filterUser {
-				if v.Exp < exp {
-					mapMutex.RUnlock()
-					safeMapDelete(filterUser, k)
-					mapMutex.RLock()
-				}
-			}
-			activity += bm.Sanitize(req.FormValue("exp")) + "Years Of Exp "
-			mapMutex.RUnlock()
-			wg.Done()
-		}()
+		criteria["exp"] = []string{strconv.Itoa(exp)}
+		filter.run(func(v database.UserJSON) bool { return v.Exp >= exp })
 	}
 
 	if req.FormValue("uDays") != "" {
 		uDays, _ := strconv.Atoi(req.FormValue("uDays"))
-		wg.Add(1)
-		go func() {
-			mapMutex.RLock()
-			for k, v := range filterUser {
-				if v.UnemployedDate != "" {
-					then, err := time.Parse("2006-01-02", v.UnemployedDate)
-					if err != nil {
-						log.Println(err)
-						return
-					}
-					duration := time.Since(then)
-					durationDays := int(duration.Hours() / 24)
-
-					dateToDays := v
-					dateToDays.UnemployedDate = fmt.Sprintf("%s (%v Days)", v.UnemployedDate, durationDays)
-					filterUser[k] = dateToDays
-
-					if durationDays < uDays {
-						mapMutex.RUnlock()
-						safeMapDelete(filterUser, k)
-						mapMutex.RLock()
-					}
-				}
-			}
-			activity += req.FormValue("uDays") + "Days unemployed"
-			mapMutex.RUnlock()
-			wg.Done()
-		}()
+		criteria["uDays"] = []string{strconv.Itoa(uDays)}
+		filter.run(func(v database.UserJSON) bool {
+			days, ok := daysSince(v.UnemployedDate)
+			return !ok || days >= uDays
+		})
 	}
 
 	if req.FormValue("keyword") != "" {
 		keyword := bm.Sanitize(req.FormValue("keyword"))
-		wg.Add(1)
-		go func() {
-			mapMutex.RLock()
-			for k, v := range filterUser {
-				if !strings.Contains(strings.ToLower(v.Message), strings.ToLower(keyword)) {
-					mapMutex.RUnlock()
-					safeMapDelete(filterUser, k)
-					mapMutex.RLock()
-				}
+		criteria["keyword"] = []string{keyword}
+		filter.run(func(v database.UserJSON) bool {
+			return strings.Contains(strings.ToLower(v.Message), strings.ToLower(keyword))
+		})
+	}
+	filter.wait()
+	span.SetAttributes(attribute.Int("users.kept", len(filterUser)))
+	span.End()
+
+	// show how long the users left have been looking for a job
+	if req.FormValue("uDays") != "" {
+		for k, v := range filterUser {
+			if days, ok := daysSince(v.UnemployedDate); ok {
+				v.UnemployedDate = fmt.Sprintf("%s (%v Days)", v.UnemployedDate, days)
+				filterUser[k] = v
 			}
-			activity += keyword + " "
-			mapMutex.RUnlock()
-			wg.Done()
-		}()
+		}
+	}
+	if len(criteria) > 0 && myUser.Username != "" {
+		s.recordActivity(req, myUser.Username, queue.Filter, criteria)
+	}
+
+	// contact details are only shown to users with two-factor authentication when it is required
+	contactHidden := s.twoFactorRequired
+	if contactHidden && myUser.Username != "" {
+		enabled, err := s.twoFactor.Enabled(myUser.Username)
+		if err != nil {
+			slog.ErrorContext(req.Context(), "checking two-factor", "error", err)
+		}
+		contactHidden = !enabled
 	}
-	wg.Wait()
-	if len(req.Form["Type"]) > 0 || len(req.Form["Category"]) > 0 || req.FormValue("exp") != "" || req.FormValue("uDays") != "" || req.FormValue("keyword") != "" {
-		if _, ok := mapHistory[myUser.Username]; ok {
-			currentTime := time.Now()
-			mapHistory[myUser.Username].Enqueue(queue.History{Time: fmt.Sprintf(currentTime.Format("2006-01-02 3:04PM")), Activity: "Filter: " + activity})
+	if contactHidden {
+		for k, v := range filterUser {
+			if k != myUser.Username {
+				v.Email = ""
+				filterUser[k] = v
+			}
 		}
 	}
 
+	lists, err := s.taxonomy.Taxonomy()
+	if err != nil {
+		slog.ErrorContext(req.Context(), "reading taxonomy", "error", err)
+	}
+
 	data := struct {
-		MyUser      string
-		AllUser     map[string]database.UserJSON
-		Type        []string
-		Category    []string
-		GoogleAPI   string
-		GoogleMapID string
+		MyUser        string
+		AllUser       map[string]database.UserJSON
+		Type          []string
+		Category      []string
+		Skills        map[string][]string
+		GoogleAPI     string
+		GoogleMapID   string
+		ContactHidden bool
+		Nonce         string
 	}{
 		myUser.Username,
 		filterUser,
-		jobType,
-		jobCategory,
-		os.Getenv("GOOGLE_API"),
-		os.Getenv("GOOGLE_MAP_ID"),
+		lists.JobTypes,
+		lists.Categories,
+		lists.Skills,
+		s.googleAPI,
+		s.googleMapID,
+		contactHidden,
+		headers.Nonce(req),
 	}
 
-	tpl.ExecuteTemplate(res, "index.gohtml", data)
+	_, span = tracing.Start(req.Context(), "render index.gohtml")
+	defer span.End()
+	s.pages.ExecuteTemplate(res, "index.gohtml", data)
+}
+
+// return the ip of the client, X-Forwarded-For is only read when a trusted proxy sent the request
+func (s *Server) clientIP(req *http.Request) string {
+	return s.proxies.ClientIP(req)
 }
 
-// reverse the slice of history for html display
-func reverse(history []queue.History) []queue.History {
-	for i, j := 0, len(history)-1; i < j; i, j = i+1, j-1 {
-		history[i], history[j] = history[j], history[i]
+// record the activity of the user, failing to do so should not fail the request
+func (s *Server) recordActivity(req *http.Request, username string, kind queue.Kind, payload map[string][]string) {
+	h := queue.History{
+		Kind:      kind,
+		Time:      time.Now(),
+		IP:        s.clientIP(req),
+		UserAgent: req.UserAgent(),
+		Payload:   payload,
+	}
+
+	// look at the login before it becomes part of the history it is compared with
+	if s.detector != nil && (kind == queue.LoginSuccess || kind == queue.LoginFailure) {
+		alerts, err := s.detector.Inspect(username, h)
+		if err != nil {
+			slog.ErrorContext(req.Context(), "inspecting login", "username", username, "error", err)
+		}
+		// sending mail can be slow so do not hold up the login
+		go func() {
+			for _, a := range alerts {
+				if err := s.notifier.Notify(a); err != nil {
+					slog.ErrorContext(req.Context(), "sending alert", "username", username, "error", err)
+				}
+			}
+		}()
+	}
+
+	if err := s.activities.Add(username, h); err != nil {
+		slog.ErrorContext(req.Context(), "recording activity", "username", username, "error", err)
 	}
-	return history
 }
 
-// Activity page
-func Activity(res http.ResponseWriter, req *http.Request) {
-	myUser := getUserFromCookie(res, req)
+// Activity page show the user history newest first, a page at a time,
+// along with the flagged logins the user can confirm as their own
+func (s *Server) Activity(res http.ResponseWriter, req *http.Request) {
+	myUser := s.getUserFromCookie(res, req)
+
+	if req.Method == http.MethodPost && myUser.Username != "" {
+		if err := s.alerts.Confirm(myUser.Username, req.FormValue("alert")); err != nil {
+			http.Error(res, "Alert not found", http.StatusNotFound)
+			return
+		}
+		http.Redirect(res, req, "/activity", http.StatusSeeOther)
+		return
+	}
+
+	page, _ := strconv.Atoi(req.FormValue("page"))
+	if page < 1 {
+		page = 1
+	}
+	req.ParseForm()
+	query := queue.QueryFromValues(req.Form)
+	// keep the search when moving between pages and exporting
+	search := url.Values{}
+	for _, k := range []string{"kind", "q", "from", "to"} {
+		for _, v := range req.Form[k] {
+			search.Add(k, v)
+		}
+	}
+
 	allActivity := []queue.History{}
+	pending := []alert.Alert{}
+	total := 0
+	if myUser.Username != "" {
+		var err error
+		allActivity, total, err = s.activities.Search(myUser.Username, query, (page-1)*activityPageSize, activityPageSize)
+		if err != nil {
+			slog.ErrorContext(req.Context(), "searching activity", "error", err)
+			http.Error(res, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+		pending, err = s.alerts.Pending(myUser.Username)
+		if err != nil {
+			slog.ErrorContext(req.Context(), "reading alerts", "error", err)
+		}
+	}
 
-	if _, ok := mapHistory[myUser.Username]; ok {
-		allActivity = mapHistory[myUser.Username].AllHistory()
+	data := struct {
+		Alerts   []alert.Alert
+		History  []queue.History
+		Kinds    []queue.Kind
+		Search   url.Values
+		Selected string
+		Query    template.URL
+		Page     int
+		PrevPage int
+		NextPage int
+	}{
+		Alerts:   pending,
+		History:  allActivity,
+		Kinds:    queue.Kinds,
+		Search:   search,
+		Selected: search.Get("kind"),
+		Query:    template.URL(search.Encode()),
+		Page:     page,
+	}
+	if page > 1 {
+		data.PrevPage = page - 1
+	}
+	if page*activityPageSize < total {
+		data.NextPage = page + 1
 	}
 
-	tpl.ExecuteTemplate(res, "activity.gohtml", reverse(allActivity))
+	s.pages.ExecuteTemplate(res, "activity.gohtml", data)
+}
+
+// ActivityExport download the whole user history matching the search as csv or json
+func (s *Server) ActivityExport(res http.ResponseWriter, req *http.Request) {
+	if !s.alreadyLoggedIn(req) {
+		http.Redirect(res, req, "/", http.StatusSeeOther)
+		return
+	}
+	myUser := s.getUserFromCookie(res, req)
+
+	req.ParseForm()
+	allActivity, _, err := s.activities.Search(myUser.Username, queue.QueryFromValues(req.Form), 0, 0)
+	if err != nil {
+		slog.ErrorContext(req.Context(), "exporting activity", "error", err)
+		http.Error(res, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	if req.FormValue("format") == "csv" {
+		res.Header().Set("Content-Type", "text/csv")
+		res.Header().Set("Content-Disposition", `attachment; filename="activity.csv"`)
+		w := csv.NewWriter(res)
+		w.Write([]string{"Time", "Kind", "IP", "User Agent", "Details"})
+		for _, h := range allActivity {
+			w.Write([]string{h.Time.Format(time.RFC3339), string(h.Kind), h.IP, h.UserAgent, h.Summary()})
+		}
+		w.Flush()
+		return
+	}
+
+	res.Header().Set("Content-Type", "application/json")
+	res.Header().Set("Content-Disposition", `attachment; filename="activity.json"`)
+	json.NewEncoder(res).Encode(allActivity)
 }
 
 // UpdateProfile page helps user to plot on the google map with its details
-func UpdateProfile(res http.ResponseWriter, req *http.Request) {
-	if !alreadyLoggedIn(req) {
+func (s *Server) UpdateProfile(res http.ResponseWriter, req *http.Request) {
+	if !s.alreadyLoggedIn(req) {
 		http.Redirect(res, req, "/", http.StatusSeeOther)
 		return
 	}
 
-	myUser := getUserFromCookie(res, req)
+	myUser := s.getUserFromCookie(res, req)
 
 	if req.Method == http.MethodPost {
 		options := req.FormValue("options")
@@ -257,13 +442,16 @@ func UpdateProfile(res http.ResponseWriter, req *http.Request) {
 			postal := bm.Sanitize(req.FormValue("postal"))
 			jobType := req.Form["Type"]
 			category := req.Form["Category"]
+			skill := req.Form["Skill"]
 			exp, _ := strconv.Atoi(bm.Sanitize(req.FormValue("exp")))
 			lastDay := bm.Sanitize(req.FormValue("lastDay"))
-			message := bm.Sanitize(req.FormValue("message"))
-			email := bm.Sanitize(req.FormValue("email"))
+			// the api checks the message as typed and the pages escape it when shown
+			message := req.FormValue("message")
+			// email.Validate only lets through a valid address, sanitizing would change one like o'brien@example.com
+			emailAddress := req.FormValue("email")
 
 			// check if postal code valid
-			x, y, err := getCoordFromPostal(postal)
+			x, y, err := s.geocoder.Geocode(req.Context(), postal)
 			if err != nil {
 				http.Error(res, "Invalid Postal Code", http.StatusForbidden)
 				return
@@ -291,7 +479,7 @@ func UpdateProfile(res http.ResponseWriter, req *http.Request) {
 			// check if selected date valid
 			then, err := time.Parse("2006-01-02", lastDay)
 			if err != nil {
-				log.Println(err)
+				slog.WarnContext(req.Context(), "invalid last day of work", "error", err)
 				return
 			}
 			duration := time.Since(then)
@@ -302,23 +490,26 @@ func UpdateProfile(res http.ResponseWriter, req *http.Request) {
 				return
 			}
 
-			//check email
-			if err := security.CheckEmail(email); err != nil {
+			//check email and keep it normalized
+			address, err := email.Validate(emailAddress, s.disposable)
+			if err != nil {
 				http.Error(res, fmt.Sprintf("%v", err), http.StatusForbidden)
 				return
 			}
 
-			jsonValue, _ = json.Marshal(database.User{
-				Username:       myUser.Username,
-				Display:        options,
-				CoordX:         x,
-				CoordY:         y,
-				JobType:        strings.Join(jobType, ", "),
-				Skill:          strings.Join(category, ", "),
-				Exp:            exp,
-				UnemployedDate: lastDay,
-				Message:        message,
-				Email:          email,
+			// the api checks the picks against the lists
+			jsonValue, _ = json.Marshal(api.ProfileRequest{
+				User: database.User{
+					Username:       myUser.Username,
+					Display:        options,
+					CoordX:         x,
+					CoordY:         y,
+					Exp:            exp,
+					UnemployedDate: lastDay,
+					Message:        message,
+					Email:          address.String(),
+				},
+				Selection: taxonomy.Selection{JobTypes: jobType, Categories: category, Skills: skill},
 			})
 		} else {
 			jsonValue, _ = json.Marshal(database.User{
@@ -327,62 +518,99 @@ func UpdateProfile(res http.ResponseWriter, req *http.Request) {
 			})
 		}
 
-		request, err := http.NewRequest(http.MethodPatch, baseURL+"/"+myUser.Username+"?accessKey="+myUser.Accesskey, bytes.NewBuffer(jsonValue))
+		request, err := http.NewRequestWithContext(req.Context(), http.MethodPatch, s.baseURL+"/"+myUser.Username+"?accessKey="+myUser.Accesskey, bytes.NewBuffer(jsonValue))
+		if err != nil {
+			slog.ErrorContext(req.Context(), "updating profile", "error", err)
+			http.Error(res, "Internal server error", http.StatusInternalServerError)
+			return
+		}
 		request.Header.Set("Content-Type", "application/json")
-		client := &http.Client{}
-		_, err = client.Do(request)
+		// the api records the change against the ip of the user, not this server
+		request.Header.Set("X-Forwarded-For", s.clientIP(req))
+		response, err := s.client.Do(request)
 		if err != nil {
+			slog.ErrorContext(req.Context(), "updating profile", "error", err)
 			http.Error(res, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+		body, _ := ioutil.ReadAll(response.Body)
+		response.Body.Close()
+		if response.StatusCode == http.StatusUnprocessableEntity {
+			http.Error(res, apiMessage(body), http.StatusForbidden)
+			return
+		}
+		// nothing was saved, so it is neither recorded nor shown as done, the api says why when it can
+		if response.StatusCode != http.StatusOK {
+			slog.WarnContext(req.Context(), "profile update refused by the api", "status", response.StatusCode)
+			message := "Your profile could not be saved"
+			if response.StatusCode == http.StatusInternalServerError && len(body) > 0 {
+				message = apiMessage(body)
+			}
+			http.Error(res, message, http.StatusInternalServerError)
+			return
 		}
 
-		currentTime := time.Now()
-		mapHistory[myUser.Username].Enqueue(queue.History{Time: fmt.Sprintf(currentTime.Format("2006-01-02 3:04PM")), Activity: "Updated Profile"})
+		s.recordActivity(req, myUser.Username, queue.ProfileUpdate, map[string][]string{"display": {options}})
 
 		// redirect to main index
 		http.Redirect(res, req, "/", http.StatusSeeOther)
 		return
 	}
 
+	lists, err := s.taxonomy.Taxonomy()
+	if err != nil {
+		slog.ErrorContext(req.Context(), "reading taxonomy", "error", err)
+	}
+	// the form starts with what the user picked last
+	picked, err := s.taxonomy.Picked(myUser.Username)
+	if err != nil {
+		slog.ErrorContext(req.Context(), "reading job picks", "error", err)
+	}
+
 	data := struct {
-		Type     []string
-		Category []string
+		Type       []string
+		Category   []string
+		Skills     map[string][]string
+		Picked     taxonomy.Selection
+		MaxMessage int
 	}{
-		jobType,
-		jobCategory,
+		lists.JobTypes,
+		lists.Categories,
+		lists.Skills,
+		picked,
+		s.messages.MaxLength,
 	}
 
-	tpl.ExecuteTemplate(res, "updateProfile.gohtml", data)
+	s.pages.ExecuteTemplate(res, "updateProfile.gohtml", data)
 }
 
-func getCoordFromPostal(postal string) (float64, float64, error) {
-	c, err := maps.NewClient(maps.WithAPIKey(os.Getenv("GOOGLE_API")))
-	if err != nil {
-		log.Fatalf("fatal error: %s", err)
-	}
-	r := &maps.GeocodingRequest{
-		Address: postal,
-		Region:  "SG",
+// return the explanation the api gives after the status, e.g. "422 - Message cannot contain links"
+func apiMessage(body []byte) string {
+	message := string(body)
+	if i := strings.Index(message, " - "); i >= 0 {
+		message = message[i+3:]
 	}
-	resp, err := c.Geocode(context.Background(), r)
-	if len(resp) == 0 {
-		return 0, 0, fmt.Errorf("invalid postal code")
-	}
-	return resp[0].Geometry.Location.Lat, resp[0].Geometry.Location.Lng, nil
+	return message
 }
 
 // Accessing the REST API and return back the JSON as string
-func getUsers(code, key string) string {
-	url := baseURL
+func (s *Server) getUsers(ctx context.Context, code, key string) string {
+	url := s.baseURL
 
 	if code != "" {
-		url = baseURL + "/" + code + "?accessKey=" + key
+		url = s.baseURL + "/" + code + "?accessKey=" + key
 	} else {
-		url = baseURL + "?accessKey=" + key
+		url = s.baseURL + "?accessKey=" + key
 	}
 
-	response, err := http.Get(url)
+	request, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		slog.ErrorContext(ctx, "reading users", "error", err)
+		return ""
+	}
+	response, err := s.client.Do(request)
 	if err != nil {
-		log.Println("Error:", err)
+		slog.ErrorContext(ctx, "reading users", "error", err)
 		return ""
 	}
 	data, _ := ioutil.ReadAll(response.Body)
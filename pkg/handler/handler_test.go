@@ -0,0 +1,468 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	. "github.com/franela/goblin"
+	"github.com/teojiahao/HireMe/pkg/api"
+	"github.com/teojiahao/HireMe/pkg/audit"
+	"github.com/teojiahao/HireMe/pkg/config"
+	"github.com/teojiahao/HireMe/pkg/content"
+	"github.com/teojiahao/HireMe/pkg/database"
+	"github.com/teojiahao/HireMe/pkg/queue"
+	"github.com/teojiahao/HireMe/pkg/report"
+	"github.com/teojiahao/HireMe/pkg/security"
+	"github.com/teojiahao/HireMe/pkg/taxonomy"
+)
+
+// fakePages keeps the last page rendered instead of writing it
+type fakePages struct {
+	name string
+	data interface{}
+}
+
+func (f *fakePages) ExecuteTemplate(w io.Writer, name string, data interface{}) error {
+	f.name = name
+	f.data = data
+	return nil
+}
+
+// fakeGeocoder knows a single postal code
+type fakeGeocoder struct{}
+
+func (fakeGeocoder) Geocode(ctx context.Context, postal string) (float64, float64, error) {
+	if postal == "123456" {
+		return 1.3, 103.8, nil
+	}
+	return 0, 0, errors.New("invalid postal code")
+}
+
+// fakeAPI answers like the api with the users given
+func fakeAPI(users map[string]database.UserJSON) *httptest.Server {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/api/v1/users", func(res http.ResponseWriter, req *http.Request) {
+		json.NewEncoder(res).Encode(users)
+	})
+	reported := map[string]bool{}
+	mux.HandleFunc("/api/v1/users/", func(res http.ResponseWriter, req *http.Request) {
+		username := strings.TrimPrefix(req.URL.Path, "/api/v1/users/")
+		if strings.HasSuffix(username, "/reports") {
+			username = strings.TrimSuffix(username, "/reports")
+			if reported[username] {
+				res.WriteHeader(http.StatusConflict)
+				return
+			}
+			reported[username] = true
+		}
+		if _, ok := users[username]; !ok {
+			res.WriteHeader(http.StatusNotFound)
+			return
+		}
+		switch req.Method {
+		case http.MethodPost:
+			res.WriteHeader(http.StatusCreated)
+		case http.MethodPatch:
+			if req.URL.Query().Get("accessKey") == "revoked" {
+				res.WriteHeader(http.StatusNotFound)
+				res.Write([]byte("404 - invalid key!"))
+				return
+			}
+			var user api.ProfileRequest
+			json.NewDecoder(req.Body).Decode(&user)
+			if err := taxonomy.Default().Check(user.Selection); err != nil {
+				res.WriteHeader(http.StatusUnprocessableEntity)
+				res.Write([]byte("422 - Please pick from the lists, " + err.Error()))
+				return
+			}
+			if rejected := content.DefaultPolicy.Check(user.Message).Rejected(); len(rejected) > 0 {
+				res.WriteHeader(http.StatusUnprocessableEntity)
+				res.Write([]byte("422 - " + rejected[0].Message))
+			}
+		}
+	})
+	mux.HandleFunc("/api/v1/login", func(res http.ResponseWriter, req *http.Request) {
+		var login api.LoginRequest
+		json.NewDecoder(req.Body).Decode(&login)
+		if _, ok := users[login.Username]; !ok || (string(login.Password) != "password" && string(login.Password) != "<pass&word>") {
+			res.WriteHeader(http.StatusForbidden)
+			return
+		}
+		res.Write([]byte("key"))
+	})
+	mux.HandleFunc("/api/v1/admin/users", func(res http.ResponseWriter, req *http.Request) {
+		found := api.ManagedUsers{Page: 1, Limit: 20, Users: []api.ManagedUser{}}
+		for username := range users {
+			found.Users = append(found.Users, api.ManagedUser{Username: username})
+		}
+		found.Total = len(found.Users)
+		json.NewEncoder(res).Encode(found)
+	})
+	mux.HandleFunc("/api/v1/admin/users/", func(res http.ResponseWriter, req *http.Request) {
+		username := strings.TrimSuffix(strings.TrimPrefix(req.URL.Path, "/api/v1/admin/users/"), "/key")
+		if _, ok := users[username]; !ok {
+			res.WriteHeader(http.StatusNotFound)
+			return
+		}
+		json.NewEncoder(res).Encode(api.ManagedUser{Username: username})
+	})
+	return httptest.NewServer(mux)
+}
+
+func newTestServer(api *httptest.Server, pages *fakePages) *Server {
+	keyring, _ := security.NewKeyring("test", map[string][]byte{"test": []byte("0123456789abcdef")})
+	s, _ := NewServer(Deps{
+		Config: config.Config{
+			API:        api.URL + "/api/v1/users",
+			LoginAPI:   api.URL + "/api/v1/login",
+			AdminUsers: []string{"admin"},
+		},
+		Templates: pages,
+		Geocoder:  fakeGeocoder{},
+		Client:    api.Client(),
+		Keyring:   keyring,
+	})
+	return s
+}
+
+// log in through the page and return the session cookie
+func login(s *Server, username string) *http.Cookie {
+	form := url.Values{"username": {username}, "password": {"password"}}
+	req := httptest.NewRequest("POST", "/login", strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	res := httptest.NewRecorder()
+	s.ServeHTTP(res, req)
+	for _, c := range res.Result().Cookies() {
+		if c.Name == "myCookie" {
+			return c
+		}
+	}
+	return nil
+}
+
+func TestServer(t *testing.T) {
+	gob := Goblin(t)
+	api := fakeAPI(map[string]database.UserJSON{
+		"jiahao": {Username: "jiahao", JobType: "Full–time, Part-time", Skill: "Legal", Exp: 5, Message: "Looking for a law firm",
+			JobTypes: []string{"Full–time", "Part-time"}, Categories: []string{"Legal"}},
+		"admin": {Username: "admin", JobType: "Internship", Skill: "Computer and IT", Exp: 1, Message: "Anything in IT",
+			JobTypes: []string{"Internship"}, Categories: []string{"Computer and IT"}, Skills: []string{"Go"}},
+	})
+	defer api.Close()
+
+	gob.Describe("Index Test", func() {
+		gob.It("should filter the users on the map", func() {
+			pages := &fakePages{}
+			s := newTestServer(api, pages)
+
+			s.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/?Type=Full–time&exp=3", nil))
+			gob.Assert(pages.name).Equal("index.gohtml")
+			users := pages.data.(struct {
+				MyUser        string
+				AllUser       map[string]database.UserJSON
+				Type          []string
+				Category      []string
+				Skills        map[string][]string
+				GoogleAPI     string
+				GoogleMapID   string
+				ContactHidden bool
+				Nonce         string
+			}).AllUser
+			gob.Assert(len(users)).Equal(1)
+			_, ok := users["jiahao"]
+			gob.Assert(ok).IsTrue()
+		})
+
+		gob.It("should match whole names only", func() {
+			pages := &fakePages{}
+			s := newTestServer(api, pages)
+			count := func(query string) int {
+				s.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/?"+query, nil))
+				return reflect.ValueOf(pages.data).FieldByName("AllUser").Len()
+			}
+
+			// a part of a name used to match
+			gob.Assert(count("Category=IT")).Equal(0)
+			gob.Assert(count("Category=" + url.QueryEscape("Computer and IT"))).Equal(1)
+			gob.Assert(count("Category=Legal&Category=" + url.QueryEscape("Computer and IT"))).Equal(2)
+			gob.Assert(count("Skill=Go")).Equal(1)
+		})
+
+		gob.It("should keep the sessions of two servers apart", func() {
+			first := newTestServer(api, &fakePages{})
+			second := newTestServer(api, &fakePages{})
+			cookie := login(first, "jiahao")
+			gob.Assert(cookie != nil).IsTrue()
+
+			req := httptest.NewRequest("GET", "/activity", nil)
+			req.AddCookie(cookie)
+			gob.Assert(first.alreadyLoggedIn(req)).IsTrue()
+			gob.Assert(second.alreadyLoggedIn(req)).IsFalse()
+		})
+
+		gob.It("should only record the failed logins of accounts there are", func() {
+			s := newTestServer(api, &fakePages{})
+			s.exists = func(username string) bool { return username == "jiahao" }
+			for _, username := range []string{"jiahao", "nobody"} {
+				form := url.Values{"username": {username}, "password": {"wrong"}}
+				req := httptest.NewRequest("POST", "/login", strings.NewReader(form.Encode()))
+				req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+				s.ServeHTTP(httptest.NewRecorder(), req)
+			}
+			failures := queue.Query{Kinds: []queue.Kind{queue.LoginFailure}}
+			_, total, _ := s.activities.Search("jiahao", failures, 0, 10)
+			gob.Assert(total).Equal(1)
+			_, total, _ = s.activities.Search("nobody", failures, 0, 10)
+			gob.Assert(total).Equal(0)
+		})
+
+		gob.It("should send the password as typed", func() {
+			s := newTestServer(api, &fakePages{})
+			form := url.Values{"username": {"jiahao"}, "password": {"<pass&word>"}}
+			req := httptest.NewRequest("POST", "/login", strings.NewReader(form.Encode()))
+			req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+			res := httptest.NewRecorder()
+			s.ServeHTTP(res, req)
+			gob.Assert(res.Code).Equal(http.StatusSeeOther)
+		})
+	})
+
+	gob.Describe("Update Profile Test", func() {
+		gob.It("should refuse a postal code the geocoder does not know", func() {
+			s := newTestServer(api, &fakePages{})
+			form := url.Values{"options": {"Yes"}, "postal": {"000000"}}
+			req := httptest.NewRequest("POST", "/updateProfile", strings.NewReader(form.Encode()))
+			req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+			req.AddCookie(login(s, "jiahao"))
+			res := httptest.NewRecorder()
+			s.ServeHTTP(res, req)
+			gob.Assert(res.Code).Equal(http.StatusForbidden)
+			gob.Assert(strings.TrimSpace(res.Body.String())).Equal("Invalid Postal Code")
+		})
+
+		gob.It("should tell the user why the message was refused", func() {
+			s := newTestServer(api, &fakePages{})
+			form := url.Values{"options": {"Yes"}, "postal": {"123456"}, "Type": {"Internship"}, "Category": {"Legal"},
+				"exp": {"2"}, "lastDay": {"2020-01-01"}, "email": {"jiahao@example.com"},
+				"message": {"Looking for a law firm, see my cv on jiahao.dev please"}}
+			req := httptest.NewRequest("POST", "/updateProfile", strings.NewReader(form.Encode()))
+			req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+			req.AddCookie(login(s, "jiahao"))
+			res := httptest.NewRecorder()
+			s.ServeHTTP(res, req)
+			gob.Assert(res.Code).Equal(http.StatusForbidden)
+			gob.Assert(strings.TrimSpace(res.Body.String())).Equal("Message cannot contain links")
+		})
+
+		gob.It("should check the message as typed", func() {
+			s := newTestServer(api, &fakePages{})
+			// 50 characters, escaping the & would take it over the limit
+			message := "R&D or QA roles in Singapore, open to contract now"
+			form := url.Values{"options": {"Yes"}, "postal": {"123456"}, "Type": {"Internship"}, "Category": {"Legal"},
+				"exp": {"2"}, "lastDay": {"2020-01-01"}, "email": {"jiahao@example.com"}, "message": {message}}
+			req := httptest.NewRequest("POST", "/updateProfile", strings.NewReader(form.Encode()))
+			req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+			req.AddCookie(login(s, "jiahao"))
+			res := httptest.NewRecorder()
+			s.ServeHTTP(res, req)
+			gob.Assert(len(message)).Equal(50)
+			gob.Assert(res.Code).Equal(http.StatusSeeOther)
+		})
+
+		gob.It("should tell the user why the picks were refused", func() {
+			s := newTestServer(api, &fakePages{})
+			form := url.Values{"options": {"Yes"}, "postal": {"123456"}, "Type": {"Internship"}, "Category": {"Astrology"},
+				"exp": {"2"}, "lastDay": {"2020-01-01"}, "email": {"jiahao@example.com"}, "message": {"Anything"}}
+			req := httptest.NewRequest("POST", "/updateProfile", strings.NewReader(form.Encode()))
+			req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+			req.AddCookie(login(s, "jiahao"))
+			res := httptest.NewRecorder()
+			s.ServeHTTP(res, req)
+			gob.Assert(res.Code).Equal(http.StatusForbidden)
+			gob.Assert(strings.TrimSpace(res.Body.String())).Equal(`Please pick from the lists, unknown category "Astrology"`)
+		})
+
+		gob.It("should not show or record a save the api refused", func() {
+			s := newTestServer(api, &fakePages{})
+			cookie := login(s, "jiahao")
+			// the key was revoked since the login
+			s.sessions.Put(cookie.Value, Session{"jiahao", "revoked"})
+			form := url.Values{"options": {"No"}}
+			req := httptest.NewRequest("POST", "/updateProfile", strings.NewReader(form.Encode()))
+			req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+			req.AddCookie(cookie)
+			res := httptest.NewRecorder()
+			s.ServeHTTP(res, req)
+			gob.Assert(res.Code).Equal(http.StatusInternalServerError)
+			_, total, _ := s.activities.Search("jiahao", queue.Query{Kinds: []queue.Kind{queue.ProfileUpdate}}, 0, 10)
+			gob.Assert(total).Equal(0)
+		})
+	})
+
+	gob.Describe("Admin Test", func() {
+		gob.It("should only show the audit log to admins", func() {
+			pages := &fakePages{}
+			s := newTestServer(api, pages)
+
+			req := httptest.NewRequest("GET", "/admin/audit", nil)
+			req.AddCookie(login(s, "jiahao"))
+			res := httptest.NewRecorder()
+			s.ServeHTTP(res, req)
+			gob.Assert(res.Code).Equal(http.StatusNotFound)
+
+			req = httptest.NewRequest("GET", "/admin/audit", nil)
+			req.AddCookie(login(s, "admin"))
+			res = httptest.NewRecorder()
+			s.ServeHTTP(res, req)
+			gob.Assert(res.Code).Equal(http.StatusOK)
+			gob.Assert(pages.name).Equal("audit.gohtml")
+		})
+
+		gob.It("should list the users to admins only", func() {
+			pages := &fakePages{}
+			s := newTestServer(api, pages)
+
+			req := httptest.NewRequest("GET", "/admin/users", nil)
+			req.AddCookie(login(s, "jiahao"))
+			res := httptest.NewRecorder()
+			s.ServeHTTP(res, req)
+			gob.Assert(res.Code).Equal(http.StatusNotFound)
+
+			req = httptest.NewRequest("GET", "/admin/users", nil)
+			req.AddCookie(login(s, "admin"))
+			s.ServeHTTP(httptest.NewRecorder(), req)
+			gob.Assert(pages.name).Equal("adminUsers.gohtml")
+			gob.Assert(reflect.ValueOf(pages.data).FieldByName("Total").Int()).Equal(int64(2))
+		})
+
+		gob.It("should log the user out everywhere only from a form of the site", func() {
+			s := newTestServer(api, &fakePages{})
+			user := login(s, "jiahao")
+			admin := login(s, "admin")
+			form := url.Values{"action": {"logout"}}
+
+			req := httptest.NewRequest("POST", "/admin/users/jiahao", strings.NewReader(form.Encode()))
+			req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+			req.Header.Set("Origin", "https://evil.example")
+			req.AddCookie(admin)
+			res := httptest.NewRecorder()
+			s.ServeHTTP(res, req)
+			gob.Assert(res.Code).Equal(http.StatusForbidden)
+
+			check := httptest.NewRequest("GET", "/activity", nil)
+			check.AddCookie(user)
+			gob.Assert(s.alreadyLoggedIn(check)).IsTrue()
+
+			req = httptest.NewRequest("POST", "/admin/users/jiahao", strings.NewReader(form.Encode()))
+			req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+			req.Header.Set("Origin", "http://"+req.Host)
+			req.AddCookie(admin)
+			res = httptest.NewRecorder()
+			s.ServeHTTP(res, req)
+			gob.Assert(res.Code).Equal(http.StatusSeeOther)
+			gob.Assert(s.alreadyLoggedIn(check)).IsFalse()
+		})
+
+		gob.It("should close the reports of a profile", func() {
+			pages := &fakePages{}
+			s := newTestServer(api, pages)
+			s.reports.Add(report.New("jiahao", "admin", report.Spam, "", time.Now()))
+
+			form := url.Values{"target": {"jiahao"}, "action": {"hide"}}
+			req := httptest.NewRequest("POST", "/admin/reports", strings.NewReader(form.Encode()))
+			req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+			req.Header.Set("Referer", "http://"+req.Host+"/admin/reports")
+			req.AddCookie(login(s, "admin"))
+			res := httptest.NewRecorder()
+			s.ServeHTTP(res, req)
+			gob.Assert(res.Code).Equal(http.StatusSeeOther)
+
+			open, _ := s.reports.Open("jiahao")
+			gob.Assert(len(open)).Equal(0)
+			entries, _, _ := s.audit.Store.Search(audit.Query{Target: "jiahao"}, 0, 0)
+			gob.Assert(len(entries)).Equal(1)
+			gob.Assert(entries[0].Action).Equal(audit.ReportResolve)
+		})
+
+		gob.It("should change the job lists keeping the picks", func() {
+			pages := &fakePages{}
+			s := newTestServer(api, pages)
+			s.taxonomy.Pick("jiahao", taxonomy.Selection{Categories: []string{"Legal"}})
+			admin := login(s, "admin")
+			post := func(form url.Values) int {
+				req := httptest.NewRequest("POST", "/admin/taxonomy", strings.NewReader(form.Encode()))
+				req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+				req.Header.Set("Origin", "http://"+req.Host)
+				req.AddCookie(admin)
+				res := httptest.NewRecorder()
+				s.ServeHTTP(res, req)
+				return res.Code
+			}
+
+			gob.Assert(post(url.Values{"kind": {"category"}, "action": {"rename"}, "name": {"Legal"}, "to": {" Law  and Order "}})).Equal(http.StatusSeeOther)
+			picked, _ := s.taxonomy.Picked("jiahao")
+			gob.Assert(picked.Categories).Equal([]string{"Law and Order"})
+
+			gob.Assert(post(url.Values{"kind": {"skill"}, "action": {"add"}, "name": {"Conveyancing"}, "category": {"Law and Order"}})).Equal(http.StatusSeeOther)
+			gob.Assert(post(url.Values{"kind": {"skill"}, "action": {"add"}, "name": {"Conveyancing"}, "category": {"Law and Order"}})).Equal(http.StatusUnprocessableEntity)
+			gob.Assert(pages.name).Equal("adminTaxonomy.gohtml")
+			gob.Assert(reflect.ValueOf(pages.data).FieldByName("Error").String()).Equal("skill already in the list")
+
+			entries, _, _ := s.audit.Store.Search(audit.Query{Target: "category"}, 0, 0)
+			gob.Assert(len(entries)).Equal(1)
+			gob.Assert(entries[0].Action).Equal(audit.TaxonomyRename)
+		})
+	})
+
+	gob.Describe("Report Test", func() {
+		gob.It("should file a report once from a form of the site", func() {
+			pages := &fakePages{}
+			s := newTestServer(api, pages)
+			cookie := login(s, "jiahao")
+			form := url.Values{"reason": {"spam"}, "details": {"buy now"}}
+			post := func(origin string) *httptest.ResponseRecorder {
+				req := httptest.NewRequest("POST", "/report/admin", strings.NewReader(form.Encode()))
+				req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+				req.Header.Set("Origin", origin)
+				req.AddCookie(cookie)
+				res := httptest.NewRecorder()
+				s.ServeHTTP(res, req)
+				return res
+			}
+
+			gob.Assert(post("https://evil.example").Code).Equal(http.StatusForbidden)
+			res := post("http://example.com")
+			gob.Assert(res.Code).Equal(http.StatusSeeOther)
+			gob.Assert(res.Header().Get("Location")).Equal("/reports")
+
+			res = post("http://example.com")
+			gob.Assert(res.Code).Equal(http.StatusUnprocessableEntity)
+			gob.Assert(pages.name).Equal("report.gohtml")
+			gob.Assert(reflect.ValueOf(pages.data).FieldByName("Error").String()).Equal("You already reported this profile, a moderator will look at it soon")
+		})
+
+		gob.It("should show the reporter the outcome", func() {
+			pages := &fakePages{}
+			s := newTestServer(api, pages)
+			s.reports.Add(report.New("admin", "jiahao", report.Spam, "", time.Now()))
+			s.reports.Resolve("admin", report.Dismissed, "moderator", time.Now())
+
+			req := httptest.NewRequest("GET", "/reports", nil)
+			req.AddCookie(login(s, "jiahao"))
+			s.ServeHTTP(httptest.NewRecorder(), req)
+			gob.Assert(pages.name).Equal("myReports.gohtml")
+			filed := reflect.ValueOf(pages.data).FieldByName("Reports").Interface().([]report.Report)
+			gob.Assert(len(filed)).Equal(1)
+			gob.Assert(filed[0].Outcome).Equal(report.Dismissed)
+		})
+	})
+}
@@ -0,0 +1,127 @@
+package handler
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strconv"
+
+	"github.com/gorilla/mux"
+	"github.com/teojiahao/HireMe/pkg/api"
+	"github.com/teojiahao/HireMe/pkg/report"
+)
+
+// number of reports shown per page to the reporter
+const reportPageSize = 10
+
+// ReportProfile page lets a user report the profile of another user to the moderators
+func (s *Server) ReportProfile(res http.ResponseWriter, req *http.Request) {
+	if !s.alreadyLoggedIn(req) {
+		http.Redirect(res, req, "/login", http.StatusSeeOther)
+		return
+	}
+	myUser := s.getUserFromCookie(res, req)
+	target := mux.Vars(req)["username"]
+
+	data := struct {
+		Target     string
+		Reasons    []report.Reason
+		Selected   report.Reason
+		Details    string
+		MaxDetails int
+		Error      string
+	}{
+		Target:     target,
+		Reasons:    report.Reasons,
+		MaxDetails: api.MaxReportDetails,
+	}
+
+	if req.Method == http.MethodPost {
+		// a page elsewhere could otherwise file reports in the name of the user
+		if !sameOrigin(req) {
+			http.Error(res, "Forbidden", http.StatusForbidden)
+			return
+		}
+		data.Selected = report.Reason(req.FormValue("reason"))
+		data.Details = req.FormValue("details")
+
+		jsonValue, _ := json.Marshal(api.ReportRequest{Reason: data.Selected, Details: data.Details})
+		request, err := http.NewRequestWithContext(req.Context(), http.MethodPost,
+			s.baseURL+"/"+url.PathEscape(target)+"/reports?accessKey="+url.QueryEscape(myUser.Accesskey), bytes.NewBuffer(jsonValue))
+		if err != nil {
+			http.NotFound(res, req)
+			return
+		}
+		request.Header.Set("Content-Type", "application/json")
+		request.Header.Set("X-Forwarded-For", s.clientIP(req))
+		response, err := s.client.Do(request)
+		if err != nil {
+			slog.ErrorContext(req.Context(), "filing report", "error", err)
+			http.Error(res, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+		body, _ := ioutil.ReadAll(response.Body)
+		response.Body.Close()
+
+		switch response.StatusCode {
+		case http.StatusCreated:
+			http.Redirect(res, req, "/reports", http.StatusSeeOther)
+			return
+		case http.StatusConflict:
+			data.Error = "You already reported this profile, a moderator will look at it soon"
+		case http.StatusNotFound:
+			http.NotFound(res, req)
+			return
+		case http.StatusUnprocessableEntity:
+			data.Error = apiMessage(body)
+		default:
+			slog.ErrorContext(req.Context(), "report refused by the api", "status", response.StatusCode)
+			http.Error(res, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+		res.WriteHeader(http.StatusUnprocessableEntity)
+	}
+
+	s.pages.ExecuteTemplate(res, "report.gohtml", data)
+}
+
+// MyReports page show the user the profiles they reported, newest first, and what the moderators did
+func (s *Server) MyReports(res http.ResponseWriter, req *http.Request) {
+	if !s.alreadyLoggedIn(req) {
+		http.Redirect(res, req, "/login", http.StatusSeeOther)
+		return
+	}
+	myUser := s.getUserFromCookie(res, req)
+
+	page, _ := strconv.Atoi(req.FormValue("page"))
+	if page < 1 {
+		page = 1
+	}
+	filed, total, err := s.reports.ByReporter(myUser.Username, (page-1)*reportPageSize, reportPageSize)
+	if err != nil {
+		slog.ErrorContext(req.Context(), "reading reports", "error", err)
+		http.Error(res, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	data := struct {
+		Reports  []report.Report
+		Page     int
+		PrevPage int
+		NextPage int
+	}{
+		Reports: filed,
+		Page:    page,
+	}
+	if page > 1 {
+		data.PrevPage = page - 1
+	}
+	if page*reportPageSize < total {
+		data.NextPage = page + 1
+	}
+
+	s.pages.ExecuteTemplate(res, "myReports.gohtml", data)
+}
@@ -0,0 +1,400 @@
+package handler
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+
+	"github.com/gorilla/mux"
+	"github.com/teojiahao/HireMe/pkg/alert"
+	"github.com/teojiahao/HireMe/pkg/audit"
+	"github.com/teojiahao/HireMe/pkg/config"
+	"github.com/teojiahao/HireMe/pkg/content"
+	"github.com/teojiahao/HireMe/pkg/email"
+	"github.com/teojiahao/HireMe/pkg/headers"
+	"github.com/teojiahao/HireMe/pkg/logging"
+	"github.com/teojiahao/HireMe/pkg/metrics"
+	"github.com/teojiahao/HireMe/pkg/queue"
+	"github.com/teojiahao/HireMe/pkg/report"
+	"github.com/teojiahao/HireMe/pkg/security"
+	"github.com/teojiahao/HireMe/pkg/taxonomy"
+	"github.com/teojiahao/HireMe/pkg/totp"
+	"github.com/teojiahao/HireMe/pkg/tracing"
+	"go.opentelemetry.io/otel/attribute"
+	"googlemaps.github.io/maps"
+)
+
+// Renderer renders a page by its file name
+type Renderer interface {
+	ExecuteTemplate(w io.Writer, name string, data interface{}) error
+}
+
+// ParseTemplates parses every page in dir with layout.gohtml
+func ParseTemplates(dir string) (Renderer, error) {
+	return parsePages(dir)
+}
+
+// SessionStore keeps the logged in users by the id in their cookie
+type SessionStore interface {
+	Get(id string) (Session, bool)
+	Put(id string, s Session)
+	Delete(id string)
+	// DeleteUser removes every session of the user
+	DeleteUser(username string)
+}
+
+// MemorySessionStore keeps the sessions in memory, they are lost on restart
+type MemorySessionStore struct {
+	mutex    sync.RWMutex
+	sessions map[string]Session
+}
+
+// NewMemorySessionStore return an empty MemorySessionStore
+func NewMemorySessionStore() *MemorySessionStore {
+	return &MemorySessionStore{sessions: map[string]Session{}}
+}
+
+// Get return the session of the id
+func (m *MemorySessionStore) Get(id string) (Session, bool) {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+	s, ok := m.sessions[id]
+	return s, ok
+}
+
+// Put keeps the session under the id
+func (m *MemorySessionStore) Put(id string, s Session) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	if _, ok := m.sessions[id]; !ok {
+		metrics.ActiveSessions.Inc()
+	}
+	m.sessions[id] = s
+}
+
+// Delete removes the session of the id
+func (m *MemorySessionStore) Delete(id string) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	if _, ok := m.sessions[id]; ok {
+		metrics.ActiveSessions.Dec()
+	}
+	delete(m.sessions, id)
+}
+
+// DeleteUser removes every session of the user
+func (m *MemorySessionStore) DeleteUser(username string) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	for id, s := range m.sessions {
+		if s.Username == username {
+			metrics.ActiveSessions.Dec()
+			delete(m.sessions, id)
+		}
+	}
+}
+
+// Geocoder finds the coordinates of a postal code
+type Geocoder interface {
+	Geocode(ctx context.Context, postal string) (lat, lng float64, err error)
+}
+
+// GoogleGeocoder looks up Singapore postal codes with the Google Maps geocoding api
+type GoogleGeocoder struct {
+	client *maps.Client
+}
+
+// NewGoogleGeocoder return a GoogleGeocoder using the api key
+func NewGoogleGeocoder(apiKey string) (*GoogleGeocoder, error) {
+	c, err := maps.NewClient(maps.WithAPIKey(apiKey))
+	if err != nil {
+		return nil, err
+	}
+	return &GoogleGeocoder{c}, nil
+}
+
+// Geocode return the coordinates of the postal code
+func (g *GoogleGeocoder) Geocode(ctx context.Context, postal string) (float64, float64, error) {
+	ctx, span := tracing.Start(ctx, "geocoder google")
+	defer span.End()
+
+	resp, err := g.client.Geocode(ctx, &maps.GeocodingRequest{
+		Address: postal,
+		Region:  "SG",
+	})
+	if err != nil {
+		metrics.GeocoderRequests.WithLabelValues("error").Inc()
+		tracing.Fail(span, err)
+		return 0, 0, err
+	}
+	if len(resp) == 0 {
+		metrics.GeocoderRequests.WithLabelValues("invalid").Inc()
+		span.SetAttributes(attribute.Bool("geocoder.found", false))
+		return 0, 0, fmt.Errorf("invalid postal code")
+	}
+	span.SetAttributes(attribute.Bool("geocoder.found", true))
+	metrics.GeocoderRequests.WithLabelValues("ok").Inc()
+	return resp[0].Geometry.Location.Lat, resp[0].Geometry.Location.Lng, nil
+}
+
+// CachingGeocoder remembers the coordinates found, a postal code does not move
+type CachingGeocoder struct {
+	geocoder Geocoder
+
+	mutex  sync.RWMutex
+	coords map[string][2]float64
+}
+
+// NewCachingGeocoder return a CachingGeocoder asking the geocoder for the postal codes it has not seen
+func NewCachingGeocoder(g Geocoder) *CachingGeocoder {
+	return &CachingGeocoder{geocoder: g, coords: map[string][2]float64{}}
+}
+
+// Geocode return the coordinates of the postal code, only the ones found are kept
+func (c *CachingGeocoder) Geocode(ctx context.Context, postal string) (float64, float64, error) {
+	ctx, span := tracing.Start(ctx, "geocoder cache")
+	defer span.End()
+
+	c.mutex.RLock()
+	coords, ok := c.coords[postal]
+	c.mutex.RUnlock()
+	span.SetAttributes(attribute.Bool("geocoder.cache_hit", ok))
+	if ok {
+		metrics.GeocoderCache.WithLabelValues("hit").Inc()
+		return coords[0], coords[1], nil
+	}
+	metrics.GeocoderCache.WithLabelValues("miss").Inc()
+
+	lat, lng, err := c.geocoder.Geocode(ctx, postal)
+	if err != nil {
+		return 0, 0, err
+	}
+	c.mutex.Lock()
+	c.coords[postal] = [2]float64{lat, lng}
+	c.mutex.Unlock()
+	return lat, lng, nil
+}
+
+// address the readiness probe reaches, a request without a key answers without using any quota
+const googleGeocodeURL = "https://maps.googleapis.com/maps/api/geocode/json"
+
+// Ping checks that the geocoding api can be reached
+func (g *GoogleGeocoder) Ping(ctx context.Context) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, googleGeocodeURL, nil)
+	if err != nil {
+		return err
+	}
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	res.Body.Close()
+	if res.StatusCode >= http.StatusInternalServerError {
+		return fmt.Errorf("geocoder answered %s", res.Status)
+	}
+	return nil
+}
+
+// Deps is everything the Server is built from, the ones left nil get a default
+type Deps struct {
+	Config config.Config
+	// Templates is parsed from Config.TemplateDir when nil
+	Templates Renderer
+	// Sessions is kept in memory when nil
+	Sessions SessionStore
+	// Geocoder uses Google Maps with Config.Google.APIKey when nil, it is not cached
+	Geocoder Geocoder
+	// Activities keeps the user activity history, in memory when nil
+	Activities queue.ActivityStore
+	// Detector flags suspicious logins, nothing is flagged when it is nil
+	Detector *alert.Detector
+	// Exists tells if there is an account with the username, failed logins are only recorded
+	// for those, none are when it is nil
+	Exists func(username string) bool
+	// Alerts keeps the flagged logins for the user to review, in memory when nil
+	Alerts alert.Store
+	// Notifier is the mailer telling the user about flagged logins, only Alerts when nil
+	Notifier alert.Notifier
+	// TwoFactor should be the manager the api checks, in memory when nil
+	TwoFactor *totp.Manager
+	// Audit should be the log the api writes to, in memory when nil
+	Audit *audit.Log
+	// Reports keeps the reported profiles for the moderators, in memory when nil
+	Reports report.Store
+	// Client reaches the api, one trusting the self signed certificate when nil
+	Client *http.Client
+	// Taxonomy should be the lists the api checks the profiles against, the built in lists in memory when nil
+	Taxonomy taxonomy.Store
+	// Keyring opens the keys the api gives and seals the logins waiting for a code, it is required
+	Keyring *security.Keyring
+	// Passwords hashes and checks the new passwords, the defaults are used with Keyring when nil
+	Passwords *security.Passwords
+	// Disposable lists the email domains refused in the profile, nothing is refused when nil
+	Disposable *email.DisposableList
+	// Messages should be the policy the api checks the profile messages against, content.DefaultPolicy when nil
+	Messages *content.Policy
+}
+
+// Server serves the pages, every request reaches the users through the api
+type Server struct {
+	pages             Renderer
+	sessions          SessionStore
+	geocoder          Geocoder
+	activities        queue.ActivityStore
+	detector          *alert.Detector
+	exists            func(username string) bool
+	alerts            alert.Store
+	notifier          alert.Notifier
+	twoFactor         *totp.Manager
+	twoFactorRequired bool
+	audit             *audit.Log
+	reports           report.Store
+	hideAfter         int
+	client            *http.Client
+	baseURL           string
+	adminURL          string
+	loginURL          string
+	googleAPI         string
+	googleMapID       string
+	taxonomy          taxonomy.Store
+	keyring           *security.Keyring
+	passwords         *security.Passwords
+	disposable        *email.DisposableList
+	messages          content.Policy
+	admins            []string
+	proxies           headers.Proxies
+
+	// logins with the right password waiting for the two-factor code
+	pendingMutex  sync.Mutex
+	pendingLogins map[string]pendingLogin
+
+	router *mux.Router
+}
+
+// NewServer return a Server built from the deps
+func NewServer(d Deps) (*Server, error) {
+	s := &Server{
+		pages:             d.Templates,
+		sessions:          d.Sessions,
+		geocoder:          d.Geocoder,
+		activities:        d.Activities,
+		detector:          d.Detector,
+		exists:            d.Exists,
+		alerts:            d.Alerts,
+		notifier:          d.Notifier,
+		twoFactor:         d.TwoFactor,
+		twoFactorRequired: d.Config.TwoFactor.Required,
+		audit:             d.Audit,
+		reports:           d.Reports,
+		hideAfter:         d.Config.Report.HideAfter,
+		client:            d.Client,
+		baseURL:           d.Config.API,
+		// the admin api sits next to the users one
+		adminURL:      strings.TrimSuffix(d.Config.API, "/users") + "/admin",
+		loginURL:      d.Config.LoginAPI,
+		googleAPI:     d.Config.Google.APIKey,
+		googleMapID:   d.Config.Google.MapID,
+		taxonomy:      d.Taxonomy,
+		keyring:       d.Keyring,
+		passwords:     d.Passwords,
+		disposable:    d.Disposable,
+		messages:      content.DefaultPolicy,
+		admins:        d.Config.AdminUsers,
+		proxies:       d.Config.Proxies(),
+		pendingLogins: map[string]pendingLogin{},
+	}
+
+	if s.keyring == nil {
+		return nil, security.ErrNoKeyring
+	}
+	if s.passwords == nil {
+		s.passwords = &security.Passwords{Keyring: s.keyring, Params: security.DefaultPasswordParams, Policy: security.DefaultPasswordPolicy}
+	}
+	if d.Messages != nil {
+		s.messages = *d.Messages
+	}
+
+	var err error
+	if s.pages == nil {
+		if s.pages, err = ParseTemplates(d.Config.TemplateDir); err != nil {
+			return nil, fmt.Errorf("loading templates: %w", err)
+		}
+	}
+	if s.geocoder == nil {
+		if s.geocoder, err = NewGoogleGeocoder(d.Config.Google.APIKey); err != nil {
+			return nil, fmt.Errorf("geocoder: %w", err)
+		}
+	}
+	if s.sessions == nil {
+		s.sessions = NewMemorySessionStore()
+	}
+	if s.activities == nil {
+		s.activities = queue.NewMemoryStore(queue.Retention{})
+	}
+	if s.alerts == nil {
+		s.alerts = alert.NewMemoryStore()
+	}
+	if s.notifier == nil {
+		s.notifier = s.alerts
+	}
+	if s.twoFactor == nil {
+		s.twoFactor = totp.NewManager(totp.NewMemoryStore(), d.Config.TwoFactor.Issuer)
+	}
+	if s.audit == nil {
+		s.audit = audit.NewLog(audit.NewMemoryStore(), d.Config.AuditKey())
+	}
+	if s.reports == nil {
+		s.reports = report.NewMemoryStore()
+	}
+	if s.client == nil {
+		// the api is this same server with a self signed certificate
+		transport := http.DefaultTransport.(*http.Transport).Clone()
+		transport.TLSClientConfig = &tls.Config{InsecureSkipVerify: true}
+		s.client = &http.Client{Transport: transport}
+	}
+	// a copy, so the calls to the api carry the request id and the trace without changing the client given
+	client := *s.client
+	client.Transport = logging.Transport(tracing.Transport(client.Transport))
+	s.client = &client
+	if s.taxonomy == nil {
+		s.taxonomy = taxonomy.NewMemoryStore(taxonomy.Default())
+	}
+
+	s.routes()
+	return s, nil
+}
+
+// routes register every page
+func (s *Server) routes() {
+	s.router = mux.NewRouter()
+	s.router.Use(tracing.Middleware)
+	s.router.Use(metrics.Middleware)
+	// the map page loads scripts from Google Maps so it has a policy of its own
+	s.router.Handle("/", headers.CSP(MapPolicy, http.HandlerFunc(s.Index)))
+	s.router.HandleFunc("/activity", s.Activity)
+	s.router.HandleFunc("/activity/export", s.ActivityExport)
+	s.router.HandleFunc("/updateProfile", s.UpdateProfile)
+	s.router.HandleFunc("/signup", s.Signup)
+	s.router.HandleFunc("/login", s.Login)
+	s.router.HandleFunc("/login/2fa", s.LoginTwoFactor)
+	s.router.HandleFunc("/2fa", s.TwoFactorSetup)
+	s.router.HandleFunc("/logout", s.Logout)
+	s.router.HandleFunc("/report/{username}", s.ReportProfile)
+	s.router.HandleFunc("/reports", s.MyReports)
+	s.router.Handle("/admin", http.RedirectHandler("/admin/users", http.StatusSeeOther))
+	s.router.HandleFunc("/admin/users", s.AdminUsers)
+	s.router.HandleFunc("/admin/users/{username}", s.AdminUser)
+	s.router.HandleFunc("/admin/reports", s.AdminReports)
+	s.router.HandleFunc("/admin/taxonomy", s.AdminTaxonomy)
+	s.router.HandleFunc("/admin/audit", s.AuditLog)
+	s.router.HandleFunc("/admin/audit/export", s.AuditExport)
+}
+
+// ServeHTTP serves the pages, anything else is not found
+func (s *Server) ServeHTTP(res http.ResponseWriter, req *http.Request) {
+	s.router.ServeHTTP(res, req)
+}
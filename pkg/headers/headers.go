@@ -0,0 +1,124 @@
+// Package headers adds the security headers to the responses and redirects http to https
+package headers
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// NoncePlaceholder is replaced in a Content-Security-Policy with the nonce of the request
+const NoncePlaceholder = "{nonce}"
+
+type contextKey struct{}
+
+// Config decides which headers are sent, an empty field sends no header
+type Config struct {
+	// HSTSMaxAge is how long browsers only use https for the site, only sent over https
+	HSTSMaxAge            time.Duration
+	HSTSIncludeSubdomains bool
+	HSTSPreload           bool
+	// FrameOptions is DENY or SAMEORIGIN
+	FrameOptions string
+	// NoSniff stops browsers from guessing a content type other than the one sent
+	NoSniff           bool
+	ReferrerPolicy    string
+	PermissionsPolicy string
+	// ContentSecurityPolicy is the policy of every route without its own, see CSP
+	ContentSecurityPolicy string
+}
+
+// Default is the config used unless main changes it
+var Default = Config{
+	HSTSMaxAge:        365 * 24 * time.Hour,
+	FrameOptions:      "DENY",
+	NoSniff:           true,
+	ReferrerPolicy:    "strict-origin-when-cross-origin",
+	PermissionsPolicy: "camera=(), microphone=(), geolocation=(), payment=(), usb=()",
+	ContentSecurityPolicy: "default-src 'self'; script-src 'self'; style-src 'self'; img-src 'self' data:; " +
+		"object-src 'none'; base-uri 'self'; form-action 'self'; frame-ancestors 'none'",
+}
+
+// Middleware adds the headers to every response, it can be given to mux.Router.Use
+func (c Config) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+		h := res.Header()
+		if c.HSTSMaxAge > 0 && req.TLS != nil {
+			hsts := fmt.Sprintf("max-age=%d", int(c.HSTSMaxAge/time.Second))
+			if c.HSTSIncludeSubdomains {
+				hsts += "; includeSubDomains"
+			}
+			if c.HSTSPreload {
+				hsts += "; preload"
+			}
+			h.Set("Strict-Transport-Security", hsts)
+		}
+		if c.FrameOptions != "" {
+			h.Set("X-Frame-Options", c.FrameOptions)
+		}
+		if c.NoSniff {
+			h.Set("X-Content-Type-Options", "nosniff")
+		}
+		if c.ReferrerPolicy != "" {
+			h.Set("Referrer-Policy", c.ReferrerPolicy)
+		}
+		if c.PermissionsPolicy != "" {
+			h.Set("Permissions-Policy", c.PermissionsPolicy)
+		}
+
+		nonce, err := newNonce()
+		if err != nil {
+			http.Error(res, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+		req = req.WithContext(context.WithValue(req.Context(), contextKey{}, nonce))
+		if c.ContentSecurityPolicy != "" {
+			h.Set("Content-Security-Policy", strings.ReplaceAll(c.ContentSecurityPolicy, NoncePlaceholder, nonce))
+		}
+
+		next.ServeHTTP(res, req)
+	})
+}
+
+// CSP replaces the Content-Security-Policy of the route, it has to be inside Middleware
+// for the nonce to match the one the page gets from Nonce
+func CSP(policy string, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+		res.Header().Set("Content-Security-Policy", strings.ReplaceAll(policy, NoncePlaceholder, Nonce(req)))
+		next.ServeHTTP(res, req)
+	})
+}
+
+// Nonce return the nonce of the request for the nonce attribute of a script, empty outside Middleware
+func Nonce(req *http.Request) string {
+	nonce, _ := req.Context().Value(contextKey{}).(string)
+	return nonce
+}
+
+func newNonce() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.StdEncoding.EncodeToString(b), nil
+}
+
+// RedirectHTTPS sends every request to the same url over https on the given port
+func RedirectHTTPS(httpsPort string) http.Handler {
+	return http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+		host, _, err := net.SplitHostPort(req.Host)
+		if err != nil {
+			host = req.Host
+		}
+		if httpsPort != "" && httpsPort != "443" {
+			host = net.JoinHostPort(host, httpsPort)
+		}
+		target := "https://" + host + req.URL.RequestURI()
+		http.Redirect(res, req, target, http.StatusPermanentRedirect)
+	})
+}
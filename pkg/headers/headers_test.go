@@ -0,0 +1,107 @@
+package headers
+
+import (
+	"crypto/tls"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	. "github.com/franela/goblin"
+)
+
+func TestHeaders(t *testing.T) {
+	gob := Goblin(t)
+
+	gob.Describe("Middleware Test", func() {
+		var nonce string
+		page := http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+			nonce = Nonce(req)
+		})
+
+		gob.It("should add the headers", func() {
+			req := httptest.NewRequest("GET", "https://localhost/", nil)
+			res := httptest.NewRecorder()
+			Default.Middleware(page).ServeHTTP(res, req)
+
+			gob.Assert(res.Header().Get("Strict-Transport-Security")).Equal("max-age=31536000")
+			gob.Assert(res.Header().Get("X-Frame-Options")).Equal("DENY")
+			gob.Assert(res.Header().Get("X-Content-Type-Options")).Equal("nosniff")
+			gob.Assert(res.Header().Get("Referrer-Policy")).Equal("strict-origin-when-cross-origin")
+			gob.Assert(res.Header().Get("Permissions-Policy") != "").IsTrue()
+			gob.Assert(res.Header().Get("Content-Security-Policy")).Equal(Default.ContentSecurityPolicy)
+		})
+
+		gob.It("should only send hsts over https", func() {
+			config := Default
+			config.HSTSIncludeSubdomains = true
+			config.HSTSPreload = true
+
+			req := httptest.NewRequest("GET", "http://localhost/", nil)
+			res := httptest.NewRecorder()
+			config.Middleware(page).ServeHTTP(res, req)
+			gob.Assert(res.Header().Get("Strict-Transport-Security")).Equal("")
+
+			req.TLS = &tls.ConnectionState{}
+			res = httptest.NewRecorder()
+			config.Middleware(page).ServeHTTP(res, req)
+			gob.Assert(res.Header().Get("Strict-Transport-Security")).Equal("max-age=31536000; includeSubDomains; preload")
+		})
+
+		gob.It("should give the route policy a new nonce every request", func() {
+			handler := Default.Middleware(CSP("script-src 'nonce-{nonce}'", page))
+
+			res := httptest.NewRecorder()
+			handler.ServeHTTP(res, httptest.NewRequest("GET", "/", nil))
+			first := nonce
+			gob.Assert(len(first) > 0).IsTrue()
+			gob.Assert(res.Header().Get("Content-Security-Policy")).Equal("script-src 'nonce-" + first + "'")
+
+			res = httptest.NewRecorder()
+			handler.ServeHTTP(res, httptest.NewRequest("GET", "/", nil))
+			gob.Assert(nonce != first).IsTrue()
+			gob.Assert(strings.Contains(res.Header().Get("Content-Security-Policy"), nonce)).IsTrue()
+		})
+	})
+
+	gob.Describe("Redirect Test", func() {
+		gob.It("should redirect to https on the given port", func() {
+			res := httptest.NewRecorder()
+			RedirectHTTPS("8443").ServeHTTP(res, httptest.NewRequest("GET", "http://example.com:8080/activity?page=2", nil))
+			gob.Assert(res.Code).Equal(http.StatusPermanentRedirect)
+			gob.Assert(res.Header().Get("Location")).Equal("https://example.com:8443/activity?page=2")
+
+			res = httptest.NewRecorder()
+			RedirectHTTPS("443").ServeHTTP(res, httptest.NewRequest("GET", "http://example.com/", nil))
+			gob.Assert(res.Header().Get("Location")).Equal("https://example.com/")
+		})
+	})
+	gob.Describe("Client IP Test", func() {
+		proxies, err := ParseProxies([]string{"10.0.0.0/8", "192.0.2.7"})
+		request := func(peer string, forwarded ...string) *http.Request {
+			req := httptest.NewRequest("GET", "/", nil)
+			req.RemoteAddr = peer + ":4321"
+			for _, f := range forwarded {
+				req.Header.Add("X-Forwarded-For", f)
+			}
+			return req
+		}
+
+		gob.It("should read the addresses and ranges", func() {
+			gob.Assert(err).IsNil()
+			_, err := ParseProxies([]string{"10.0.0.0/33"})
+			gob.Assert(err).IsNotNil()
+		})
+
+		gob.It("should ignore the header from anyone else", func() {
+			gob.Assert(proxies.ClientIP(request("203.0.113.9", "1.2.3.4"))).Equal("203.0.113.9")
+		})
+
+		gob.It("should take the right-most hop a trusted proxy added", func() {
+			// the client sent 1.2.3.4 itself, the proxy added 203.0.113.9
+			gob.Assert(proxies.ClientIP(request("10.1.1.1", "1.2.3.4, 203.0.113.9"))).Equal("203.0.113.9")
+			gob.Assert(proxies.ClientIP(request("127.0.0.1", "1.2.3.4", "203.0.113.9, 192.0.2.7"))).Equal("203.0.113.9")
+			gob.Assert(proxies.ClientIP(request("127.0.0.1"))).Equal("127.0.0.1")
+		})
+	})
+}
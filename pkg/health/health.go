@@ -0,0 +1,92 @@
+// Package health serves the liveness and readiness probes of the orchestrator
+package health
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// Check return an error when the dependency cannot be used
+type Check func(ctx context.Context) error
+
+// Checker answers /healthz and /readyz
+type Checker struct {
+	// Checks are run on every readiness probe, by name
+	Checks map[string]Check
+	// Timeout is how long all the checks get together, 2 seconds when 0
+	Timeout time.Duration
+
+	mutex    sync.RWMutex
+	draining bool
+}
+
+// NewChecker return a Checker running the checks
+func NewChecker(checks map[string]Check) *Checker {
+	return &Checker{Checks: checks}
+}
+
+// Drain makes the readiness probe fail so no new requests are sent while shutting down
+func (c *Checker) Drain() {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.draining = true
+}
+
+func (c *Checker) isDraining() bool {
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+	return c.draining
+}
+
+// Live answers the liveness probe, the process is up as long as it can answer
+func (c *Checker) Live(res http.ResponseWriter, req *http.Request) {
+	res.Header().Set("Content-Type", "text/plain")
+	res.Write([]byte("ok"))
+}
+
+// Ready answers the readiness probe with the result of every check, 503 when any failed
+func (c *Checker) Ready(res http.ResponseWriter, req *http.Request) {
+	status := map[string]string{}
+	ok := true
+	if c.isDraining() {
+		status["server"] = "shutting down"
+		ok = false
+	} else {
+		timeout := c.Timeout
+		if timeout <= 0 {
+			timeout = 2 * time.Second
+		}
+		ctx, cancel := context.WithTimeout(req.Context(), timeout)
+		defer cancel()
+
+		// run the checks side by side so one slow dependency does not hide the others
+		var mutex sync.Mutex
+		var wg sync.WaitGroup
+		for name, check := range c.Checks {
+			wg.Add(1)
+			go func(name string, check Check) {
+				defer wg.Done()
+				result := "ok"
+				if err := check(ctx); err != nil {
+					result = err.Error()
+				}
+				mutex.Lock()
+				status[name] = result
+				if result != "ok" {
+					ok = false
+				}
+				mutex.Unlock()
+			}(name, check)
+		}
+		wg.Wait()
+	}
+
+	res.Header().Set("Content-Type", "application/json")
+	if !ok {
+		res.WriteHeader(http.StatusServiceUnavailable)
+	}
+	json.NewEncoder(res).Encode(status)
+}
@@ -0,0 +1,65 @@
+package health
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	. "github.com/franela/goblin"
+)
+
+func TestHealth(t *testing.T) {
+	gob := Goblin(t)
+
+	ready := func(c *Checker) (int, map[string]string) {
+		res := httptest.NewRecorder()
+		c.Ready(res, httptest.NewRequest("GET", "/readyz", nil))
+		status := map[string]string{}
+		json.Unmarshal(res.Body.Bytes(), &status)
+		return res.Code, status
+	}
+
+	gob.Describe("Checker Test", func() {
+		gob.It("should always be live", func() {
+			res := httptest.NewRecorder()
+			NewChecker(nil).Live(res, httptest.NewRequest("GET", "/healthz", nil))
+			gob.Assert(res.Code).Equal(http.StatusOK)
+		})
+
+		gob.It("should be ready when every check passes", func() {
+			code, status := ready(NewChecker(map[string]Check{
+				"database": func(ctx context.Context) error { return nil },
+			}))
+			gob.Assert(code).Equal(http.StatusOK)
+			gob.Assert(status["database"]).Equal("ok")
+		})
+
+		gob.It("should report every failed check", func() {
+			c := NewChecker(map[string]Check{
+				"database": func(ctx context.Context) error { return errors.New("connection refused") },
+				"geocoder": func(ctx context.Context) error {
+					<-ctx.Done()
+					return ctx.Err()
+				},
+			})
+			c.Timeout = 10 * time.Millisecond
+			code, status := ready(c)
+			gob.Assert(code).Equal(http.StatusServiceUnavailable)
+			gob.Assert(status["database"]).Equal("connection refused")
+			gob.Assert(status["geocoder"]).Equal(context.DeadlineExceeded.Error())
+		})
+
+		gob.It("should not be ready once draining", func() {
+			c := NewChecker(map[string]Check{
+				"database": func(ctx context.Context) error { return nil },
+			})
+			c.Drain()
+			code, _ := ready(c)
+			gob.Assert(code).Equal(http.StatusServiceUnavailable)
+		})
+	})
+}
@@ -0,0 +1,251 @@
+// Package logging sets up the structured logger, keeps secrets out of it and puts the
+// request id, the user and the trace id on every line logged while answering a request
+package logging
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Header carries the request id, it is taken from the client when valid and sent back
+const Header = "X-Request-ID"
+
+// Redacted replaces every secret logged
+const Redacted = "[REDACTED]"
+
+// keys whose value is never logged, matched as part of the lower case key
+var secretKeys = []string{"password", "pass", "secret", "token", "key", "authorization", "cookie", "code", "email"}
+
+var (
+	// an access key or password put in a url, as the api does with accessKey
+	secretParam = regexp.MustCompile(`(?i)((?:access)?key|token|password|code)=[^&\s"]+`)
+	emailValue  = regexp.MustCompile(`[A-Za-z0-9._%+'-]+@[A-Za-z0-9.-]+\.[A-Za-z]{2,}`)
+	validID     = regexp.MustCompile(`^[A-Za-z0-9._-]{1,64}$`)
+)
+
+// ParseLevel return the level of debug, info, warn or error
+func ParseLevel(s string) (slog.Level, error) {
+	var level slog.Level
+	if err := level.UnmarshalText([]byte(s)); err != nil {
+		return 0, fmt.Errorf("unknown level %q, use debug, info, warn or error", s)
+	}
+	return level, nil
+}
+
+// New return a logger writing JSON, or logfmt when format is text, from the level up
+func New(w io.Writer, format string, level slog.Level) *slog.Logger {
+	opts := &slog.HandlerOptions{Level: level, ReplaceAttr: redact}
+	var h slog.Handler
+	if format == "text" {
+		h = slog.NewTextHandler(w, opts)
+	} else {
+		h = slog.NewJSONHandler(w, opts)
+	}
+	return slog.New(contextHandler{h})
+}
+
+// Setup makes the logger the default one, the standard log package writes through it too
+func Setup(w io.Writer, format string, level slog.Level) {
+	slog.SetDefault(New(w, format, level))
+}
+
+// Redact return the string with the emails and the secrets in urls replaced
+func Redact(s string) string {
+	s = secretParam.ReplaceAllString(s, "$1="+Redacted)
+	return emailValue.ReplaceAllString(s, Redacted)
+}
+
+func isSecret(key string) bool {
+	key = strings.ToLower(key)
+	for _, k := range secretKeys {
+		if strings.Contains(key, k) {
+			return true
+		}
+	}
+	return false
+}
+
+// redact drops the values of secret keys and cleans the strings and errors of the others
+func redact(groups []string, a slog.Attr) slog.Attr {
+	if a.Value.Kind() == slog.KindGroup {
+		return a
+	}
+	if isSecret(a.Key) {
+		return slog.String(a.Key, Redacted)
+	}
+	switch a.Value.Kind() {
+	case slog.KindString:
+		return slog.String(a.Key, Redact(a.Value.String()))
+	case slog.KindAny:
+		if err, ok := a.Value.Any().(error); ok {
+			return slog.String(a.Key, Redact(err.Error()))
+		}
+	}
+	return a
+}
+
+type requestKey struct{}
+
+// request is what is known about the request being answered, the user once logged in
+type request struct {
+	id string
+
+	mutex sync.Mutex
+	user  string
+}
+
+// WithRequestID return the context carrying the request id
+func WithRequestID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, requestKey{}, &request{id: id})
+}
+
+// RequestID return the id of the request, empty when there is none
+func RequestID(ctx context.Context) string {
+	if r, ok := ctx.Value(requestKey{}).(*request); ok {
+		return r.id
+	}
+	return ""
+}
+
+// SetUser puts the username on the lines logged for the rest of the request
+func SetUser(ctx context.Context, username string) {
+	if r, ok := ctx.Value(requestKey{}).(*request); ok {
+		r.mutex.Lock()
+		r.user = username
+		r.mutex.Unlock()
+	}
+}
+
+func (r *request) username() string {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	return r.user
+}
+
+// contextHandler adds the request id, the user and the trace id of the context to every line
+type contextHandler struct {
+	slog.Handler
+}
+
+func (h contextHandler) Handle(ctx context.Context, rec slog.Record) error {
+	if r, ok := ctx.Value(requestKey{}).(*request); ok {
+		rec.AddAttrs(slog.String("request_id", r.id))
+		if user := r.username(); user != "" {
+			rec.AddAttrs(slog.String("user", user))
+		}
+	}
+	// the trace id finds the spans of the request in the tracing backend
+	if sc := trace.SpanContextFromContext(ctx); sc.IsValid() {
+		rec.AddAttrs(slog.String("trace_id", sc.TraceID().String()))
+	}
+	return h.Handler.Handle(ctx, rec)
+}
+
+func (h contextHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return contextHandler{h.Handler.WithAttrs(attrs)}
+}
+
+func (h contextHandler) WithGroup(name string) slog.Handler {
+	return contextHandler{h.Handler.WithGroup(name)}
+}
+
+// return a random request id
+func newID() string {
+	b := make([]byte, 8)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// recorder keeps the status code and the size of the response
+type recorder struct {
+	http.ResponseWriter
+	code  int
+	bytes int
+}
+
+func (r *recorder) WriteHeader(code int) {
+	if r.code == 0 {
+		r.code = code
+	}
+	r.ResponseWriter.WriteHeader(code)
+}
+
+func (r *recorder) Write(b []byte) (int, error) {
+	if r.code == 0 {
+		r.code = http.StatusOK
+	}
+	n, err := r.ResponseWriter.Write(b)
+	r.bytes += n
+	return n, err
+}
+
+// Flush lets the exports stream through the recorder
+func (r *recorder) Flush() {
+	if f, ok := r.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// Middleware gives the request an id, keeps it in the context for every line logged while
+// answering and writes an access log line once answered. The query is left out of the
+// access log as the api takes the access key in it.
+func Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+		id := req.Header.Get(Header)
+		if !validID.MatchString(id) {
+			id = newID()
+		}
+		res.Header().Set(Header, id)
+		ctx := WithRequestID(req.Context(), id)
+
+		rec := &recorder{ResponseWriter: res}
+		start := time.Now()
+		next.ServeHTTP(rec, req.WithContext(ctx))
+
+		if rec.code == 0 {
+			rec.code = http.StatusOK
+		}
+		slog.LogAttrs(ctx, slog.LevelInfo, "request",
+			slog.String("method", req.Method),
+			slog.String("path", req.URL.Path),
+			slog.Int("status", rec.code),
+			slog.Int("bytes", rec.bytes),
+			slog.Float64("duration_ms", float64(time.Since(start).Microseconds())/1000),
+			slog.String("remote_addr", req.RemoteAddr),
+			slog.String("user_agent", req.UserAgent()),
+		)
+	})
+}
+
+// transport sends the request id of the context along
+type transport struct {
+	base http.RoundTripper
+}
+
+// Transport return a RoundTripper sending the request id of the request context in the
+// Header, so the lines logged by the api share the id of the page calling it
+func Transport(base http.RoundTripper) http.RoundTripper {
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	return transport{base}
+}
+
+func (t transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if id := RequestID(req.Context()); id != "" && req.Header.Get(Header) == "" {
+		req = req.Clone(req.Context())
+		req.Header.Set(Header, id)
+	}
+	return t.base.RoundTrip(req)
+}
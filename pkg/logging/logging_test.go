@@ -0,0 +1,129 @@
+package logging
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	. "github.com/franela/goblin"
+)
+
+// lines return every JSON line logged
+func lines(buf *bytes.Buffer) []map[string]interface{} {
+	all := []map[string]interface{}{}
+	for _, line := range strings.Split(strings.TrimSpace(buf.String()), "\n") {
+		m := map[string]interface{}{}
+		json.Unmarshal([]byte(line), &m)
+		all = append(all, m)
+	}
+	return all
+}
+
+func TestLogging(t *testing.T) {
+	gob := Goblin(t)
+
+	gob.Describe("Redact Test", func() {
+		gob.It("should not log secrets", func() {
+			var buf bytes.Buffer
+			logger := New(&buf, "json", slog.LevelInfo)
+			logger.Info("sent to jiahao@example.com",
+				"password", "hunter2",
+				"accessKey", "0b5a7c1e",
+				"error", errors.New(`Patch "https://localhost:5221/api/v1/users/jiahao?accessKey=0b5a7c1e": EOF`),
+				"username", "jiahao",
+			)
+			out := buf.String()
+			gob.Assert(strings.Contains(out, "hunter2")).IsFalse()
+			gob.Assert(strings.Contains(out, "0b5a7c1e")).IsFalse()
+			gob.Assert(strings.Contains(out, "jiahao@example.com")).IsFalse()
+
+			line := lines(&buf)[0]
+			gob.Assert(line["password"]).Equal(Redacted)
+			gob.Assert(line["username"]).Equal("jiahao")
+			gob.Assert(strings.Contains(line["error"].(string), "accessKey="+Redacted)).IsTrue()
+		})
+
+		gob.It("should leave out the lines below the level", func() {
+			var buf bytes.Buffer
+			New(&buf, "text", slog.LevelWarn).Info("not shown")
+			gob.Assert(buf.Len()).Equal(0)
+		})
+
+		gob.It("should only know the levels", func() {
+			level, err := ParseLevel("debug")
+			gob.Assert(err).IsNil()
+			gob.Assert(level).Equal(slog.LevelDebug)
+			_, err = ParseLevel("loud")
+			gob.Assert(err != nil).IsTrue()
+		})
+	})
+
+	gob.Describe("Middleware Test", func() {
+		serve := func(buf *bytes.Buffer, id string) *httptest.ResponseRecorder {
+			logger := New(buf, "json", slog.LevelInfo)
+			previous := slog.Default()
+			slog.SetDefault(logger)
+			defer slog.SetDefault(previous)
+
+			handler := Middleware(http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+				SetUser(req.Context(), "jiahao")
+				slog.WarnContext(req.Context(), "profile update refused by the api")
+				res.WriteHeader(http.StatusForbidden)
+			}))
+			req := httptest.NewRequest("PATCH", "/api/v1/users/jiahao?accessKey=0b5a7c1e", nil)
+			if id != "" {
+				req.Header.Set(Header, id)
+			}
+			res := httptest.NewRecorder()
+			handler.ServeHTTP(res, req)
+			return res
+		}
+
+		gob.It("should put the request id and the user on every line", func() {
+			var buf bytes.Buffer
+			res := serve(&buf, "")
+			id := res.Header().Get(Header)
+			gob.Assert(id != "").IsTrue()
+
+			all := lines(&buf)
+			gob.Assert(len(all)).Equal(2)
+			for _, line := range all {
+				gob.Assert(line["request_id"]).Equal(id)
+				gob.Assert(line["user"]).Equal("jiahao")
+			}
+			access := all[1]
+			gob.Assert(access["msg"]).Equal("request")
+			gob.Assert(access["path"]).Equal("/api/v1/users/jiahao")
+			gob.Assert(access["status"]).Equal(float64(http.StatusForbidden))
+			gob.Assert(strings.Contains(buf.String(), "0b5a7c1e")).IsFalse()
+		})
+
+		gob.It("should keep a valid request id from the client only", func() {
+			var buf bytes.Buffer
+			gob.Assert(serve(&buf, "from-the-page").Header().Get(Header)).Equal("from-the-page")
+			gob.Assert(serve(&buf, "bad id\n").Header().Get(Header) != "bad id\n").IsTrue()
+		})
+	})
+
+	gob.Describe("Transport Test", func() {
+		gob.It("should send the request id of the context along", func() {
+			var got string
+			api := httptest.NewServer(http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+				got = req.Header.Get(Header)
+			}))
+			defer api.Close()
+
+			client := &http.Client{Transport: Transport(nil)}
+			req, _ := http.NewRequestWithContext(WithRequestID(httptest.NewRequest("GET", "/", nil).Context(), "abc123"), "GET", api.URL, nil)
+			res, err := client.Do(req)
+			gob.Assert(err).IsNil()
+			res.Body.Close()
+			gob.Assert(got).Equal("abc123")
+		})
+	})
+}
@@ -0,0 +1,184 @@
+// Package metrics keeps the Prometheus metrics of the server and serves them at /metrics
+package metrics
+
+import (
+	"context"
+	"crypto/subtle"
+	"database/sql"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// Registry holds every metric of the server, with the go runtime and process ones
+var Registry = prometheus.NewRegistry()
+
+var (
+	// Requests counts the http requests by route template, method and status code
+	Requests = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "hireme_http_requests_total",
+		Help: "HTTP requests by route template, method and status code.",
+	}, []string{"route", "method", "code"})
+
+	// RequestDuration is the time taken to answer by route template and method
+	RequestDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "hireme_http_request_duration_seconds",
+		Help:    "Time taken to answer HTTP requests by route template and method.",
+		Buckets: prometheus.DefBuckets,
+	}, []string{"route", "method"})
+
+	// QueryDuration is the time taken by the database queries by name
+	QueryDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "hireme_db_query_duration_seconds",
+		Help:    "Time taken by database queries by name.",
+		Buckets: []float64{.001, .0025, .005, .01, .025, .05, .1, .25, .5, 1, 2.5},
+	}, []string{"query"})
+
+	// GeocoderRequests counts the calls to the geocoding api by result, ok, invalid or error
+	GeocoderRequests = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "hireme_geocoder_requests_total",
+		Help: "Calls to the geocoding api by result: ok, invalid (no match) or error.",
+	}, []string{"result"})
+
+	// GeocoderCache counts the lookups of the geocoder cache by result, hit or miss
+	GeocoderCache = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "hireme_geocoder_cache_total",
+		Help: "Lookups of the geocoder cache by result: hit or miss.",
+	}, []string{"result"})
+
+	// Logins counts the login attempts by result, success, failure or locked
+	Logins = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "hireme_logins_total",
+		Help: "Login attempts by result: success, failure or locked.",
+	}, []string{"result"})
+
+	// ActiveSessions is the number of users logged in to the pages
+	ActiveSessions = prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "hireme_active_sessions",
+		Help: "Users logged in to the pages.",
+	})
+)
+
+func init() {
+	Registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		Requests, RequestDuration, QueryDuration,
+		GeocoderRequests, GeocoderCache, Logins, ActiveSessions,
+	)
+}
+
+// the pool stats collector registered last, replaced when the pool is
+var (
+	dbMutex     sync.Mutex
+	dbCollector prometheus.Collector
+)
+
+// RegisterDB exports the stats of the connection pool, open, idle and in use connections and waits
+func RegisterDB(db *sql.DB) {
+	dbMutex.Lock()
+	defer dbMutex.Unlock()
+	if dbCollector != nil {
+		Registry.Unregister(dbCollector)
+	}
+	dbCollector = collectors.NewDBStatsCollector(db, "hireme")
+	Registry.MustRegister(dbCollector)
+}
+
+// ObserveQuery starts timing the query, call the func it returns once it is done
+func ObserveQuery(name string) func() {
+	start := time.Now()
+	return func() {
+		QueryDuration.WithLabelValues(name).Observe(time.Since(start).Seconds())
+	}
+}
+
+// Handler serves every metric in the Prometheus text format, only to a scraper sending
+// the token as a bearer token when it is not empty
+func Handler(token string) http.Handler {
+	metrics := promhttp.HandlerFor(Registry, promhttp.HandlerOpts{})
+	if token == "" {
+		return metrics
+	}
+	want := []byte("Bearer " + token)
+	return http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+		if subtle.ConstantTimeCompare([]byte(req.Header.Get("Authorization")), want) != 1 {
+			res.WriteHeader(http.StatusUnauthorized)
+			res.Write([]byte("401 - Unauthorized"))
+			return
+		}
+		metrics.ServeHTTP(res, req)
+	})
+}
+
+type routeKey struct{}
+
+// route is filled in by every router the request goes through, the innermost match wins
+type route struct {
+	template string
+}
+
+// recorder keeps the status code written
+type recorder struct {
+	http.ResponseWriter
+	code int
+}
+
+func (r *recorder) WriteHeader(code int) {
+	if r.code == 0 {
+		r.code = code
+	}
+	r.ResponseWriter.WriteHeader(code)
+}
+
+func (r *recorder) Write(b []byte) (int, error) {
+	if r.code == 0 {
+		r.code = http.StatusOK
+	}
+	return r.ResponseWriter.Write(b)
+}
+
+// Flush lets the exports stream through the recorder
+func (r *recorder) Flush() {
+	if f, ok := r.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// Middleware counts and times the requests by the template of the mux route they matched,
+// so /api/v1/users/jiahao and /api/v1/users/admin are both /api/v1/users/{username}.
+// A router mounted inside another one should use it too, its routes are more precise.
+func Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+		template := "unknown"
+		if current := mux.CurrentRoute(req); current != nil {
+			if t, err := current.GetPathTemplate(); err == nil {
+				template = t
+			}
+		}
+
+		// an outer router already records the request, only tell it the route
+		if r, ok := req.Context().Value(routeKey{}).(*route); ok {
+			r.template = template
+			next.ServeHTTP(res, req)
+			return
+		}
+
+		r := &route{template}
+		rec := &recorder{ResponseWriter: res}
+		start := time.Now()
+		next.ServeHTTP(rec, req.WithContext(context.WithValue(req.Context(), routeKey{}, r)))
+
+		if rec.code == 0 {
+			rec.code = http.StatusOK
+		}
+		RequestDuration.WithLabelValues(r.template, req.Method).Observe(time.Since(start).Seconds())
+		Requests.WithLabelValues(r.template, req.Method, strconv.Itoa(rec.code)).Inc()
+	})
+}
@@ -0,0 +1,68 @@
+package metrics
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	. "github.com/franela/goblin"
+	"github.com/gorilla/mux"
+)
+
+// scrape return the text the Handler serves
+func scrape(token, auth string) (int, string) {
+	req := httptest.NewRequest("GET", "/metrics", nil)
+	if auth != "" {
+		req.Header.Set("Authorization", auth)
+	}
+	res := httptest.NewRecorder()
+	Handler(token).ServeHTTP(res, req)
+	return res.Code, res.Body.String()
+}
+
+func TestMetrics(t *testing.T) {
+	gob := Goblin(t)
+
+	gob.Describe("Middleware Test", func() {
+		gob.It("should count the requests by route template", func() {
+			router := mux.NewRouter()
+			router.Use(Middleware)
+			router.HandleFunc("/api/v1/users/{username}", func(res http.ResponseWriter, req *http.Request) {
+				res.WriteHeader(http.StatusNotFound)
+			})
+			router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/api/v1/users/jiahao", nil))
+			router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/api/v1/users/admin", nil))
+
+			_, body := scrape("", "")
+			gob.Assert(strings.Contains(body, `hireme_http_requests_total{code="404",method="GET",route="/api/v1/users/{username}"} 2`)).IsTrue()
+			gob.Assert(strings.Contains(body, "jiahao")).IsFalse()
+		})
+
+		gob.It("should use the route of the innermost router", func() {
+			inner := mux.NewRouter()
+			inner.Use(Middleware)
+			inner.HandleFunc("/activity/export", func(res http.ResponseWriter, req *http.Request) {})
+			outer := mux.NewRouter()
+			outer.Use(Middleware)
+			outer.PathPrefix("/").Handler(inner)
+			outer.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/activity/export", nil))
+
+			_, body := scrape("", "")
+			gob.Assert(strings.Contains(body, `hireme_http_requests_total{code="200",method="GET",route="/activity/export"} 1`)).IsTrue()
+			gob.Assert(strings.Contains(body, `route="/"`)).IsFalse()
+		})
+	})
+
+	gob.Describe("Handler Test", func() {
+		gob.It("should only serve a scraper with the token", func() {
+			code, _ := scrape("secret", "")
+			gob.Assert(code).Equal(http.StatusUnauthorized)
+			code, _ = scrape("secret", "Bearer wrong")
+			gob.Assert(code).Equal(http.StatusUnauthorized)
+			code, body := scrape("secret", "Bearer secret")
+			gob.Assert(code).Equal(http.StatusOK)
+			gob.Assert(strings.Contains(body, "go_goroutines")).IsTrue()
+		})
+	})
+}
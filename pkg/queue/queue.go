@@ -2,83 +2,114 @@
 package queue
 
 import (
-	"errors"
+	"sort"
+	"strings"
+	"sync"
+	"time"
 )
 
-// History struct
-type History struct {
-	Time     string
-	Activity string
+// Kind is the type of activity a History records
+type Kind string
+
+// All the kind of activity a user can do
+const (
+	LoginSuccess  Kind = "login_success"
+	LoginFailure  Kind = "login_failure"
+	Filter        Kind = "filter"
+	ProfileUpdate Kind = "profile_update"
+	Logout        Kind = "logout"
+	Signup        Kind = "signup"
+	TwoFactor     Kind = "two_factor"
+)
+
+// Kinds list every Kind in the order shown to the user
+var Kinds = []Kind{LoginSuccess, LoginFailure, Filter, ProfileUpdate, Logout, Signup, TwoFactor}
+
+var kindLabel = map[Kind]string{
+	LoginSuccess:  "Successfully login",
+	LoginFailure:  "Failed to login",
+	Filter:        "Filter",
+	ProfileUpdate: "Updated Profile",
+	Logout:        "Logout",
+	Signup:        "Sign up",
+	TwoFactor:     "Two-factor authentication",
 }
 
-type node struct {
-	item History
-	next *node
+// Label return the human readable name of the kind
+func (k Kind) Label() string {
+	if label, ok := kindLabel[k]; ok {
+		return label
+	}
+	return string(k)
 }
 
-// Queue struct
-type Queue struct {
-	front *node
-	back  *node
-	size  int
+// History is one activity done by the user
+type History struct {
+	Kind      Kind
+	Time      time.Time
+	IP        string
+	UserAgent string
+	// Payload holds the details of the activity, e.g. the filter criteria
+	Payload map[string][]string
 }
 
-// Enqueue add history to the back
-func (p *Queue) Enqueue(h History) {
-	newNode := &node{
-		item: h,
-		next: nil,
+// Summary return the payload as one line, e.g. "exp: 3; type: Part-time, Internship"
+func (h History) Summary() string {
+	keys := make([]string, 0, len(h.Payload))
+	for k := range h.Payload {
+		keys = append(keys, k)
 	}
-	if p.front == nil {
-		p.front = newNode
-
-	} else {
-		//cap it at 10
-		if p.size >= 10 {
-			p.Dequeue()
-		}
-
-		p.back.next = newNode
+	sort.Strings(keys)
 
+	parts := make([]string, 0, len(keys))
+	for _, k := range keys {
+		parts = append(parts, k+": "+strings.Join(h.Payload[k], ", "))
 	}
-	p.back = newNode
-	p.size++
+	return strings.Join(parts, "; ")
 }
 
-// Dequeue remove histroy from the front
-func (p *Queue) Dequeue() (History, error) {
-	var item History
-
-	if p.front == nil {
-		return History{}, errors.New("empty queue")
-	}
+// DefaultLimit is the number of history a Queue keeps when Limit is not set
+const DefaultLimit = 10
 
-	item = p.front.item
-	if p.size == 1 {
-		p.front = nil
-		p.back = nil
-	} else {
-		p.front = p.front.next
-	}
-	p.size--
-	return item, nil
+// Queue is a Ring of History that drops the oldest history when full.
+// The zero value is ready to use and it is safe for concurrent use.
+type Queue struct {
+	// Limit caps the number of history kept, it has to be set before the first Enqueue
+	Limit int
+	once  sync.Once
+	ring  *Ring[History]
 }
 
-// AllHistory return all of the history in slice
-func (p *Queue) AllHistory() []History {
-	currentNode := p.front
+func (p *Queue) init() {
+	p.once.Do(func() {
+		limit := p.Limit
+		if limit <= 0 {
+			limit = DefaultLimit
+		}
+		p.ring = NewRing[History](limit, DropOldest)
+	})
+}
 
-	data := []History{}
+// Enqueue add history to the back
+func (p *Queue) Enqueue(h History) {
+	p.init()
+	p.ring.Push(h)
+}
 
-	if currentNode == nil {
-		data = append(data, History{})
-		return data
-	}
+// Dequeue remove histroy from the front
+func (p *Queue) Dequeue() (History, error) {
+	p.init()
+	return p.ring.Pop()
+}
 
-	for currentNode != nil {
-		data = append(data, currentNode.item)
-		currentNode = currentNode.next
-	}
+// Len return the number of history in the queue
+func (p *Queue) Len() int {
+	p.init()
+	return p.ring.Len()
+}
 
-	return data
+// AllHistory return all of the history in slice, oldest first
+func (p *Queue) AllHistory() []History {
+	p.init()
+	return p.ring.Snapshot()
 }
@@ -3,10 +3,20 @@ package queue
 import (
 	"fmt"
 	"testing"
+	"time"
 
 	. "github.com/franela/goblin"
 )
 
+// keyword return a filter history searching for i
+func keyword(i int) History {
+	return History{
+		Kind:    Filter,
+		Time:    time.Date(2006, 1, 2, 15, 4, 0, 0, time.UTC),
+		Payload: map[string][]string{"keyword": {fmt.Sprintf("%v", i)}},
+	}
+}
+
 func TestQueue(t *testing.T) {
 	gob := Goblin(t)
 
@@ -14,26 +24,26 @@ func TestQueue(t *testing.T) {
 		history := Queue{}
 		gob.It("should check for enque", func() {
 			for i := 1; i <= 10; i++ {
-				history.Enqueue(History{"2006-01-02 3:04PM", fmt.Sprintf("%v", i)})
-				gob.Assert(history.size).Equal(i)
+				history.Enqueue(keyword(i))
+				gob.Assert(history.Len()).Equal(i)
 			}
 		})
 
 		gob.It("should check for enque cap of 10", func() {
-			history.Enqueue(History{"2006-01-02 3:04PM", "11"})
-			gob.Assert(history.size).Equal(10)
-			history.Enqueue(History{"2006-01-02 3:04PM", "12"})
-			gob.Assert(history.size).Equal(10)
-			history.Enqueue(History{"2006-01-02 3:04PM", "13"})
-			gob.Assert(history.size).Equal(10)
-			history.Enqueue(History{"2006-01-02 3:04PM", "14"})
-			gob.Assert(history.size).Equal(10)
+			history.Enqueue(keyword(11))
+			gob.Assert(history.Len()).Equal(10)
+			history.Enqueue(keyword(12))
+			gob.Assert(history.Len()).Equal(10)
+			history.Enqueue(keyword(13))
+			gob.Assert(history.Len()).Equal(10)
+			history.Enqueue(keyword(14))
+			gob.Assert(history.Len()).Equal(10)
 		})
 
 		gob.It("should check for dequeue", func() {
 			for i := 9; i >= 0; i-- {
 				history.Dequeue()
-				gob.Assert(history.size).Equal(i)
+				gob.Assert(history.Len()).Equal(i)
 			}
 		})
 
@@ -44,13 +54,17 @@ func TestQueue(t *testing.T) {
 			gob.Assert(err).Equal(fmt.Errorf("empty queue"))
 		})
 
+		gob.It("should get no history when empty", func() {
+			gob.Assert(len(history.AllHistory())).Equal(0)
+		})
+
 		gob.It("should get all history", func() {
 			// history after enqueue
 			for i := 1; i <= 10; i++ {
-				history.Enqueue(History{"2006-01-02 3:04PM", fmt.Sprintf("%v", i)})
+				history.Enqueue(keyword(i))
 				allHistory := history.AllHistory()
 				gob.Assert(len(allHistory)).Equal(i)
-				gob.Assert(allHistory[i-1]).Equal(History{"2006-01-02 3:04PM", fmt.Sprintf("%v", i)})
+				gob.Assert(allHistory[i-1]).Equal(keyword(i))
 			}
 
 			// history after dequeue
@@ -58,7 +72,7 @@ func TestQueue(t *testing.T) {
 				allHistory := history.AllHistory()
 				pop, _ := history.Dequeue()
 				gob.Assert(len(allHistory)).Equal(11 - i)
-				gob.Assert(pop).Equal(History{"2006-01-02 3:04PM", fmt.Sprintf("%v", i)})
+				gob.Assert(pop).Equal(keyword(i))
 			}
 		})
 	})
@@ -0,0 +1,169 @@
+package queue
+
+import (
+	"errors"
+	"sync"
+)
+
+// Overflow decides what Push does when the Ring is full
+type Overflow int
+
+const (
+	// DropOldest makes room by removing the oldest item
+	DropOldest Overflow = iota
+	// RejectNewest keeps the ring as it is and return ErrFull
+	RejectNewest
+)
+
+var (
+	// ErrEmpty is returned when there is nothing to pop or peek
+	ErrEmpty = errors.New("empty queue")
+	// ErrFull is returned by Push when the ring is full and rejects the newest item
+	ErrFull = errors.New("full queue")
+)
+
+// Ring is a bounded ring buffer that is safe for concurrent use.
+// Items go in at the back and come out from the front, oldest first.
+type Ring[T any] struct {
+	mutex    sync.RWMutex
+	items    []T
+	head     int
+	size     int
+	overflow Overflow
+}
+
+// NewRing return an empty Ring holding up to capacity items, it panics when capacity is less than 1
+func NewRing[T any](capacity int, overflow Overflow) *Ring[T] {
+	if capacity < 1 {
+		panic("queue: ring capacity must be at least 1")
+	}
+	return &Ring[T]{
+		items:    make([]T, capacity),
+		overflow: overflow,
+	}
+}
+
+// Push add the item to the back, following the overflow policy when full
+func (r *Ring[T]) Push(item T) error {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	if r.size == len(r.items) {
+		if r.overflow == RejectNewest {
+			return ErrFull
+		}
+		r.popLocked()
+	}
+	r.items[(r.head+r.size)%len(r.items)] = item
+	r.size++
+	return nil
+}
+
+// Pop remove and return the oldest item
+func (r *Ring[T]) Pop() (T, error) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	if r.size == 0 {
+		var zero T
+		return zero, ErrEmpty
+	}
+	return r.popLocked(), nil
+}
+
+func (r *Ring[T]) popLocked() T {
+	var zero T
+	item := r.items[r.head]
+	// clear the slot so the ring does not keep the item alive
+	r.items[r.head] = zero
+	r.head = (r.head + 1) % len(r.items)
+	r.size--
+	return item
+}
+
+// Peek return the oldest item without removing it
+func (r *Ring[T]) Peek() (T, error) {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+
+	if r.size == 0 {
+		var zero T
+		return zero, ErrEmpty
+	}
+	return r.items[r.head], nil
+}
+
+// PeekNewest return the newest item without removing it
+func (r *Ring[T]) PeekNewest() (T, error) {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+
+	if r.size == 0 {
+		var zero T
+		return zero, ErrEmpty
+	}
+	return r.items[(r.head+r.size-1)%len(r.items)], nil
+}
+
+// Len return the number of items in the ring
+func (r *Ring[T]) Len() int {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+	return r.size
+}
+
+// Cap return the most items the ring can hold
+func (r *Ring[T]) Cap() int {
+	return len(r.items)
+}
+
+// Clear remove every item
+func (r *Ring[T]) Clear() {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	var zero T
+	for i := range r.items {
+		r.items[i] = zero
+	}
+	r.head = 0
+	r.size = 0
+}
+
+// Snapshot return a copy of the items from oldest to newest
+func (r *Ring[T]) Snapshot() []T {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+
+	snapshot := make([]T, r.size)
+	for i := 0; i < r.size; i++ {
+		snapshot[i] = r.items[(r.head+i)%len(r.items)]
+	}
+	return snapshot
+}
+
+// Do calls fn on every item from oldest to newest until fn return false.
+// The ring is read locked meanwhile so fn must not change the ring.
+func (r *Ring[T]) Do(fn func(T) bool) {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+
+	for i := 0; i < r.size; i++ {
+		if !fn(r.items[(r.head+i)%len(r.items)]) {
+			return
+		}
+	}
+}
+
+// DoReverse calls fn on every item from newest to oldest until fn return false.
+// The ring is read locked meanwhile so fn must not change the ring.
+func (r *Ring[T]) DoReverse(fn func(T) bool) {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+
+	for i := r.size - 1; i >= 0; i-- {
+		if !fn(r.items[(r.head+i)%len(r.items)]) {
+			return
+		}
+	}
+}
@@ -0,0 +1,141 @@
+package queue
+
+import (
+	"sync"
+	"testing"
+
+	. "github.com/franela/goblin"
+)
+
+func TestRing(t *testing.T) {
+	gob := Goblin(t)
+
+	gob.Describe("Ring File Test", func() {
+		gob.It("should drop the oldest when full", func() {
+			ring := NewRing[int](3, DropOldest)
+			for i := 1; i <= 5; i++ {
+				gob.Assert(ring.Push(i)).IsNil()
+			}
+			gob.Assert(ring.Len()).Equal(3)
+			gob.Assert(ring.Cap()).Equal(3)
+			gob.Assert(ring.Snapshot()).Equal([]int{3, 4, 5})
+		})
+
+		gob.It("should reject the newest when full", func() {
+			ring := NewRing[int](2, RejectNewest)
+			ring.Push(1)
+			ring.Push(2)
+			gob.Assert(ring.Push(3)).Equal(ErrFull)
+			gob.Assert(ring.Snapshot()).Equal([]int{1, 2})
+		})
+
+		gob.It("should peek and pop in order", func() {
+			ring := NewRing[string](2, DropOldest)
+			_, err := ring.Peek()
+			gob.Assert(err).Equal(ErrEmpty)
+			_, err = ring.PeekNewest()
+			gob.Assert(err).Equal(ErrEmpty)
+
+			ring.Push("a")
+			ring.Push("b")
+			ring.Push("c")
+			oldest, _ := ring.Peek()
+			newest, _ := ring.PeekNewest()
+			gob.Assert(oldest).Equal("b")
+			gob.Assert(newest).Equal("c")
+
+			pop, _ := ring.Pop()
+			gob.Assert(pop).Equal("b")
+			pop, _ = ring.Pop()
+			gob.Assert(pop).Equal("c")
+			_, err = ring.Pop()
+			gob.Assert(err).Equal(ErrEmpty)
+		})
+
+		gob.It("should iterate both ways and stop early", func() {
+			ring := NewRing[int](4, DropOldest)
+			for i := 1; i <= 6; i++ {
+				ring.Push(i)
+			}
+
+			forward := []int{}
+			ring.Do(func(i int) bool {
+				forward = append(forward, i)
+				return true
+			})
+			gob.Assert(forward).Equal([]int{3, 4, 5, 6})
+
+			backward := []int{}
+			ring.DoReverse(func(i int) bool {
+				backward = append(backward, i)
+				return len(backward) < 2
+			})
+			gob.Assert(backward).Equal([]int{6, 5})
+		})
+
+		gob.It("should clear the ring", func() {
+			ring := NewRing[int](2, DropOldest)
+			ring.Push(1)
+			ring.Clear()
+			gob.Assert(ring.Len()).Equal(0)
+			gob.Assert(len(ring.Snapshot())).Equal(0)
+		})
+
+		gob.It("should be safe for concurrent use", func() {
+			ring := NewRing[int](100, DropOldest)
+			var wg sync.WaitGroup
+			for i := 0; i < 10; i++ {
+				wg.Add(1)
+				go func() {
+					for j := 0; j < 1000; j++ {
+						ring.Push(j)
+						ring.Snapshot()
+					}
+					wg.Done()
+				}()
+			}
+			wg.Wait()
+			gob.Assert(ring.Len()).Equal(100)
+		})
+	})
+}
+
+func BenchmarkRingPush(b *testing.B) {
+	ring := NewRing[History](DefaultLimit, DropOldest)
+	h := keyword(1)
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		ring.Push(h)
+	}
+}
+
+func BenchmarkRingPushParallel(b *testing.B) {
+	ring := NewRing[int](1024, DropOldest)
+	b.ReportAllocs()
+	b.RunParallel(func(pb *testing.PB) {
+		for i := 0; pb.Next(); i++ {
+			ring.Push(i)
+		}
+	})
+}
+
+func BenchmarkRingSnapshot(b *testing.B) {
+	ring := NewRing[int](1024, DropOldest)
+	for i := 0; i < 1024; i++ {
+		ring.Push(i)
+	}
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		ring.Snapshot()
+	}
+}
+
+func BenchmarkQueueEnqueue(b *testing.B) {
+	history := Queue{}
+	h := keyword(1)
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		history.Enqueue(h)
+	}
+}
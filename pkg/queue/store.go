@@ -0,0 +1,156 @@
+package queue
+
+import (
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Retention decides how much history an ActivityStore keeps for each user
+type Retention struct {
+	// MaxEntries is the number of history kept per user, 0 means DefaultLimit
+	MaxEntries int
+	// MaxAge drops history older than it, 0 keeps history forever
+	MaxAge time.Duration
+}
+
+// Entries return the per user cap with the default applied
+func (r Retention) Entries() int {
+	if r.MaxEntries <= 0 {
+		return DefaultLimit
+	}
+	return r.MaxEntries
+}
+
+// Query narrows down the history returned by Search, the zero value matches everything
+type Query struct {
+	// Kinds keeps only these kind of activity
+	Kinds []Kind
+	// From and To keep only history within the time range, either can be left zero
+	From time.Time
+	To   time.Time
+	// Text matches the payload, ip or user agent without caring about case
+	Text string
+}
+
+// Match checks if the history fits the query
+func (q Query) Match(h History) bool {
+	if len(q.Kinds) > 0 {
+		found := false
+		for _, k := range q.Kinds {
+			if h.Kind == k {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+
+	if !q.From.IsZero() && h.Time.Before(q.From) {
+		return false
+	}
+	if !q.To.IsZero() && h.Time.After(q.To) {
+		return false
+	}
+
+	if q.Text != "" {
+		text := strings.ToLower(q.Text)
+		if !strings.Contains(strings.ToLower(h.Summary()), text) &&
+			!strings.Contains(strings.ToLower(h.IP), text) &&
+			!strings.Contains(strings.ToLower(h.UserAgent), text) {
+			return false
+		}
+	}
+	return true
+}
+
+// ActivityStore keeps the activity history of every user
+type ActivityStore interface {
+	// Add records the history for the user
+	Add(username string, h History) error
+	// Search return the newest matching history first, skipping offset of them, and the total number of matches
+	Search(username string, q Query, offset, limit int) ([]History, int, error)
+}
+
+// MemoryStore is an ActivityStore that keeps everything in memory and is lost on restart
+type MemoryStore struct {
+	Retention Retention
+	mutex     sync.RWMutex
+	queues    map[string]*Queue
+}
+
+// NewMemoryStore return an empty MemoryStore
+func NewMemoryStore(retention Retention) *MemoryStore {
+	return &MemoryStore{
+		Retention: retention,
+		queues:    map[string]*Queue{},
+	}
+}
+
+// Add enqueue the history into the user queue
+func (m *MemoryStore) Add(username string, h History) error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	if _, ok := m.queues[username]; !ok {
+		m.queues[username] = &Queue{Limit: m.Retention.Entries()}
+	}
+	m.queues[username].Enqueue(h)
+	return nil
+}
+
+// Search return a page of the user history matching the query, newest first
+func (m *MemoryStore) Search(username string, q Query, offset, limit int) ([]History, int, error) {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+
+	history, ok := m.queues[username]
+	if !ok {
+		return []History{}, 0, nil
+	}
+
+	newest := []History{}
+	history.ring.DoReverse(func(h History) bool {
+		expired := m.Retention.MaxAge > 0 && time.Since(h.Time) > m.Retention.MaxAge
+		if !expired && q.Match(h) {
+			newest = append(newest, h)
+		}
+		return true
+	})
+	return paginate(newest, offset, limit), len(newest), nil
+}
+
+func paginate(history []History, offset, limit int) []History {
+	if offset < 0 {
+		offset = 0
+	}
+	if offset >= len(history) {
+		return []History{}
+	}
+	end := len(history)
+	if limit > 0 && offset+limit < end {
+		end = offset + limit
+	}
+	return history[offset:end]
+}
+
+// QueryFromValues builds a Query from the kind, q, from and to form values,
+// from and to are dates in the 2006-01-02 format and to includes the whole day
+func QueryFromValues(v url.Values) Query {
+	q := Query{Text: strings.TrimSpace(v.Get("q"))}
+	for _, k := range v["kind"] {
+		if k != "" {
+			q.Kinds = append(q.Kinds, Kind(k))
+		}
+	}
+	if from, err := time.ParseInLocation("2006-01-02", v.Get("from"), time.Local); err == nil {
+		q.From = from
+	}
+	if to, err := time.ParseInLocation("2006-01-02", v.Get("to"), time.Local); err == nil {
+		q.To = to.Add(24*time.Hour - time.Nanosecond)
+	}
+	return q
+}
@@ -0,0 +1,80 @@
+package queue
+
+import (
+	"net/url"
+	"testing"
+	"time"
+
+	. "github.com/franela/goblin"
+)
+
+func TestMemoryStore(t *testing.T) {
+	gob := Goblin(t)
+
+	gob.Describe("Memory Store Test", func() {
+		store := NewMemoryStore(Retention{MaxEntries: 5})
+
+		gob.It("should return nothing for unknown user", func() {
+			history, total, err := store.Search("nobody", Query{}, 0, 10)
+			gob.Assert(err).IsNil()
+			gob.Assert(total).Equal(0)
+			gob.Assert(len(history)).Equal(0)
+		})
+
+		gob.It("should keep only the retention limit", func() {
+			for i := 1; i <= 7; i++ {
+				store.Add("jiahao", keyword(i))
+			}
+			_, total, _ := store.Search("jiahao", Query{}, 0, 0)
+			gob.Assert(total).Equal(5)
+		})
+
+		gob.It("should page newest first", func() {
+			history, total, _ := store.Search("jiahao", Query{}, 0, 2)
+			gob.Assert(total).Equal(5)
+			gob.Assert(len(history)).Equal(2)
+			gob.Assert(history[0].Payload["keyword"][0]).Equal("7")
+			gob.Assert(history[1].Payload["keyword"][0]).Equal("6")
+
+			history, _, _ = store.Search("jiahao", Query{}, 4, 2)
+			gob.Assert(len(history)).Equal(1)
+			gob.Assert(history[0].Payload["keyword"][0]).Equal("3")
+
+			history, _, _ = store.Search("jiahao", Query{}, 10, 2)
+			gob.Assert(len(history)).Equal(0)
+		})
+
+		gob.It("should search by kind and text", func() {
+			store.Add("jiahao", History{Kind: LoginFailure, Time: time.Now(), IP: "10.0.0.1"})
+
+			history, total, _ := store.Search("jiahao", Query{Kinds: []Kind{LoginFailure}}, 0, 10)
+			gob.Assert(total).Equal(1)
+			gob.Assert(history[0].IP).Equal("10.0.0.1")
+
+			_, total, _ = store.Search("jiahao", Query{Text: "10.0.0"}, 0, 10)
+			gob.Assert(total).Equal(1)
+
+			_, total, _ = store.Search("jiahao", Query{Kinds: []Kind{Filter}, Text: "KEYWORD: 5"}, 0, 10)
+			gob.Assert(total).Equal(1)
+		})
+
+		gob.It("should search by time range", func() {
+			since := time.Date(2007, 1, 1, 0, 0, 0, 0, time.UTC)
+			_, total, _ := store.Search("jiahao", Query{From: since}, 0, 10)
+			gob.Assert(total).Equal(1)
+			_, total, _ = store.Search("jiahao", Query{To: since}, 0, 10)
+			gob.Assert(total).Equal(4)
+		})
+
+		gob.It("should build a query from form values", func() {
+			q := QueryFromValues(url.Values{"kind": {"filter", ""}, "q": {" ip "}, "from": {"2006-01-02"}, "to": {"2006-01-02"}})
+			gob.Assert(q.Kinds).Equal([]Kind{Filter})
+			gob.Assert(q.Text).Equal("ip")
+			gob.Assert(q.Match(keyword(1))).IsFalse()
+			gob.Assert(q.To.Sub(q.From) < 24*time.Hour).IsTrue()
+
+			q = QueryFromValues(url.Values{"from": {"junk"}})
+			gob.Assert(q.From.IsZero()).IsTrue()
+		})
+	})
+}
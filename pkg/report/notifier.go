@@ -0,0 +1,100 @@
+package report
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/smtp"
+	"strings"
+	"time"
+)
+
+// Notifier tells the moderators about a case
+type Notifier interface {
+	Notify(n Notice) error
+}
+
+// Notifiers sends the notice through every notifier, it carries on when one fails
+type Notifiers []Notifier
+
+// Notify sends the notice through every notifier and return all the errors joined
+func (n Notifiers) Notify(notice Notice) error {
+	failed := []string{}
+	for _, notifier := range n {
+		if err := notifier.Notify(notice); err != nil {
+			failed = append(failed, err.Error())
+		}
+	}
+	if len(failed) > 0 {
+		return fmt.Errorf("notify: %s", strings.Join(failed, "; "))
+	}
+	return nil
+}
+
+// EmailNotifier mails the notice to the moderators
+type EmailNotifier struct {
+	// Addr is the host:port of the SMTP server
+	Addr string
+	From string
+	Auth smtp.Auth
+	// Moderators are the usernames mailed
+	Moderators []string
+	// Lookup return the email of the user, users without one are skipped
+	Lookup func(username string) string
+}
+
+// Notify mails the notice to every moderator with an email
+func (e *EmailNotifier) Notify(n Notice) error {
+	to := []string{}
+	for _, moderator := range e.Moderators {
+		if email := e.Lookup(moderator); email != "" {
+			to = append(to, email)
+		}
+	}
+	if len(to) == 0 {
+		return nil
+	}
+
+	subject := "HireMe profile reported: " + n.Case.Target
+	if n.Hide {
+		subject = "HireMe profile hidden: " + n.Case.Target
+	}
+	var msg bytes.Buffer
+	fmt.Fprintf(&msg, "From: %s\r\n", e.From)
+	fmt.Fprintf(&msg, "To: %s\r\n", strings.Join(to, ", "))
+	fmt.Fprintf(&msg, "Subject: %s\r\n", subject)
+	fmt.Fprintf(&msg, "Content-Type: text/plain; charset=UTF-8\r\n\r\n")
+	msg.WriteString(strings.ReplaceAll(n.Message(), "\n", "\r\n"))
+
+	return smtp.SendMail(e.Addr, e.Auth, e.From, to, msg.Bytes())
+}
+
+// WebhookNotifier POST the notice as JSON to a URL
+type WebhookNotifier struct {
+	URL    string
+	Client *http.Client
+}
+
+// Notify POST the notice to the webhook
+func (w *WebhookNotifier) Notify(n Notice) error {
+	jsonValue, err := json.Marshal(n)
+	if err != nil {
+		return err
+	}
+
+	client := w.Client
+	if client == nil {
+		client = &http.Client{Timeout: 10 * time.Second}
+	}
+	response, err := client.Post(w.URL, "application/json", bytes.NewBuffer(jsonValue))
+	if err != nil {
+		return err
+	}
+	response.Body.Close()
+
+	if response.StatusCode >= 300 {
+		return fmt.Errorf("webhook returned %s", response.Status)
+	}
+	return nil
+}
@@ -0,0 +1,71 @@
+package report
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// ErrAlreadyReported is returned by File and Store.Add when the reporter has an open report on the profile
+var ErrAlreadyReported = errors.New("already reported")
+
+// Queue files the reports for the moderators and decides when a profile has been reported
+// by enough users to be taken off the map before anyone looks at it
+type Queue struct {
+	Store Store
+	// HideAfter is the number of users reporting a profile that hides it, 0 never does
+	HideAfter int
+	// Notifier tells the moderators about the cases, nothing is sent when nil
+	Notifier Notifier
+}
+
+// Notice is what the moderators are told about a case
+type Notice struct {
+	Case Case
+	// Opened is set by the first report of the case
+	Opened bool
+	// Hide is set by a report that found HideAfter users or more on a profile not hidden, the profile should be hidden
+	Hide bool
+}
+
+// Message return the notice as text
+func (n Notice) Message() string {
+	var b strings.Builder
+	if n.Hide {
+		fmt.Fprintf(&b, "The profile of %s was reported by %d users and has been hidden from the map until it is reviewed.\n", n.Case.Target, n.Case.Reporters())
+	} else {
+		fmt.Fprintf(&b, "The profile of %s has been reported.\n", n.Case.Target)
+	}
+	b.WriteString("\n")
+	for _, r := range n.Case.Reports {
+		fmt.Fprintf(&b, "%s %s: %s", r.Time.Format("2006-01-02 15:04 MST"), r.Reporter, r.Reason.Label())
+		if r.Details != "" {
+			fmt.Fprintf(&b, " - %s", r.Details)
+		}
+		b.WriteString("\n")
+	}
+	b.WriteString("\nReview it in the admin section at /admin/reports.\n")
+	return b.String()
+}
+
+// Send tells whether the moderators should hear about the notice
+func (n Notice) Send() bool {
+	return n.Opened || n.Hide
+}
+
+// File adds the report to the case of the profile and return what became of the case. A
+// profile not hidden is hidden by any report that finds HideAfter users or more reported it,
+// hidden tells whether the profile is hidden already.
+func (q *Queue) File(r Report, hidden bool) (Notice, error) {
+	open, err := q.Store.Add(r)
+	if err != nil {
+		return Notice{}, err
+	}
+
+	c := Case{Target: r.Target, Reports: open}
+	return Notice{
+		Case:   c,
+		Opened: len(open) == 1,
+		Hide:   q.HideAfter > 0 && !hidden && c.Reporters() >= q.HideAfter,
+	}, nil
+}
@@ -0,0 +1,280 @@
+// Package report keeps the profiles reported by users until a moderator deals with them
+package report
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	uuid "github.com/satori/go.uuid"
+)
+
+// Reason is why a profile was reported
+type Reason string
+
+// All the reasons a profile can be reported for
+const (
+	Spam          Reason = "spam"
+	Abuse         Reason = "abuse"
+	Scam          Reason = "scam"
+	Inappropriate Reason = "inappropriate"
+	Other         Reason = "other"
+	// Flagged is filed by the content policy, users cannot pick it
+	Flagged Reason = "flagged"
+)
+
+// Reasons list every Reason a user can pick in the order shown to the user
+var Reasons = []Reason{Spam, Abuse, Scam, Inappropriate, Other}
+
+var reasonLabel = map[Reason]string{
+	Spam:          "Spam or advertising",
+	Abuse:         "Harassment or abusive message",
+	Scam:          "Scam or fraud",
+	Inappropriate: "Inappropriate content",
+	Other:         "Something else",
+	Flagged:       "Flagged by the content policy",
+}
+
+// Label return the human readable reason
+func (r Reason) Label() string {
+	if label, ok := reasonLabel[r]; ok {
+		return label
+	}
+	return string(r)
+}
+
+// Valid checks the reason is one of Reasons
+func (r Reason) Valid() bool {
+	for _, reason := range Reasons {
+		if r == reason {
+			return true
+		}
+	}
+	return false
+}
+
+// Outcome is what a moderator did about the reports
+type Outcome string
+
+// All the outcomes, a report without one is still open
+const (
+	Dismissed Outcome = "dismissed"
+	Hidden    Outcome = "hidden"
+	Disabled  Outcome = "disabled"
+)
+
+var outcomeLabel = map[Outcome]string{
+	"":        "Waiting for review",
+	Dismissed: "Reviewed, no action needed",
+	Hidden:    "Profile removed from the map",
+	Disabled:  "Account disabled",
+}
+
+// Label return the outcome as the reporter sees it
+func (o Outcome) Label() string {
+	if label, ok := outcomeLabel[o]; ok {
+		return label
+	}
+	return string(o)
+}
+
+// Report is one user reporting a profile
+type Report struct {
+	ID string
+	// Target is the username of the profile reported
+	Target   string
+	Reporter string
+	Reason   Reason
+	Details  string
+	Time     time.Time
+	// Outcome is empty until a moderator resolves the report
+	Outcome    Outcome
+	ResolvedBy string
+	ResolvedAt time.Time
+}
+
+// New return an open report with a fresh ID
+func New(target, reporter string, reason Reason, details string, at time.Time) Report {
+	return Report{
+		ID:       uuid.NewV4().String(),
+		Target:   target,
+		Reporter: reporter,
+		Reason:   reason,
+		Details:  details,
+		Time:     at,
+	}
+}
+
+// Case is a profile with open reports, shown to the moderators as one entry
+type Case struct {
+	Target string
+	// Reports are the open reports of the profile, oldest first
+	Reports []Report
+}
+
+// Reporters return the number of users who reported the profile, the Flagged reports of the
+// content policy are not from a user and do not count
+func (c Case) Reporters() int {
+	seen := map[string]bool{}
+	for _, r := range c.Reports {
+		if r.Reason != Flagged {
+			seen[r.Reporter] = true
+		}
+	}
+	return len(seen)
+}
+
+// Last return the time of the newest report
+func (c Case) Last() time.Time {
+	return c.Reports[len(c.Reports)-1].Time
+}
+
+// Group return the cases of the open reports, the ones reported by the most users first
+// then the ones waiting the longest
+func Group(reports []Report) []Case {
+	byTarget := map[string]*Case{}
+	cases := []*Case{}
+	for _, r := range reports {
+		if r.Outcome != "" {
+			continue
+		}
+		c, ok := byTarget[r.Target]
+		if !ok {
+			c = &Case{Target: r.Target}
+			byTarget[r.Target] = c
+			cases = append(cases, c)
+		}
+		c.Reports = append(c.Reports, r)
+	}
+
+	sorted := []Case{}
+	for _, c := range cases {
+		sort.SliceStable(c.Reports, func(i, j int) bool { return c.Reports[i].Time.Before(c.Reports[j].Time) })
+		sorted = append(sorted, *c)
+	}
+	sort.SliceStable(sorted, func(i, j int) bool {
+		if a, b := sorted[i].Reporters(), sorted[j].Reporters(); a != b {
+			return a > b
+		}
+		return sorted[i].Reports[0].Time.Before(sorted[j].Reports[0].Time)
+	})
+	return sorted
+}
+
+// Store keeps the reports
+type Store interface {
+	// Add keeps the report and return the open reports of the profile with it, oldest first. The
+	// check and the insert are one step so a reporter racing with themselves files one report,
+	// ErrAlreadyReported is returned when the reporter has an open report on the profile.
+	Add(r Report) ([]Report, error)
+	// Cases return a page of the cases in the order of Group and the total number of cases
+	Cases(offset, limit int) ([]Case, int, error)
+	// Open return the open reports of the profile, oldest first
+	Open(target string) ([]Report, error)
+	// Resolve closes every open report of the profile with the outcome and return how many it closed
+	Resolve(target string, outcome Outcome, by string, at time.Time) (int, error)
+	// ByReporter return a page of the reports filed by the user, newest first, and their total
+	ByReporter(reporter string, offset, limit int) ([]Report, int, error)
+}
+
+// page return the cases from offset, limit 0 means all of them
+func page(cases []Case, offset, limit int) []Case {
+	if offset >= len(cases) {
+		return []Case{}
+	}
+	cases = cases[offset:]
+	if limit > 0 && limit < len(cases) {
+		cases = cases[:limit]
+	}
+	return cases
+}
+
+// MemoryStore is a Store for a single instance
+type MemoryStore struct {
+	mutex   sync.Mutex
+	reports []Report
+}
+
+// NewMemoryStore return an empty MemoryStore
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{}
+}
+
+// Add keeps the report and return the open reports of the profile with it, oldest first
+func (m *MemoryStore) Add(r Report) ([]Report, error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	open := []Report{}
+	for _, o := range m.reports {
+		if o.Target != r.Target || o.Outcome != "" {
+			continue
+		}
+		if o.Reporter == r.Reporter {
+			return nil, ErrAlreadyReported
+		}
+		open = append(open, o)
+	}
+	m.reports = append(m.reports, r)
+	open = append(open, r)
+	sort.SliceStable(open, func(i, j int) bool { return open[i].Time.Before(open[j].Time) })
+	return open, nil
+}
+
+// Cases return a page of the cases in the order of Group and the total number of cases
+func (m *MemoryStore) Cases(offset, limit int) ([]Case, int, error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	cases := Group(m.reports)
+	return page(cases, offset, limit), len(cases), nil
+}
+
+// Open return the open reports of the profile, oldest first
+func (m *MemoryStore) Open(target string) ([]Report, error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	open := []Report{}
+	for _, c := range Group(m.reports) {
+		if c.Target == target {
+			open = c.Reports
+		}
+	}
+	return open, nil
+}
+
+// Resolve closes every open report of the profile with the outcome and return how many it closed
+func (m *MemoryStore) Resolve(target string, outcome Outcome, by string, at time.Time) (int, error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	closed := 0
+	for i := range m.reports {
+		if m.reports[i].Target == target && m.reports[i].Outcome == "" {
+			m.reports[i].Outcome = outcome
+			m.reports[i].ResolvedBy = by
+			m.reports[i].ResolvedAt = at
+			closed++
+		}
+	}
+	return closed, nil
+}
+
+// ByReporter return a page of the reports filed by the user, newest first, and their total
+func (m *MemoryStore) ByReporter(reporter string, offset, limit int) ([]Report, int, error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	filed := []Report{}
+	for i := len(m.reports) - 1; i >= 0; i-- {
+		if m.reports[i].Reporter == reporter {
+			filed = append(filed, m.reports[i])
+		}
+	}
+	sort.SliceStable(filed, func(i, j int) bool { return filed[i].Time.After(filed[j].Time) })
+	total := len(filed)
+	if offset >= total {
+		return []Report{}, total, nil
+	}
+	filed = filed[offset:]
+	if limit > 0 && limit < len(filed) {
+		filed = filed[:limit]
+	}
+	return filed, total, nil
+}
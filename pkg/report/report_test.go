@@ -0,0 +1,164 @@
+package report
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	. "github.com/franela/goblin"
+)
+
+func TestReport(t *testing.T) {
+	gob := Goblin(t)
+	now := time.Now()
+	targets := func(cases []Case) []string {
+		t := []string{}
+		for _, c := range cases {
+			t = append(t, c.Target)
+		}
+		return t
+	}
+
+	gob.Describe("Group Test", func() {
+		gob.It("should put the profiles reported by the most users first", func() {
+			cases := Group([]Report{
+				New("spammer", "a", Spam, "", now.Add(-3*time.Hour)),
+				New("rude", "a", Abuse, "", now.Add(-2*time.Hour)),
+				New("rude", "b", Abuse, "", now.Add(-time.Hour)),
+				// the same user twice counts once
+				New("spammer", "a", Spam, "", now),
+			})
+			gob.Assert(targets(cases)).Equal([]string{"rude", "spammer"})
+			gob.Assert(cases[0].Reporters()).Equal(2)
+			gob.Assert(cases[1].Reporters()).Equal(1)
+			gob.Assert(cases[1].Last()).Equal(now)
+		})
+
+		gob.It("should put the oldest first between equals", func() {
+			cases := Group([]Report{
+				New("second", "a", Spam, "", now),
+				New("first", "a", Spam, "", now.Add(-time.Hour)),
+			})
+			gob.Assert(targets(cases)).Equal([]string{"first", "second"})
+		})
+
+		gob.It("should label the reasons", func() {
+			gob.Assert(Spam.Label()).Equal("Spam or advertising")
+			gob.Assert(Reason("unknown").Label()).Equal("unknown")
+			gob.Assert(Scam.Valid()).IsTrue()
+			gob.Assert(Reason("unknown").Valid()).IsFalse()
+			gob.Assert(Flagged.Valid()).IsFalse()
+		})
+	})
+
+	gob.Describe("Memory Store Test", func() {
+		gob.It("should close the open reports of the profile only", func() {
+			store := NewMemoryStore()
+			store.Add(New("spammer", "a", Spam, "buy now", now.Add(-time.Hour)))
+			store.Add(New("spammer", "b", Scam, "", now))
+			store.Add(New("rude", "a", Abuse, "", now))
+
+			cases, total, _ := store.Cases(0, 1)
+			gob.Assert(total).Equal(2)
+			gob.Assert(targets(cases)).Equal([]string{"spammer"})
+
+			closed, _ := store.Resolve("spammer", Hidden, "admin", now)
+			gob.Assert(closed).Equal(2)
+			open, _ := store.Open("spammer")
+			gob.Assert(len(open)).Equal(0)
+
+			cases, total, _ = store.Cases(0, 0)
+			gob.Assert(total).Equal(1)
+			gob.Assert(targets(cases)).Equal([]string{"rude"})
+			cases, _, _ = store.Cases(5, 10)
+			gob.Assert(len(cases)).Equal(0)
+
+			// a new report opens a new case
+			store.Add(New("spammer", "c", Spam, "", now))
+			open, _ = store.Open("spammer")
+			gob.Assert(len(open)).Equal(1)
+		})
+	})
+
+	gob.Describe("Queue Test", func() {
+		gob.It("should hide the profile once enough users reported it", func() {
+			q := &Queue{Store: NewMemoryStore(), HideAfter: 2}
+
+			notice, err := q.File(New("spammer", "a", Spam, "", now), false)
+			gob.Assert(err).IsNil()
+			gob.Assert(notice.Opened).IsTrue()
+			gob.Assert(notice.Hide).IsFalse()
+			gob.Assert(notice.Send()).IsTrue()
+
+			_, err = q.File(New("spammer", "a", Scam, "", now), false)
+			gob.Assert(err).Equal(ErrAlreadyReported)
+
+			notice, _ = q.File(New("spammer", "b", Spam, "", now), false)
+			gob.Assert(notice.Opened).IsFalse()
+			gob.Assert(notice.Hide).IsTrue()
+			gob.Assert(notice.Case.Reporters()).Equal(2)
+
+			// already hidden, nothing to tell
+			notice, _ = q.File(New("spammer", "c", Spam, "", now), true)
+			gob.Assert(notice.Hide).IsFalse()
+			gob.Assert(notice.Send()).IsFalse()
+		})
+
+		gob.It("should hide a profile shown again past HideAfter", func() {
+			q := &Queue{Store: NewMemoryStore(), HideAfter: 2}
+			q.File(New("spammer", "a", Spam, "", now), false)
+			q.File(New("spammer", "b", Spam, "", now), true)
+
+			notice, _ := q.File(New("spammer", "c", Spam, "", now), false)
+			gob.Assert(notice.Case.Reporters()).Equal(3)
+			gob.Assert(notice.Hide).IsTrue()
+		})
+
+		gob.It("should not count the content policy as a reporter", func() {
+			q := &Queue{Store: NewMemoryStore(), HideAfter: 1}
+			notice, _ := q.File(New("spammer", "policy:content", Flagged, "", now), false)
+			gob.Assert(notice.Opened).IsTrue()
+			gob.Assert(notice.Hide).IsFalse()
+
+			notice, _ = q.File(New("spammer", "a", Spam, "", now), false)
+			gob.Assert(notice.Case.Reporters()).Equal(1)
+			gob.Assert(notice.Hide).IsTrue()
+		})
+
+		gob.It("should file one report of a reporter at the same time", func() {
+			q := &Queue{Store: NewMemoryStore()}
+			var wg sync.WaitGroup
+			for i := 0; i < 10; i++ {
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					q.File(New("spammer", "a", Spam, "", now), false)
+				}()
+			}
+			wg.Wait()
+			open, _ := q.Store.Open("spammer")
+			gob.Assert(len(open)).Equal(1)
+		})
+
+		gob.It("should never hide when HideAfter is 0", func() {
+			q := &Queue{Store: NewMemoryStore()}
+			notice, _ := q.File(New("spammer", "a", Spam, "", now), false)
+			gob.Assert(notice.Hide).IsFalse()
+		})
+
+		gob.It("should show the reporter the outcome of their reports", func() {
+			store := NewMemoryStore()
+			q := &Queue{Store: store}
+			q.File(New("spammer", "a", Spam, "", now.Add(-time.Hour)), false)
+			q.File(New("rude", "a", Abuse, "", now), false)
+			q.File(New("rude", "b", Abuse, "", now), false)
+			store.Resolve("spammer", Hidden, "admin", now)
+
+			filed, total, _ := store.ByReporter("a", 0, 10)
+			gob.Assert(total).Equal(2)
+			gob.Assert(filed[0].Target).Equal("rude")
+			gob.Assert(filed[0].Outcome.Label()).Equal("Waiting for review")
+			gob.Assert(filed[1].Outcome.Label()).Equal("Profile removed from the map")
+		})
+	})
+}
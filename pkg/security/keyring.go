@@ -0,0 +1,223 @@
+package security
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/md5"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"golang.org/x/crypto/hkdf"
+)
+
+// version of the ciphertext header written by Encrypt
+const headerVersion = 1
+
+// minimum length of a secret before it is derived into a key
+const minSecretLength = 16
+
+var (
+	// ErrNoKeyring is returned when there is no key to seal with
+	ErrNoKeyring = errors.New("no encryption key configured")
+	// ErrUnknownKey is returned when the ciphertext was sealed with a key not in the keyring
+	ErrUnknownKey = errors.New("unknown encryption key")
+)
+
+// Keyring holds the keys used to seal and open data. Data is always sealed with the primary key,
+// the other keys are kept so data sealed with them can still be opened.
+type Keyring struct {
+	primary string
+	keys    map[string]cipher.AEAD
+	// legacy opens data sealed before the keyring existed, nil when not allowed
+	legacy cipher.AEAD
+}
+
+// NewKeyring derives an AES-256 key from every secret with HKDF-SHA256, primary has to be one of the ids
+func NewKeyring(primary string, secrets map[string][]byte) (*Keyring, error) {
+	if len(secrets) == 0 {
+		return nil, ErrNoKeyring
+	}
+	if _, ok := secrets[primary]; !ok {
+		return nil, fmt.Errorf("primary key %q is not in the keyring", primary)
+	}
+
+	k := &Keyring{primary: primary, keys: map[string]cipher.AEAD{}}
+	for id, secret := range secrets {
+		if id == "" || len(id) > 255 || strings.ContainsAny(id, ":,\n") {
+			return nil, fmt.Errorf("invalid key id %q", id)
+		}
+		if len(secret) < minSecretLength {
+			return nil, fmt.Errorf("key %q is shorter than %d bytes", id, minSecretLength)
+		}
+
+		key := make([]byte, 32)
+		if _, err := io.ReadFull(hkdf.New(sha256.New, secret, nil, []byte("HireMe encryption key "+id)), key); err != nil {
+			return nil, err
+		}
+		aead, err := newGCM(key)
+		if err != nil {
+			return nil, err
+		}
+		k.keys[id] = aead
+	}
+	return k, nil
+}
+
+// AllowLegacy lets the keyring open data sealed by the old md5 scheme with the given secret,
+// it should only be kept until every row is rotated to the keyring
+func (k *Keyring) AllowLegacy(secret string) error {
+	key := md5.Sum([]byte(secret))
+	aead, err := newGCM(key[:])
+	if err != nil {
+		return err
+	}
+	k.legacy = aead
+	return nil
+}
+
+// Primary return the id of the key new data is sealed with
+func (k *Keyring) Primary() string {
+	return k.primary
+}
+
+// Encrypt seals the data with the primary key, the header carries the key id
+// and is authenticated along with the data
+func (k *Keyring) Encrypt(data []byte) ([]byte, error) {
+	aead := k.keys[k.primary]
+	header := append([]byte{headerVersion, byte(len(k.primary))}, k.primary...)
+
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return nil, err
+	}
+
+	sealed := make([]byte, 0, len(header)+len(nonce)+len(data)+aead.Overhead())
+	sealed = append(append(sealed, header...), nonce...)
+	return aead.Seal(sealed, nonce, data, header), nil
+}
+
+// Decrypt opens data sealed by any key in the keyring
+func (k *Keyring) Decrypt(data []byte) ([]byte, error) {
+	id, header, err := parseHeader(data)
+	if err == nil {
+		if aead, ok := k.keys[id]; ok {
+			decrypted, err := open(aead, data[len(header):], header)
+			if err == nil || k.legacy == nil {
+				return decrypted, err
+			}
+		}
+	}
+
+	// old data has no header so it can only be told apart by trying
+	if k.legacy != nil {
+		return open(k.legacy, data, nil)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return nil, ErrUnknownKey
+}
+
+// SealedWithPrimary checks that the primary key opens the data, data only an older key or the
+// legacy key opens still needs rotating
+func (k *Keyring) SealedWithPrimary(data []byte) bool {
+	id, header, err := parseHeader(data)
+	if err != nil || id != k.primary {
+		return false
+	}
+	_, err = open(k.keys[k.primary], data[len(header):], header)
+	return err == nil
+}
+
+// KeyID return the id of the key the data was sealed with
+func KeyID(data []byte) (string, error) {
+	id, _, err := parseHeader(data)
+	return id, err
+}
+
+func parseHeader(data []byte) (string, []byte, error) {
+	if len(data) < 2 || data[0] != headerVersion || len(data) < 2+int(data[1]) || data[1] == 0 {
+		return "", nil, fmt.Errorf("missing key header")
+	}
+	size := 2 + int(data[1])
+	return string(data[2:size]), data[:size], nil
+}
+
+func open(aead cipher.AEAD, data, additional []byte) ([]byte, error) {
+	nonceSize := aead.NonceSize()
+	if len(data) < nonceSize {
+		return nil, fmt.Errorf("ciphertext too short")
+	}
+	nonce, text := data[:nonceSize], data[nonceSize:]
+	return aead.Open(nil, nonce, text, additional)
+}
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// ParseKeys parses keys written as "id:base64secret" separated by commas or new lines,
+// blank lines and lines starting with # are skipped, the first key is the primary
+func ParseKeys(s string) (string, map[string][]byte, error) {
+	primary := ""
+	secrets := map[string][]byte{}
+
+	scanner := bufio.NewScanner(strings.NewReader(strings.ReplaceAll(s, ",", "\n")))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		parts := strings.SplitN(line, ":", 2)
+		if len(parts) != 2 {
+			return "", nil, fmt.Errorf("key %q is not in the id:base64secret format", parts[0])
+		}
+		id := strings.TrimSpace(parts[0])
+		secret, err := base64.StdEncoding.DecodeString(strings.TrimSpace(parts[1]))
+		if err != nil {
+			return "", nil, fmt.Errorf("key %q is not valid base64", id)
+		}
+		if _, ok := secrets[id]; ok {
+			return "", nil, fmt.Errorf("key %q is listed twice", id)
+		}
+		if primary == "" {
+			primary = id
+		}
+		secrets[id] = secret
+	}
+	return primary, secrets, scanner.Err()
+}
+
+// LoadKeyring builds the keyring from the keys given, or from the key file when keys is empty.
+// It fails when neither has a key so the server never starts with a known key.
+func LoadKeyring(keys, keyFile string) (*Keyring, error) {
+	if keys == "" && keyFile != "" {
+		content, err := os.ReadFile(keyFile)
+		if err != nil {
+			return nil, err
+		}
+		keys = string(bytes.TrimSpace(content))
+	}
+	if keys == "" {
+		return nil, ErrNoKeyring
+	}
+
+	primary, secrets, err := ParseKeys(keys)
+	if err != nil {
+		return nil, err
+	}
+	return NewKeyring(primary, secrets)
+}
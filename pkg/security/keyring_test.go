@@ -0,0 +1,118 @@
+package security
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/md5"
+	"encoding/base64"
+	"os"
+	"path/filepath"
+	"testing"
+
+	. "github.com/franela/goblin"
+)
+
+// legacySeal seals data the way Encrypt did before the keyring
+func legacySeal(data []byte, secret string) []byte {
+	key := md5.Sum([]byte(secret))
+	block, _ := aes.NewCipher(key[:])
+	aesgcm, _ := cipher.NewGCM(block)
+	nonce := make([]byte, aesgcm.NonceSize())
+	return aesgcm.Seal(nonce, nonce, data, nil)
+}
+
+func TestKeyring(t *testing.T) {
+	gob := Goblin(t)
+	secret := base64.StdEncoding.EncodeToString([]byte("0123456789abcdef"))
+	other := base64.StdEncoding.EncodeToString([]byte("fedcba9876543210"))
+
+	gob.Describe("Keyring File Test", func() {
+		gob.It("should fail closed without keys", func() {
+			_, err := LoadKeyring("", "")
+			gob.Assert(err).Equal(ErrNoKeyring)
+
+			_, err = NewPasswords(nil, DefaultPasswordParams, DefaultPasswordPolicy)
+			gob.Assert(err).Equal(ErrNoKeyring)
+		})
+
+		gob.It("should reject bad keys", func() {
+			_, err := LoadKeyring("k1", "")
+			gob.Assert(err).IsNotNil()
+			_, err = LoadKeyring("k1:not base64!", "")
+			gob.Assert(err).IsNotNil()
+			_, err = LoadKeyring("k1:"+base64.StdEncoding.EncodeToString([]byte("short")), "")
+			gob.Assert(err).IsNotNil()
+			_, err = LoadKeyring("k1:"+secret+",k1:"+other, "")
+			gob.Assert(err).IsNotNil()
+		})
+
+		gob.It("should tag ciphertext with the primary key id", func() {
+			k, err := LoadKeyring("k2:"+other+", k1:"+secret, "")
+			gob.Assert(err).IsNil()
+			gob.Assert(k.Primary()).Equal("k2")
+
+			sealed, _ := k.Encrypt([]byte("one"))
+			id, _ := KeyID(sealed)
+			gob.Assert(id).Equal("k2")
+			_, err = KeyID([]byte("no header"))
+			gob.Assert(err).IsNotNil()
+		})
+
+		gob.It("should open data sealed by an older key", func() {
+			old, _ := LoadKeyring("k1:"+secret, "")
+			sealed, _ := old.Encrypt([]byte("one"))
+
+			rotated, _ := LoadKeyring("k2:"+other+"\nk1:"+secret, "")
+			opened, err := rotated.Decrypt(sealed)
+			gob.Assert(err).IsNil()
+			gob.Assert(string(opened)).Equal("one")
+
+			removed, _ := LoadKeyring("k2:"+other, "")
+			_, err = removed.Decrypt(sealed)
+			gob.Assert(err).Equal(ErrUnknownKey)
+		})
+
+		gob.It("should tell data sealed with the primary key", func() {
+			old, _ := LoadKeyring("k1:"+secret, "")
+			sealed, _ := old.Encrypt([]byte("one"))
+			gob.Assert(old.SealedWithPrimary(sealed)).IsTrue()
+
+			rotated, _ := LoadKeyring("k2:"+other+"\nk1:"+secret, "")
+			rotated.AllowLegacy("default")
+			gob.Assert(rotated.SealedWithPrimary(sealed)).IsFalse()
+			gob.Assert(rotated.SealedWithPrimary(legacySeal([]byte("one"), "default"))).IsFalse()
+			resealed, _ := rotated.Encrypt([]byte("one"))
+			gob.Assert(rotated.SealedWithPrimary(resealed)).IsTrue()
+			resealed[len(resealed)-1] ^= 1
+			gob.Assert(rotated.SealedWithPrimary(resealed)).IsFalse()
+		})
+
+		gob.It("should detect a tampered header", func() {
+			k, _ := LoadKeyring("k1:"+secret+",k2:"+other, "")
+			sealed, _ := k.Encrypt([]byte("one"))
+			sealed[2] = 'x'
+			_, err := k.Decrypt(sealed)
+			gob.Assert(err).IsNotNil()
+		})
+
+		gob.It("should only open legacy data when allowed", func() {
+			k, _ := LoadKeyring("k1:"+secret, "")
+			sealed := legacySeal([]byte("one"), "default")
+			_, err := k.Decrypt(sealed)
+			gob.Assert(err).IsNotNil()
+
+			k.AllowLegacy("default")
+			opened, err := k.Decrypt(sealed)
+			gob.Assert(err).IsNil()
+			gob.Assert(string(opened)).Equal("one")
+		})
+
+		gob.It("should load keys from a file", func() {
+			file := filepath.Join(t.TempDir(), "keys")
+			os.WriteFile(file, []byte("# newest first\nk2:"+other+"\n\nk1:"+secret+"\n"), 0600)
+			k, err := LoadKeyring("", file)
+			gob.Assert(err).IsNil()
+			gob.Assert(k.Primary()).Equal("k2")
+		})
+	})
+}
@@ -0,0 +1,178 @@
+package security
+
+import (
+	"crypto/rand"
+	"crypto/sha512"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// The password hash algorithms
+const (
+	Argon2id = "argon2id"
+	Bcrypt   = "bcrypt"
+)
+
+// ErrPasswordMismatch is returned when the password does not match the hash
+var ErrPasswordMismatch = errors.New("password does not match")
+
+// PasswordParams decides how new passwords are hashed. Hashes made with other params
+// still verify but are reported as outdated so they can be hashed again.
+type PasswordParams struct {
+	// Algorithm is Argon2id or Bcrypt
+	Algorithm string
+	// Argon2Memory is in KiB
+	Argon2Memory     uint32
+	Argon2Time       uint32
+	Argon2Threads    uint8
+	Argon2SaltLength uint32
+	Argon2KeyLength  uint32
+	BcryptCost       int
+}
+
+// DefaultPasswordParams follows the OWASP suggestion for argon2id
+var DefaultPasswordParams = PasswordParams{
+	Algorithm:        Argon2id,
+	Argon2Memory:     64 * 1024,
+	Argon2Time:       3,
+	Argon2Threads:    2,
+	Argon2SaltLength: 16,
+	Argon2KeyLength:  32,
+	BcryptCost:       12,
+}
+
+// Validate checks the params can be used to hash
+func (p PasswordParams) Validate() error {
+	switch p.Algorithm {
+	case Argon2id:
+		if p.Argon2Memory < 8*uint32(p.Argon2Threads) || p.Argon2Time < 1 || p.Argon2Threads < 1 {
+			return fmt.Errorf("argon2id needs memory of at least 8 KiB per thread, time and threads of at least 1")
+		}
+		if p.Argon2SaltLength < 8 || p.Argon2KeyLength < 16 {
+			return fmt.Errorf("argon2id needs a salt of at least 8 bytes and a key of at least 16 bytes")
+		}
+	case Bcrypt:
+		if p.BcryptCost < bcrypt.MinCost || p.BcryptCost > bcrypt.MaxCost {
+			return fmt.Errorf("bcrypt cost has to be between %d and %d", bcrypt.MinCost, bcrypt.MaxCost)
+		}
+	default:
+		return fmt.Errorf("unknown password algorithm %q", p.Algorithm)
+	}
+	return nil
+}
+
+// Passwords hashes new passwords with Params and checks them against Policy,
+// the hashes are sealed with Keyring for another layer of protection
+type Passwords struct {
+	Keyring *Keyring
+	Params  PasswordParams
+	Policy  PasswordPolicy
+}
+
+// NewPasswords checks the params and the policy can be used
+func NewPasswords(k *Keyring, params PasswordParams, policy PasswordPolicy) (*Passwords, error) {
+	if k == nil {
+		return nil, ErrNoKeyring
+	}
+	if err := params.Validate(); err != nil {
+		return nil, err
+	}
+	if err := policy.Validate(); err != nil {
+		return nil, err
+	}
+	return &Passwords{Keyring: k, Params: params, Policy: policy}, nil
+}
+
+// Hash hashes the password into a self describing format, either
+// $argon2id$v=19$m=65536,t=3,p=2$salt$hash or a bcrypt hash of the sha512 of the password,
+// and use encrypt for another layer for protection
+func (pw *Passwords) Hash(password string) ([]byte, error) {
+	p := pw.Params
+
+	var encoded []byte
+	switch p.Algorithm {
+	case Argon2id:
+		salt := make([]byte, p.Argon2SaltLength)
+		if _, err := rand.Read(salt); err != nil {
+			return nil, err
+		}
+		key := argon2.IDKey([]byte(password), salt, p.Argon2Time, p.Argon2Memory, p.Argon2Threads, p.Argon2KeyLength)
+		encoded = []byte(fmt.Sprintf("$argon2id$v=%d$m=%d,t=%d,p=%d$%s$%s", argon2.Version, p.Argon2Memory, p.Argon2Time, p.Argon2Threads,
+			base64.RawStdEncoding.EncodeToString(salt), base64.RawStdEncoding.EncodeToString(key)))
+	case Bcrypt:
+		var err error
+		encoded, err = bcrypt.GenerateFromPassword(sha512Sum([]byte(password)), p.BcryptCost)
+		if err != nil {
+			return nil, err
+		}
+	default:
+		return nil, fmt.Errorf("unknown password algorithm %q", p.Algorithm)
+	}
+	return pw.Keyring.Encrypt(encoded)
+}
+
+// Compare decrypt first then compare the password with the hash, it also report
+// if the hash was made with other params than Params and should be hashed again
+func (pw *Passwords) Compare(password []byte, encryptedHash []byte) (bool, error) {
+	decryptHash, err := pw.Keyring.Decrypt(encryptedHash)
+	if err != nil {
+		return false, err
+	}
+	p := pw.Params
+	encoded := string(decryptHash)
+
+	switch {
+	case strings.HasPrefix(encoded, "$argon2id$"):
+		var version int
+		var memory, time uint32
+		var threads uint8
+		parts := strings.Split(encoded, "$")
+		if len(parts) != 6 {
+			return false, fmt.Errorf("invalid argon2id hash")
+		}
+		if _, err := fmt.Sscanf(parts[2], "v=%d", &version); err != nil || version != argon2.Version {
+			return false, fmt.Errorf("unsupported argon2id version")
+		}
+		if _, err := fmt.Sscanf(parts[3], "m=%d,t=%d,p=%d", &memory, &time, &threads); err != nil {
+			return false, fmt.Errorf("invalid argon2id params")
+		}
+		salt, err := base64.RawStdEncoding.DecodeString(parts[4])
+		if err != nil {
+			return false, fmt.Errorf("invalid argon2id salt")
+		}
+		key, err := base64.RawStdEncoding.DecodeString(parts[5])
+		if err != nil {
+			return false, fmt.Errorf("invalid argon2id hash")
+		}
+
+		other := argon2.IDKey(password, salt, time, memory, threads, uint32(len(key)))
+		if subtle.ConstantTimeCompare(key, other) != 1 {
+			return false, ErrPasswordMismatch
+		}
+		outdated := p.Algorithm != Argon2id || memory != p.Argon2Memory || time != p.Argon2Time || threads != p.Argon2Threads ||
+			uint32(len(salt)) != p.Argon2SaltLength || uint32(len(key)) != p.Argon2KeyLength
+		return outdated, nil
+
+	case strings.HasPrefix(encoded, "$2"):
+		if err := bcrypt.CompareHashAndPassword(decryptHash, sha512Sum(password)); err != nil {
+			return false, ErrPasswordMismatch
+		}
+		cost, err := bcrypt.Cost(decryptHash)
+		if err != nil {
+			return false, err
+		}
+		return p.Algorithm != Bcrypt || cost != p.BcryptCost, nil
+	}
+	return false, fmt.Errorf("unknown password hash format")
+}
+
+func sha512Sum(data []byte) []byte {
+	hash := sha512.Sum512(data)
+	return hash[:]
+}
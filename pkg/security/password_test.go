@@ -0,0 +1,93 @@
+package security
+
+import (
+	"strings"
+	"testing"
+
+	. "github.com/franela/goblin"
+	"golang.org/x/crypto/bcrypt"
+)
+
+func TestPassword(t *testing.T) {
+	gob := Goblin(t)
+	keyring := testKeyring()
+	fast := PasswordParams{
+		Algorithm:        Argon2id,
+		Argon2Memory:     1024,
+		Argon2Time:       1,
+		Argon2Threads:    1,
+		Argon2SaltLength: 16,
+		Argon2KeyLength:  32,
+		BcryptCost:       bcrypt.MinCost,
+	}
+
+	gob.Describe("Password File Test", func() {
+		gob.It("should reject invalid params", func() {
+			bad := fast
+			bad.Algorithm = "md5"
+			_, err := NewPasswords(keyring, bad, DefaultPasswordPolicy)
+			gob.Assert(err).IsNotNil()
+			bad = fast
+			bad.Argon2Time = 0
+			_, err = NewPasswords(keyring, bad, DefaultPasswordPolicy)
+			gob.Assert(err).IsNotNil()
+			bad = fast
+			bad.Algorithm = Bcrypt
+			bad.BcryptCost = 99
+			_, err = NewPasswords(keyring, bad, DefaultPasswordPolicy)
+			gob.Assert(err).IsNotNil()
+		})
+
+		gob.It("should hash with argon2id", func() {
+			passwords, _ := NewPasswords(keyring, fast, DefaultPasswordPolicy)
+			hash, _ := passwords.Hash("abc123")
+			decrypted, _ := keyring.Decrypt(hash)
+			gob.Assert(strings.HasPrefix(string(decrypted), "$argon2id$v=19$m=1024,t=1,p=1$")).IsTrue()
+
+			outdated, err := passwords.Compare([]byte("abc123"), hash)
+			gob.Assert(err).IsNil()
+			gob.Assert(outdated).IsFalse()
+
+			_, err = passwords.Compare([]byte("abc124"), hash)
+			gob.Assert(err).Equal(ErrPasswordMismatch)
+		})
+
+		gob.It("should report argon2id hashes with old params as outdated", func() {
+			passwords, _ := NewPasswords(keyring, fast, DefaultPasswordPolicy)
+			hash, _ := passwords.Hash("abc123")
+
+			stronger := fast
+			stronger.Argon2Time = 2
+			passwords, _ = NewPasswords(keyring, stronger, DefaultPasswordPolicy)
+			outdated, err := passwords.Compare([]byte("abc123"), hash)
+			gob.Assert(err).IsNil()
+			gob.Assert(outdated).IsTrue()
+		})
+
+		gob.It("should keep verifying bcrypt hashes made before argon2id", func() {
+			legacy, _ := bcrypt.GenerateFromPassword(sha512Sum([]byte("abc123")), bcrypt.MinCost)
+			hash, _ := keyring.Encrypt(legacy)
+
+			passwords, _ := NewPasswords(keyring, fast, DefaultPasswordPolicy)
+			outdated, err := passwords.Compare([]byte("abc123"), hash)
+			gob.Assert(err).IsNil()
+			gob.Assert(outdated).IsTrue()
+
+			asBcrypt := fast
+			asBcrypt.Algorithm = Bcrypt
+			passwords, _ = NewPasswords(keyring, asBcrypt, DefaultPasswordPolicy)
+			outdated, _ = passwords.Compare([]byte("abc123"), hash)
+			gob.Assert(outdated).IsFalse()
+
+			_, err = passwords.Compare([]byte("abc124"), hash)
+			gob.Assert(err).Equal(ErrPasswordMismatch)
+		})
+
+		gob.It("should reject an unknown hash format", func() {
+			passwords, _ := NewPasswords(keyring, fast, DefaultPasswordPolicy)
+			hash, _ := keyring.Encrypt([]byte("plain text"))
+			_, err := passwords.Compare([]byte("plain text"), hash)
+			gob.Assert(err).IsNotNil()
+		})
+	})
+}
@@ -0,0 +1,289 @@
+package security
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/rand"
+	"crypto/sha1"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Violation is a password rule that was broken
+type Violation struct {
+	// Rule is the name of the rule, e.g. "min_length"
+	Rule    string
+	Message string
+}
+
+// PasswordPolicy decides which passwords are accepted, lengths are counted in characters
+type PasswordPolicy struct {
+	MinLength     int
+	MaxLength     int
+	RequireDigit  bool
+	RequireLower  bool
+	RequireUpper  bool
+	RequireSymbol bool
+	// AllowUnicode accepts characters outside ASCII
+	AllowUnicode bool
+	// MinEntropy is the least bits EstimateEntropy has to give, 0 turns it off
+	MinEntropy float64
+	// Breached rejects passwords found in the list, nil turns it off
+	Breached *BreachedList
+}
+
+// DefaultPasswordPolicy is the policy used when none is configured
+var DefaultPasswordPolicy = PasswordPolicy{
+	MinLength:     10,
+	MaxLength:     128,
+	RequireDigit:  true,
+	RequireLower:  true,
+	RequireUpper:  true,
+	RequireSymbol: true,
+}
+
+// Validate checks the lengths of the policy make sense
+func (p PasswordPolicy) Validate() error {
+	if p.MinLength < 1 || (p.MaxLength > 0 && p.MaxLength < p.MinLength) {
+		return fmt.Errorf("password max length has to be at least the min length of 1 or more")
+	}
+	return nil
+}
+
+// isSymbol counts anything that is not a letter or a number, spaces included, as a symbol
+func isSymbol(r rune) bool {
+	return !unicode.IsLetter(r) && !unicode.IsDigit(r) && !unicode.IsControl(r)
+}
+
+// Check return every rule the password breaks, empty when it is accepted
+func (p PasswordPolicy) Check(password string) []Violation {
+	violations := []Violation{}
+	add := func(rule, message string) {
+		violations = append(violations, Violation{rule, message})
+	}
+
+	if !p.AllowUnicode && !IsASCII(password) {
+		add("ascii", "password only accept Ascii")
+	}
+	if !utf8.ValidString(password) {
+		add("encoding", "password is not valid text")
+	}
+
+	length := utf8.RuneCountInString(password)
+	if length < p.MinLength {
+		add("min_length", fmt.Sprintf("minimum password length of %d or more characters", p.MinLength))
+	}
+	if p.MaxLength > 0 && length > p.MaxLength {
+		add("max_length", fmt.Sprintf("maximum password length of %d characters", p.MaxLength))
+	}
+
+	var digit, lower, upper, symbol bool
+	for _, r := range password {
+		digit = digit || unicode.IsDigit(r)
+		lower = lower || unicode.IsLower(r)
+		upper = upper || unicode.IsUpper(r)
+		symbol = symbol || isSymbol(r)
+	}
+	if p.RequireDigit && !digit {
+		add("digit", "password need to have at least 1 number")
+	}
+	if p.RequireLower && !lower {
+		add("lowercase", "password need to have at least 1 lowercase")
+	}
+	if p.RequireUpper && !upper {
+		add("uppercase", "password need to have at least 1 uppercase")
+	}
+	if p.RequireSymbol && !symbol {
+		add("symbol", "password need to have at least 1 symbol")
+	}
+
+	if p.MinEntropy > 0 && EstimateEntropy(password) < p.MinEntropy {
+		add("entropy", "password is too easy to guess, try a longer passphrase")
+	}
+
+	// a list that cannot be read should not stop people from signing up
+	if p.Breached != nil {
+		if breached, err := p.Breached.Contains(password); err == nil && breached {
+			add("breached", "password has appeared in a data breach, choose another one")
+		}
+	}
+	return violations
+}
+
+// characters of the passwords made by Generate, without the ones easily mixed up
+const generateAlphabet = "abcdefghijkmnpqrstuvwxyzABCDEFGHJKLMNPQRSTUVWXYZ23456789!#%+-.:=?@_"
+
+// Generate return a random password the policy accepts, 20 characters long or the min
+// length when it is more
+func (p PasswordPolicy) Generate() (string, error) {
+	length := 20
+	if p.MinLength > length {
+		length = p.MinLength
+	}
+	if p.MaxLength > 0 && length > p.MaxLength {
+		length = p.MaxLength
+	}
+
+	buf := make([]byte, length)
+	for attempt := 0; attempt < 100; attempt++ {
+		if _, err := rand.Read(buf); err != nil {
+			return "", err
+		}
+		password := make([]byte, length)
+		for i, b := range buf {
+			// 256 is not a multiple of the alphabet, the bias left is far too small to matter
+			password[i] = generateAlphabet[int(b)%len(generateAlphabet)]
+		}
+		if len(p.Check(string(password))) == 0 {
+			return string(password), nil
+		}
+	}
+	return "", errors.New("cannot generate a password the policy accepts")
+}
+
+// EstimateEntropy gives a rough strength in bits. It multiplies the size of the character
+// classes used by the length, not counting characters that repeat or continue a sequence
+// like "aaa" or "123".
+func EstimateEntropy(password string) float64 {
+	pool := 0
+	var digit, lower, upper, symbol, other bool
+	effective := 0
+	var previous rune = -1
+	for _, r := range password {
+		switch {
+		case r > unicode.MaxASCII && unicode.IsLetter(r):
+			other = true
+		case unicode.IsDigit(r):
+			digit = true
+		case unicode.IsLower(r):
+			lower = true
+		case unicode.IsUpper(r):
+			upper = true
+		default:
+			symbol = true
+		}
+		if r != previous && r != previous+1 && r != previous-1 {
+			effective++
+		}
+		previous = r
+	}
+
+	for _, class := range []struct {
+		used bool
+		size int
+	}{{digit, 10}, {lower, 26}, {upper, 26}, {symbol, 33}, {other, 100}} {
+		if class.used {
+			pool += class.size
+		}
+	}
+	if pool == 0 {
+		return 0
+	}
+	return float64(effective) * math.Log2(float64(pool))
+}
+
+// Check checks the password against the policy and return the first rule it breaks
+func (pw *Passwords) Check(password string) error {
+	if violations := pw.Policy.Check(password); len(violations) > 0 {
+		return errors.New(violations[0].Message)
+	}
+	return nil
+}
+
+// BreachedList looks up passwords in a file of SHA-1 hashes sorted in ascending order, one per
+// line in hex with an optional ":count" after it, the format of the Pwned Passwords download.
+// The file is searched in place so it can be far bigger than memory.
+type BreachedList struct {
+	file *os.File
+	size int64
+}
+
+// OpenBreachedList opens the sorted hash file
+func OpenBreachedList(path string) (*BreachedList, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+	return &BreachedList{file: file, size: info.Size()}, nil
+}
+
+// Close closes the file
+func (b *BreachedList) Close() error {
+	return b.file.Close()
+}
+
+// Contains checks if the SHA-1 of the password is in the file
+func (b *BreachedList) Contains(password string) (bool, error) {
+	sum := sha1.Sum([]byte(password))
+	target := []byte(hex.EncodeToString(sum[:]))
+
+	// binary search on byte offsets, the matching line if any starts within [low, high)
+	low, high := int64(0), b.size
+	for low < high {
+		mid := low + (high-low)/2
+		line, next, err := b.lineFrom(mid)
+		if err != nil {
+			return false, err
+		}
+		if line == nil && next == b.size {
+			high = mid
+			continue
+		}
+
+		switch cmp := bytes.Compare(bytes.ToLower(line), target); {
+		case cmp == 0:
+			return true, nil
+		case cmp < 0:
+			low = next
+		default:
+			high = mid
+		}
+	}
+	return false, nil
+}
+
+// lineFrom return the hash on the first line starting at or after offset and where the line after it starts
+func (b *BreachedList) lineFrom(offset int64) ([]byte, int64, error) {
+	if offset == 0 {
+		return b.lineAt(0)
+	}
+	// reading from the byte before tells if offset is already the start of a line
+	reader := bufio.NewReader(io.NewSectionReader(b.file, offset-1, b.size-offset+1))
+	skipped, err := reader.ReadBytes('\n')
+	if err == io.EOF {
+		return nil, b.size, nil
+	}
+	if err != nil {
+		return nil, 0, err
+	}
+	return b.lineAt(offset - 1 + int64(len(skipped)))
+}
+
+// lineAt return the hash on the line starting at offset and where the next line starts
+func (b *BreachedList) lineAt(offset int64) ([]byte, int64, error) {
+	if offset >= b.size {
+		return nil, b.size, nil
+	}
+	reader := bufio.NewReader(io.NewSectionReader(b.file, offset, b.size-offset))
+	line, err := reader.ReadBytes('\n')
+	if err != nil && err != io.EOF {
+		return nil, 0, err
+	}
+	next := offset + int64(len(line))
+	line = bytes.TrimSpace(line)
+	if i := bytes.IndexByte(line, ':'); i >= 0 {
+		line = line[:i]
+	}
+	return line, next, nil
+}
@@ -0,0 +1,116 @@
+package security
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+
+	. "github.com/franela/goblin"
+)
+
+func rules(violations []Violation) []string {
+	r := []string{}
+	for _, v := range violations {
+		r = append(r, v.Rule)
+	}
+	return r
+}
+
+func TestPasswordPolicy(t *testing.T) {
+	gob := Goblin(t)
+
+	gob.Describe("Password Policy Test", func() {
+		gob.It("should report every broken rule", func() {
+			gob.Assert(rules(DefaultPasswordPolicy.Check("abc"))).Equal([]string{"min_length", "digit", "uppercase", "symbol"})
+			gob.Assert(len(DefaultPasswordPolicy.Check("123efghIJKL!@#"))).Equal(0)
+		})
+
+		gob.It("should accept spaces and any punctuation as symbols", func() {
+			gob.Assert(len(DefaultPasswordPolicy.Check("Correct horse battery 9"))).Equal(0)
+			gob.Assert(len(DefaultPasswordPolicy.Check("Correct.horse,battery9"))).Equal(0)
+		})
+
+		gob.It("should allow unicode when configured", func() {
+			gob.Assert(rules(DefaultPasswordPolicy.Check("Pässwört 12345"))).Equal([]string{"ascii"})
+
+			policy := DefaultPasswordPolicy
+			policy.AllowUnicode = true
+			gob.Assert(len(policy.Check("Pässwört 12345"))).Equal(0)
+			// length counts characters not bytes
+			policy.MinLength = 4
+			policy.MaxLength = 4
+			gob.Assert(len(policy.Check("Ä1ö!"))).Equal(0)
+		})
+
+		gob.It("should check the length limits", func() {
+			policy := PasswordPolicy{MinLength: 2, MaxLength: 4}
+			gob.Assert(rules(policy.Check("a"))).Equal([]string{"min_length"})
+			gob.Assert(rules(policy.Check("abcde"))).Equal([]string{"max_length"})
+			gob.Assert(PasswordPolicy{MinLength: 5, MaxLength: 4}.Validate()).IsNotNil()
+		})
+
+		gob.It("should generate passwords the policy accepts", func() {
+			password, err := DefaultPasswordPolicy.Generate()
+			gob.Assert(err).IsNil()
+			gob.Assert(len(password)).Equal(20)
+			gob.Assert(len(DefaultPasswordPolicy.Check(password))).Equal(0)
+
+			other, _ := DefaultPasswordPolicy.Generate()
+			gob.Assert(other != password).IsTrue()
+
+			policy := DefaultPasswordPolicy
+			policy.MinLength = 40
+			policy.MaxLength = 40
+			password, err = policy.Generate()
+			gob.Assert(err).IsNil()
+			gob.Assert(len(password)).Equal(40)
+
+			_, err = PasswordPolicy{MinLength: 2, MaxLength: 2, RequireDigit: true, RequireLower: true, RequireUpper: true}.Generate()
+			gob.Assert(err).IsNotNil()
+		})
+
+		gob.It("should estimate entropy", func() {
+			gob.Assert(EstimateEntropy("")).Equal(0.0)
+			gob.Assert(EstimateEntropy("aaaaaaaa") < EstimateEntropy("ahxkqmzt")).IsTrue()
+			gob.Assert(EstimateEntropy("abcdefgh") < EstimateEntropy("ahxkqmzt")).IsTrue()
+			gob.Assert(EstimateEntropy("correct horse battery staple") > 100).IsTrue()
+
+			policy := PasswordPolicy{MinLength: 1, MinEntropy: 60}
+			gob.Assert(rules(policy.Check("Aa1!Aa1!"))).Equal([]string{"entropy"})
+			gob.Assert(len(policy.Check("correct horse battery staple"))).Equal(0)
+		})
+
+		gob.It("should find breached passwords in a sorted hash file", func() {
+			hashes := []string{}
+			for _, password := range []string{"password", "123456", "qwerty", "letmein", "Password1!", "iloveyou"} {
+				sum := sha1.Sum([]byte(password))
+				hashes = append(hashes, strings.ToUpper(hex.EncodeToString(sum[:]))+":42")
+			}
+			sort.Strings(hashes)
+			file := filepath.Join(t.TempDir(), "pwned.txt")
+			os.WriteFile(file, []byte(strings.Join(hashes, "\r\n")+"\r\n"), 0600)
+
+			breached, err := OpenBreachedList(file)
+			gob.Assert(err).IsNil()
+			defer breached.Close()
+
+			for _, password := range []string{"password", "123456", "qwerty", "letmein", "Password1!", "iloveyou"} {
+				found, err := breached.Contains(password)
+				gob.Assert(err).IsNil()
+				gob.Assert(found).IsTrue()
+			}
+			for _, password := range []string{"", "Password1", "correct horse battery staple"} {
+				found, _ := breached.Contains(password)
+				gob.Assert(found).IsFalse()
+			}
+
+			policy := DefaultPasswordPolicy
+			policy.Breached = breached
+			gob.Assert(rules(policy.Check("Password1!"))).Equal([]string{"breached"})
+		})
+	})
+}
@@ -7,8 +7,14 @@ import (
 	. "github.com/franela/goblin"
 )
 
+func testKeyring() *Keyring {
+	k, _ := NewKeyring("test", map[string][]byte{"test": []byte("0123456789abcdef")})
+	return k
+}
+
 func TestSecurity(t *testing.T) {
 	gob := Goblin(t)
+	passwords, _ := NewPasswords(testKeyring(), DefaultPasswordParams, DefaultPasswordPolicy)
 
 	gob.Describe("Security File Test", func() {
 		gob.It("should check for ASCII", func() {
@@ -17,13 +23,13 @@ func TestSecurity(t *testing.T) {
 		})
 
 		gob.It("should check for valid password", func() {
-			gob.Assert(CheckPassword("¥¶»φ")).Equal(fmt.Errorf("password only accept Ascii"))
-			gob.Assert(CheckPassword("abc")).Equal(fmt.Errorf("minimum password length of 10 or more characters"))
-			gob.Assert(CheckPassword("abcefghijkl")).Equal(fmt.Errorf("password need to have at least 1 number"))
-			gob.Assert(CheckPassword("123efghijkl")).Equal(fmt.Errorf("password need to have at least 1 uppercase"))
-			gob.Assert(CheckPassword("123EFGHIJKL")).Equal(fmt.Errorf("password need to have at least 1 lowercase"))
-			gob.Assert(CheckPassword("123efghIJKL")).Equal(fmt.Errorf("password need to have at least 1 symbol"))
-			gob.Assert(CheckPassword("123efghIJKL!@#")).Equal(nil)
+			gob.Assert(passwords.Check("¥¶»φ")).Equal(fmt.Errorf("password only accept Ascii"))
+			gob.Assert(passwords.Check("abc")).Equal(fmt.Errorf("minimum password length of 10 or more characters"))
+			gob.Assert(passwords.Check("abcefghijkl")).Equal(fmt.Errorf("password need to have at least 1 number"))
+			gob.Assert(passwords.Check("123efghijkl")).Equal(fmt.Errorf("password need to have at least 1 uppercase"))
+			gob.Assert(passwords.Check("123EFGHIJKL")).Equal(fmt.Errorf("password need to have at least 1 lowercase"))
+			gob.Assert(passwords.Check("123efghIJKL")).Equal(fmt.Errorf("password need to have at least 1 symbol"))
+			gob.Assert(passwords.Check("123efghIJKL!@#")).Equal(nil)
 		})
 
 		gob.It("should check for valid email", func() {
@@ -37,17 +43,20 @@ func TestSecurity(t *testing.T) {
 		})
 
 		gob.It("should encrypt and decrypt message", func() {
-			encryptedMessage, _ := Encrypt([]byte("one"), "")
-			decryptedMessage, _ := Decrypt(encryptedMessage, "")
+			encryptedMessage, _ := passwords.Keyring.Encrypt([]byte("one"))
+			decryptedMessage, _ := passwords.Keyring.Decrypt(encryptedMessage)
 			gob.Assert(string(decryptedMessage)).Equal("one")
 		})
 
 		gob.It("should hash a password", func() {
-			pw1, _ := HashPassword("abc123", "")
-			pw2, _ := HashPassword("123asd", "123")
-			gob.Assert(HashPasswordCompare([]byte("abc123"), "", pw1)).Equal(nil)
-			gob.Assert(HashPasswordCompare([]byte("123asd"), "123", pw2)).Equal(nil)
-			gob.Assert(HashPasswordCompare([]byte("123asd"), "123", pw1)).IsNotNil()
+			pw1, _ := passwords.Hash("abc123")
+			pw2, _ := passwords.Hash("123asd")
+			_, err := passwords.Compare([]byte("abc123"), pw1)
+			gob.Assert(err).Equal(nil)
+			_, err = passwords.Compare([]byte("123asd"), pw2)
+			gob.Assert(err).Equal(nil)
+			_, err = passwords.Compare([]byte("123asd"), pw1)
+			gob.Assert(err).IsNotNil()
 		})
 	})
 }
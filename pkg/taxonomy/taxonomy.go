@@ -0,0 +1,429 @@
+// Package taxonomy keeps the job types, categories and skills users pick from, and what each
+// user picked. The names are compared whole, a name may hold a comma.
+package taxonomy
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"unicode/utf8"
+)
+
+// Kind is one of the lists
+type Kind string
+
+// Kinds of the lists
+const (
+	JobType  Kind = "type"
+	Category Kind = "category"
+	// Skill is a finer skill within a category, a category may have none
+	Skill Kind = "skill"
+)
+
+var kindLabel = map[Kind]string{
+	JobType:  "job type",
+	Category: "category",
+	Skill:    "skill",
+}
+
+// Valid checks if the kind is one of the lists
+func (k Kind) Valid() bool {
+	_, ok := kindLabel[k]
+	return ok
+}
+
+// Label return the kind as the users see it
+func (k Kind) Label() string {
+	if label, ok := kindLabel[k]; ok {
+		return label
+	}
+	return string(k)
+}
+
+// MaxName is the longest name the tables keep
+const MaxName = 100
+
+var (
+	// ErrExists is returned when adding or renaming to a name the list already has
+	ErrExists = errors.New("already in the list")
+	// ErrNotFound is returned for a name, or the category of a skill, not in the list
+	ErrNotFound = errors.New("not in the list")
+)
+
+// Clean trims the name and checks it can be kept
+func Clean(name string) (string, error) {
+	name = strings.Join(strings.Fields(name), " ")
+	if name == "" {
+		return "", fmt.Errorf("the name cannot be empty")
+	}
+	if utf8.RuneCountInString(name) > MaxName {
+		return "", fmt.Errorf("the name can be at most %d characters", MaxName)
+	}
+	return name, nil
+}
+
+// Taxonomy is every list the users pick from, in the order they are shown
+type Taxonomy struct {
+	// JobTypes are in the order they were added
+	JobTypes []string
+	// Categories are sorted by name
+	Categories []string
+	// Skills of each category, sorted by name
+	Skills map[string][]string
+}
+
+// Has checks if the list of the kind has the name
+func (t Taxonomy) Has(kind Kind, name string) bool {
+	switch kind {
+	case JobType:
+		return contains(t.JobTypes, name)
+	case Category:
+		return contains(t.Categories, name)
+	case Skill:
+		_, ok := t.CategoryOf(name)
+		return ok
+	}
+	return false
+}
+
+// CategoryOf return the category of the skill
+func (t Taxonomy) CategoryOf(skill string) (string, bool) {
+	for category, skills := range t.Skills {
+		if contains(skills, skill) {
+			return category, true
+		}
+	}
+	return "", false
+}
+
+// Check return an error naming the first pick not in the lists, a skill needs its category picked too
+func (t Taxonomy) Check(sel Selection) error {
+	for _, name := range sel.JobTypes {
+		if !t.Has(JobType, name) {
+			return fmt.Errorf("unknown job type %q", name)
+		}
+	}
+	for _, name := range sel.Categories {
+		if !t.Has(Category, name) {
+			return fmt.Errorf("unknown category %q", name)
+		}
+	}
+	for _, name := range sel.Skills {
+		category, ok := t.CategoryOf(name)
+		if !ok {
+			return fmt.Errorf("unknown skill %q", name)
+		}
+		if !contains(sel.Categories, category) {
+			return fmt.Errorf("skill %q needs the category %q", name, category)
+		}
+	}
+	return nil
+}
+
+// Selection is what a user picked from each list
+type Selection struct {
+	JobTypes   []string
+	Categories []string
+	Skills     []string
+}
+
+// Empty checks if nothing was picked
+func (s Selection) Empty() bool {
+	return len(s.JobTypes) == 0 && len(s.Categories) == 0 && len(s.Skills) == 0
+}
+
+// Any checks if have holds any of want, names are compared whole
+func Any(have, want []string) bool {
+	for _, name := range want {
+		if contains(have, name) {
+			return true
+		}
+	}
+	return false
+}
+
+func contains(list []string, name string) bool {
+	for _, v := range list {
+		if v == name {
+			return true
+		}
+	}
+	return false
+}
+
+// Split breaks a list joined with ", ", as the profiles kept them before the taxonomy, into its
+// names. The longest known name is taken first so a name holding a comma stays whole, the parts
+// matching nothing known are returned as they are.
+func Split(joined string, known []string) []string {
+	isKnown := map[string]bool{}
+	for _, name := range known {
+		isKnown[name] = true
+	}
+	parts := []string{}
+	for _, part := range strings.Split(joined, ",") {
+		if part = strings.TrimSpace(part); part != "" {
+			parts = append(parts, part)
+		}
+	}
+
+	names := []string{}
+	for i := 0; i < len(parts); {
+		taken := 1
+		for j := len(parts); j > i+1; j-- {
+			if isKnown[strings.Join(parts[i:j], ", ")] {
+				taken = j - i
+				break
+			}
+		}
+		name := strings.Join(parts[i:i+taken], ", ")
+		if !contains(names, name) {
+			names = append(names, name)
+		}
+		i += taken
+	}
+	return names
+}
+
+// DefaultJobTypes are the job types a new database starts with
+var DefaultJobTypes = []string{"Full–time", "Part-time", "Contractor", "Internship"}
+
+// DefaultCategories are the categories a new database starts with
+var DefaultCategories = []string{"Restaurant and Hospitality", "Sales and Retail", "Education", "Admin and Office", "Healthcare", "Cleaning and Facilities", "Transportation and Logistics", "Manufacturing and Warehouse", "Customer Service", "Personal Care and Services", "Art, Fashion and Design", "Human Resources", "Advertising and Marketing", "Management", "Accounting and Finance", "Business Operations", "Protective Services", "Science and Engineering", "Animal Care", "Computer and IT", "Sports Fitness and Recreation", "Installation, Maintenance and Repair", "Legal", "Media, Communications and Writing", "Construction", "Entertainment and Travel", "Farming and Outdoors", "Energy and Mining", "Property", "Social Services and Non-Profit"}
+
+// Default return the built in lists, without any skills
+func Default() Taxonomy {
+	categories := append([]string{}, DefaultCategories...)
+	sort.Strings(categories)
+	return Taxonomy{
+		JobTypes:   append([]string{}, DefaultJobTypes...),
+		Categories: categories,
+		Skills:     map[string][]string{},
+	}
+}
+
+// Store keeps the lists and the picks of the users
+type Store interface {
+	// Taxonomy return every list
+	Taxonomy() (Taxonomy, error)
+	// Add puts the name in the list of the kind, category is the one a skill belongs to
+	Add(kind Kind, name, category string) error
+	// Rename changes the name, the users keep their picks
+	Rename(kind Kind, name, to string) error
+	// Remove takes the name out of the list and out of the picks, a category goes with its skills
+	Remove(kind Kind, name string) error
+	// Pick replace what the user picked
+	Pick(username string, sel Selection) error
+	// Picked return what the user picked
+	Picked(username string) (Selection, error)
+	// Picks return what every user picked by username
+	Picks() (map[string]Selection, error)
+}
+
+// MemoryStore is a Store for a single instance
+type MemoryStore struct {
+	mutex    sync.RWMutex
+	taxonomy Taxonomy
+	picks    map[string]Selection
+}
+
+// NewMemoryStore return a MemoryStore starting with the lists
+func NewMemoryStore(t Taxonomy) *MemoryStore {
+	m := &MemoryStore{taxonomy: t.copy(), picks: map[string]Selection{}}
+	sort.Strings(m.taxonomy.Categories)
+	for _, skills := range m.taxonomy.Skills {
+		sort.Strings(skills)
+	}
+	return m
+}
+
+// copy so the lists held are never shared with the caller
+func (t Taxonomy) copy() Taxonomy {
+	c := Taxonomy{
+		JobTypes:   append([]string{}, t.JobTypes...),
+		Categories: append([]string{}, t.Categories...),
+		Skills:     map[string][]string{},
+	}
+	for category, skills := range t.Skills {
+		c.Skills[category] = append([]string{}, skills...)
+	}
+	return c
+}
+
+// Taxonomy return every list
+func (m *MemoryStore) Taxonomy() (Taxonomy, error) {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+	return m.taxonomy.copy(), nil
+}
+
+// Add puts the name in the list of the kind, category is the one a skill belongs to
+func (m *MemoryStore) Add(kind Kind, name, category string) error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	if m.taxonomy.Has(kind, name) {
+		return ErrExists
+	}
+	switch kind {
+	case JobType:
+		m.taxonomy.JobTypes = append(m.taxonomy.JobTypes, name)
+	case Category:
+		m.taxonomy.Categories = append(m.taxonomy.Categories, name)
+		sort.Strings(m.taxonomy.Categories)
+	case Skill:
+		if !m.taxonomy.Has(Category, category) {
+			return ErrNotFound
+		}
+		skills := append(m.taxonomy.Skills[category], name)
+		sort.Strings(skills)
+		m.taxonomy.Skills[category] = skills
+	default:
+		return ErrNotFound
+	}
+	return nil
+}
+
+// Rename changes the name, the users keep their picks
+func (m *MemoryStore) Rename(kind Kind, name, to string) error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	if !m.taxonomy.Has(kind, name) {
+		return ErrNotFound
+	}
+	if m.taxonomy.Has(kind, to) {
+		return ErrExists
+	}
+	switch kind {
+	case JobType:
+		replace(m.taxonomy.JobTypes, name, to)
+	case Category:
+		replace(m.taxonomy.Categories, name, to)
+		sort.Strings(m.taxonomy.Categories)
+		if skills, ok := m.taxonomy.Skills[name]; ok {
+			delete(m.taxonomy.Skills, name)
+			m.taxonomy.Skills[to] = skills
+		}
+	case Skill:
+		category, _ := m.taxonomy.CategoryOf(name)
+		replace(m.taxonomy.Skills[category], name, to)
+		sort.Strings(m.taxonomy.Skills[category])
+	}
+	for username, sel := range m.picks {
+		replace(sel.list(kind), name, to)
+		m.picks[username] = sel
+	}
+	return nil
+}
+
+// Remove takes the name out of the list and out of the picks, a category goes with its skills
+func (m *MemoryStore) Remove(kind Kind, name string) error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	if !m.taxonomy.Has(kind, name) {
+		return ErrNotFound
+	}
+	removed := map[Kind][]string{kind: {name}}
+	switch kind {
+	case JobType:
+		m.taxonomy.JobTypes = without(m.taxonomy.JobTypes, name)
+	case Category:
+		m.taxonomy.Categories = without(m.taxonomy.Categories, name)
+		removed[Skill] = m.taxonomy.Skills[name]
+		delete(m.taxonomy.Skills, name)
+	case Skill:
+		category, _ := m.taxonomy.CategoryOf(name)
+		m.taxonomy.Skills[category] = without(m.taxonomy.Skills[category], name)
+	}
+	for username, sel := range m.picks {
+		for k, names := range removed {
+			for _, n := range names {
+				sel.set(k, without(sel.list(k), n))
+			}
+		}
+		m.picks[username] = sel
+	}
+	return nil
+}
+
+// Pick replace what the user picked
+func (m *MemoryStore) Pick(username string, sel Selection) error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	if sel.Empty() {
+		delete(m.picks, username)
+		return nil
+	}
+	m.picks[username] = sel.copy()
+	return nil
+}
+
+// Picked return what the user picked
+func (m *MemoryStore) Picked(username string) (Selection, error) {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+	return m.picks[username].copy(), nil
+}
+
+// Picks return what every user picked by username
+func (m *MemoryStore) Picks() (map[string]Selection, error) {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+	picks := map[string]Selection{}
+	for username, sel := range m.picks {
+		picks[username] = sel.copy()
+	}
+	return picks, nil
+}
+
+// copy so the picks held are never shared with the caller
+func (s Selection) copy() Selection {
+	return Selection{
+		JobTypes:   append([]string{}, s.JobTypes...),
+		Categories: append([]string{}, s.Categories...),
+		Skills:     append([]string{}, s.Skills...),
+	}
+}
+
+// list return the picks of the kind
+func (s Selection) list(kind Kind) []string {
+	switch kind {
+	case JobType:
+		return s.JobTypes
+	case Category:
+		return s.Categories
+	case Skill:
+		return s.Skills
+	}
+	return nil
+}
+
+// set replace the picks of the kind
+func (s *Selection) set(kind Kind, names []string) {
+	switch kind {
+	case JobType:
+		s.JobTypes = names
+	case Category:
+		s.Categories = names
+	case Skill:
+		s.Skills = names
+	}
+}
+
+func replace(list []string, name, to string) {
+	for i, v := range list {
+		if v == name {
+			list[i] = to
+		}
+	}
+}
+
+func without(list []string, name string) []string {
+	kept := []string{}
+	for _, v := range list {
+		if v != name {
+			kept = append(kept, v)
+		}
+	}
+	return kept
+}
@@ -0,0 +1,83 @@
+package taxonomy
+
+import (
+	"testing"
+
+	. "github.com/franela/goblin"
+)
+
+func TestTaxonomy(t *testing.T) {
+	gob := Goblin(t)
+
+	gob.Describe("Split Test", func() {
+		gob.It("should keep the known names holding a comma whole", func() {
+			gob.Assert(Split("Legal, Art, Fashion and Design, Education", DefaultCategories)).
+				Equal([]string{"Legal", "Art, Fashion and Design", "Education"})
+			gob.Assert(Split("Installation, Maintenance and Repair", DefaultCategories)).
+				Equal([]string{"Installation, Maintenance and Repair"})
+		})
+
+		gob.It("should return the unknown parts as they are", func() {
+			gob.Assert(Split(" Plumbing,Legal, ,Legal", DefaultCategories)).Equal([]string{"Plumbing", "Legal"})
+			gob.Assert(Split("", DefaultCategories)).Equal([]string{})
+		})
+	})
+
+	gob.Describe("Check Test", func() {
+		tax := Default()
+		tax.Skills["Computer and IT"] = []string{"Go", "SQL"}
+
+		gob.It("should take the names in the lists only", func() {
+			gob.Assert(tax.Check(Selection{JobTypes: []string{"Part-time"}, Categories: []string{"Computer and IT"}, Skills: []string{"Go"}})).IsNil()
+			gob.Assert(tax.Check(Selection{JobTypes: []string{"Part"}})).IsNotNil()
+			gob.Assert(tax.Check(Selection{Categories: []string{"Art"}})).IsNotNil()
+			gob.Assert(tax.Check(Selection{Skills: []string{"Rust"}})).IsNotNil()
+		})
+
+		gob.It("should want the category of a skill picked", func() {
+			gob.Assert(tax.Check(Selection{Skills: []string{"Go"}}).Error()).Equal(`skill "Go" needs the category "Computer and IT"`)
+		})
+
+		gob.It("should match whole names only", func() {
+			gob.Assert(Any([]string{"Computer and IT"}, []string{"IT"})).IsFalse()
+			gob.Assert(Any([]string{"Computer and IT", "Legal"}, []string{"Education", "Legal"})).IsTrue()
+			gob.Assert(Any(nil, []string{"Legal"})).IsFalse()
+		})
+	})
+
+	gob.Describe("Memory Store Test", func() {
+		gob.It("should keep the picks in step with the lists", func() {
+			store := NewMemoryStore(Default())
+			gob.Assert(store.Add(Category, "Legal", "")).Equal(ErrExists)
+			gob.Assert(store.Add(Skill, "Conveyancing", "Law")).Equal(ErrNotFound)
+			gob.Assert(store.Add(Skill, "Conveyancing", "Legal")).IsNil()
+			gob.Assert(store.Add(JobType, "Freelance", "")).IsNil()
+
+			store.Pick("jiahao", Selection{JobTypes: []string{"Freelance"}, Categories: []string{"Legal"}, Skills: []string{"Conveyancing"}})
+			gob.Assert(store.Rename(Category, "Legal", "Law")).IsNil()
+			picked, _ := store.Picked("jiahao")
+			gob.Assert(picked.Categories).Equal([]string{"Law"})
+
+			tax, _ := store.Taxonomy()
+			gob.Assert(tax.JobTypes[len(tax.JobTypes)-1]).Equal("Freelance")
+			gob.Assert(tax.Skills["Law"]).Equal([]string{"Conveyancing"})
+
+			// the skills go with their category
+			gob.Assert(store.Remove(Category, "Law")).IsNil()
+			picked, _ = store.Picked("jiahao")
+			gob.Assert(picked.Categories).Equal([]string{})
+			gob.Assert(picked.Skills).Equal([]string{})
+			gob.Assert(picked.JobTypes).Equal([]string{"Freelance"})
+			tax, _ = store.Taxonomy()
+			gob.Assert(tax.Has(Skill, "Conveyancing")).IsFalse()
+		})
+
+		gob.It("should forget the user picking nothing", func() {
+			store := NewMemoryStore(Default())
+			store.Pick("jiahao", Selection{JobTypes: []string{"Part-time"}})
+			store.Pick("jiahao", Selection{})
+			picks, _ := store.Picks()
+			gob.Assert(len(picks)).Equal(0)
+		})
+	})
+}
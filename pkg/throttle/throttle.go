@@ -0,0 +1,212 @@
+// Package throttle slows down and locks out repeated failed logins
+package throttle
+
+import (
+	"sync"
+	"time"
+)
+
+// Record is the failed attempts of one key
+type Record struct {
+	Failures int
+	// Last is when the last failure happened
+	Last time.Time
+	// Until is when the next attempt is allowed
+	Until time.Time
+}
+
+// Store keeps the records so limits can be shared between instances
+type Store interface {
+	// Get return the record of the key, the zero Record when there is none
+	Get(key string) (Record, error)
+	// Fail adds a failure to the key in one step so failures at the same time are all counted. The
+	// count starts again when the last failure is older than reset, 0 never does, and Until is
+	// set from delay of the new count. It return the record as stored.
+	Fail(key string, now time.Time, reset time.Duration, delay func(failures int) time.Duration) (Record, error)
+	Delete(key string) error
+}
+
+// Limiter applies exponential backoff and then a lockout to the keys it sees failing
+type Limiter struct {
+	Store Store
+	// Prefix keeps the keys of different limiters apart in a shared store
+	Prefix string
+	// FreeAttempts can fail before any delay
+	FreeAttempts int
+	// BaseDelay is the first delay, doubling on every failure after up to MaxDelay
+	BaseDelay time.Duration
+	MaxDelay  time.Duration
+	// LockoutAfter failures lock the key for LockoutDuration, 0 never locks
+	LockoutAfter    int
+	LockoutDuration time.Duration
+	// Reset forgets the failures when nothing failed for this long
+	Reset time.Duration
+	// Now return the current time, time.Now when nil
+	Now func() time.Time
+}
+
+func (l *Limiter) now() time.Time {
+	if l.Now != nil {
+		return l.Now()
+	}
+	return time.Now()
+}
+
+// Wait return how long the key has to wait before the next attempt, 0 when it can go ahead
+func (l *Limiter) Wait(key string) (time.Duration, error) {
+	r, err := l.Store.Get(l.Prefix + key)
+	if err != nil {
+		return 0, err
+	}
+	// the count decides too, an instance that did not set Until still locks the key
+	until := r.Until
+	if counted := r.Last.Add(l.delay(r.Failures)); counted.After(until) {
+		until = counted
+	}
+	if wait := until.Sub(l.now()); wait > 0 {
+		return wait, nil
+	}
+	return 0, nil
+}
+
+// Fail records a failed attempt and return how long the key has to wait now
+func (l *Limiter) Fail(key string) (time.Duration, error) {
+	now := l.now()
+	r, err := l.Store.Fail(l.Prefix+key, now, l.Reset, l.delay)
+	if err != nil {
+		return 0, err
+	}
+	return r.Until.Sub(now), nil
+}
+
+// delay return the wait after the given number of failures
+func (l *Limiter) delay(failures int) time.Duration {
+	if l.LockoutAfter > 0 && failures >= l.LockoutAfter {
+		return l.LockoutDuration
+	}
+	if failures <= 0 || failures <= l.FreeAttempts {
+		return 0
+	}
+
+	delay := l.BaseDelay
+	for i := l.FreeAttempts + 1; i < failures; i++ {
+		delay *= 2
+		if l.MaxDelay > 0 && delay >= l.MaxDelay {
+			return l.MaxDelay
+		}
+	}
+	return delay
+}
+
+// Unlock forgets every failure of the key
+func (l *Limiter) Unlock(key string) error {
+	return l.Store.Delete(l.Prefix + key)
+}
+
+// Guard throttles logins by account and by ip together
+type Guard struct {
+	Accounts *Limiter
+	IPs      *Limiter
+}
+
+// Wait return how long the login has to wait, the longest of the account and the ip
+func (g *Guard) Wait(username, ip string) (time.Duration, error) {
+	account, err := g.Accounts.Wait(username)
+	if err != nil {
+		return 0, err
+	}
+	address, err := g.IPs.Wait(ip)
+	if err != nil {
+		return 0, err
+	}
+	if address > account {
+		return address, nil
+	}
+	return account, nil
+}
+
+// Failed records a failed login on both the account and the ip
+func (g *Guard) Failed(username, ip string) error {
+	if _, err := g.Accounts.Fail(username); err != nil {
+		return err
+	}
+	_, err := g.IPs.Fail(ip)
+	return err
+}
+
+// Succeeded forgets the failures of the account, the ip keeps its own
+// so a working login cannot be used to reset it
+func (g *Guard) Succeeded(username string) error {
+	return g.Accounts.Unlock(username)
+}
+
+// MemoryStore is a Store for a single instance
+type MemoryStore struct {
+	mutex   sync.Mutex
+	records map[string]Record
+}
+
+// NewMemoryStore return an empty MemoryStore
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{records: map[string]Record{}}
+}
+
+// Get return the record of the key
+func (m *MemoryStore) Get(key string) (Record, error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	return m.records[key], nil
+}
+
+// Fail adds a failure to the key and return the record as kept
+func (m *MemoryStore) Fail(key string, now time.Time, reset time.Duration, delay func(failures int) time.Duration) (Record, error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	r := m.records[key]
+	if reset > 0 && now.Sub(r.Last) > reset {
+		r = Record{}
+	}
+	r.Failures++
+	r.Last = now
+	r.Until = now.Add(delay(r.Failures))
+	m.records[key] = r
+	return r, nil
+}
+
+// Delete removes the record of the key
+func (m *MemoryStore) Delete(key string) error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	delete(m.records, key)
+	return nil
+}
+
+// AccountPrefix is the Prefix of the account limiter of NewGuard
+const AccountPrefix = "user:"
+
+// NewGuard return a Guard with the default limits, accounts back off after 3 failures and lock
+// for 15 minutes after 10, ips are allowed more as many users can share one
+func NewGuard(store Store) *Guard {
+	return &Guard{
+		Accounts: &Limiter{
+			Store:           store,
+			Prefix:          AccountPrefix,
+			FreeAttempts:    3,
+			BaseDelay:       time.Second,
+			MaxDelay:        5 * time.Minute,
+			LockoutAfter:    10,
+			LockoutDuration: 15 * time.Minute,
+			Reset:           time.Hour,
+		},
+		IPs: &Limiter{
+			Store:           store,
+			Prefix:          "ip:",
+			FreeAttempts:    10,
+			BaseDelay:       time.Second,
+			MaxDelay:        5 * time.Minute,
+			LockoutAfter:    50,
+			LockoutDuration: 15 * time.Minute,
+			Reset:           time.Hour,
+		},
+	}
+}
@@ -0,0 +1,119 @@
+package throttle
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	. "github.com/franela/goblin"
+)
+
+func TestThrottle(t *testing.T) {
+	gob := Goblin(t)
+	now := time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC)
+	clock := func() time.Time { return now }
+
+	gob.Describe("Limiter Test", func() {
+		limiter := &Limiter{
+			Store:           NewMemoryStore(),
+			FreeAttempts:    2,
+			BaseDelay:       time.Second,
+			MaxDelay:        8 * time.Second,
+			LockoutAfter:    8,
+			LockoutDuration: time.Hour,
+			Reset:           24 * time.Hour,
+			Now:             clock,
+		}
+
+		gob.It("should allow the free attempts", func() {
+			for i := 0; i < 2; i++ {
+				wait, _ := limiter.Fail("jiahao")
+				gob.Assert(wait).Equal(time.Duration(0))
+			}
+			wait, _ := limiter.Wait("jiahao")
+			gob.Assert(wait).Equal(time.Duration(0))
+		})
+
+		gob.It("should back off exponentially up to the max", func() {
+			for _, want := range []time.Duration{1, 2, 4, 8, 8} {
+				wait, _ := limiter.Fail("jiahao")
+				gob.Assert(wait).Equal(want * time.Second)
+			}
+			wait, _ := limiter.Wait("jiahao")
+			gob.Assert(wait).Equal(8 * time.Second)
+		})
+
+		gob.It("should lock out after too many failures", func() {
+			wait, _ := limiter.Fail("jiahao")
+			gob.Assert(wait).Equal(time.Hour)
+		})
+
+		gob.It("should unlock", func() {
+			limiter.Unlock("jiahao")
+			wait, _ := limiter.Wait("jiahao")
+			gob.Assert(wait).Equal(time.Duration(0))
+		})
+
+		gob.It("should count failures at the same time", func() {
+			var wg sync.WaitGroup
+			for i := 0; i < 8; i++ {
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					limiter.Fail("parallel")
+				}()
+			}
+			wg.Wait()
+			r, _ := limiter.Store.Get("parallel")
+			gob.Assert(r.Failures).Equal(8)
+			wait, _ := limiter.Wait("parallel")
+			gob.Assert(wait).Equal(time.Hour)
+		})
+
+		gob.It("should lock from the count stored", func() {
+			store := limiter.Store.(*MemoryStore)
+			store.records["counted"] = Record{Failures: 8, Last: now}
+			wait, _ := limiter.Wait("counted")
+			gob.Assert(wait).Equal(time.Hour)
+		})
+
+		gob.It("should forget old failures", func() {
+			for i := 0; i < 3; i++ {
+				limiter.Fail("old")
+			}
+			now = now.Add(48 * time.Hour)
+			wait, _ := limiter.Fail("old")
+			gob.Assert(wait).Equal(time.Duration(0))
+		})
+	})
+
+	gob.Describe("Guard Test", func() {
+		guard := NewGuard(NewMemoryStore())
+		guard.Accounts.Now = clock
+		guard.IPs.Now = clock
+
+		gob.It("should throttle by account and by ip", func() {
+			for i := 0; i < 4; i++ {
+				guard.Failed("jiahao", "1.1.1.1")
+			}
+			wait, _ := guard.Wait("jiahao", "2.2.2.2")
+			gob.Assert(wait > 0).IsTrue()
+			wait, _ = guard.Wait("someone", "1.1.1.1")
+			gob.Assert(wait).Equal(time.Duration(0))
+
+			for i := 0; i < 7; i++ {
+				guard.Failed("other", "1.1.1.1")
+			}
+			wait, _ = guard.Wait("someone", "1.1.1.1")
+			gob.Assert(wait > 0).IsTrue()
+		})
+
+		gob.It("should only reset the account on success", func() {
+			guard.Succeeded("jiahao")
+			wait, _ := guard.Wait("jiahao", "2.2.2.2")
+			gob.Assert(wait).Equal(time.Duration(0))
+			wait, _ = guard.Wait("jiahao", "1.1.1.1")
+			gob.Assert(wait > 0).IsTrue()
+		})
+	})
+}
@@ -0,0 +1,243 @@
+package totp
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"errors"
+	"strings"
+	"sync"
+	"time"
+)
+
+// number of recovery codes given to the user
+const recoveryCount = 10
+
+var (
+	// ErrNotEnrolled is returned when the user has not started enrolment
+	ErrNotEnrolled = errors.New("two-factor authentication is not set up")
+	// ErrEnabled is returned when enrolling a user that already has two-factor authentication
+	ErrEnabled = errors.New("two-factor authentication is already on")
+	// ErrInvalidCode is returned when the code does not match or was used before
+	ErrInvalidCode = errors.New("invalid two-factor code")
+)
+
+// Enrolment is the second factor of one user
+type Enrolment struct {
+	Secret []byte
+	// Enabled is set once the user proved the app has the secret
+	Enabled bool
+	// LastStep is the step of the last code accepted, codes of it and before are refused
+	LastStep int64
+	// Recovery holds the hashes of the recovery codes not used yet
+	Recovery []string
+}
+
+// Store keeps the enrolments
+type Store interface {
+	// Get return the enrolment of the user, ErrNotEnrolled when there is none
+	Get(username string) (Enrolment, error)
+	Put(username string, e Enrolment) error
+	Delete(username string) error
+}
+
+// Manager enrols users and checks their codes
+type Manager struct {
+	Store Store
+	// Issuer is the name shown in the authenticator app
+	Issuer string
+	// Skew is the number of steps either way a code is still accepted
+	Skew int
+	// Now return the current time, time.Now when nil
+	Now func() time.Time
+
+	// a code has to be checked and marked used in one go
+	mutex sync.Mutex
+}
+
+// NewManager return a Manager accepting codes one step either way
+func NewManager(store Store, issuer string) *Manager {
+	return &Manager{Store: store, Issuer: issuer, Skew: 1}
+}
+
+func (m *Manager) now() time.Time {
+	if m.Now != nil {
+		return m.Now()
+	}
+	return time.Now()
+}
+
+// Enabled checks if the user logs in with a second factor
+func (m *Manager) Enabled(username string) (bool, error) {
+	e, err := m.Store.Get(username)
+	if err == ErrNotEnrolled {
+		return false, nil
+	}
+	return e.Enabled, err
+}
+
+// Begin gives the user a new secret, it only takes effect once Confirm is called with a code from it
+func (m *Manager) Begin(username string) (secret []byte, uri string, err error) {
+	e, err := m.Store.Get(username)
+	if err != nil && err != ErrNotEnrolled {
+		return nil, "", err
+	}
+	if e.Enabled {
+		return nil, "", ErrEnabled
+	}
+
+	secret, err = GenerateSecret()
+	if err != nil {
+		return nil, "", err
+	}
+	if err := m.Store.Put(username, Enrolment{Secret: secret}); err != nil {
+		return nil, "", err
+	}
+	return secret, URI(m.Issuer, username, secret), nil
+}
+
+// Confirm turns on the second factor when the code matches the secret given by Begin,
+// the recovery codes return are the only time they are shown
+func (m *Manager) Confirm(username, code string) ([]string, error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	e, err := m.Store.Get(username)
+	if err != nil {
+		return nil, err
+	}
+	if e.Enabled {
+		return nil, ErrEnabled
+	}
+	step, ok := Validate(e.Secret, code, m.now(), m.Skew)
+	if !ok {
+		return nil, ErrInvalidCode
+	}
+
+	codes, hashes, err := newRecoveryCodes()
+	if err != nil {
+		return nil, err
+	}
+	e.Enabled = true
+	e.LastStep = step
+	e.Recovery = hashes
+	return codes, m.Store.Put(username, e)
+}
+
+// Verify checks a code from the app, or a recovery code which then cannot be used again
+func (m *Manager) Verify(username, code string) error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	e, err := m.Store.Get(username)
+	if err != nil {
+		return err
+	}
+	if !e.Enabled {
+		return ErrNotEnrolled
+	}
+
+	if step, ok := Validate(e.Secret, code, m.now(), m.Skew); ok {
+		// a code seen once could be replayed by whoever saw it
+		if step <= e.LastStep {
+			return ErrInvalidCode
+		}
+		e.LastStep = step
+		return m.Store.Put(username, e)
+	}
+
+	hash := hashRecoveryCode(code)
+	for i, h := range e.Recovery {
+		if subtle.ConstantTimeCompare([]byte(h), []byte(hash)) == 1 {
+			e.Recovery = append(e.Recovery[:i:i], e.Recovery[i+1:]...)
+			return m.Store.Put(username, e)
+		}
+	}
+	return ErrInvalidCode
+}
+
+// RegenerateRecoveryCodes replace the recovery codes of the user with new ones
+func (m *Manager) RegenerateRecoveryCodes(username string) ([]string, error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	e, err := m.Store.Get(username)
+	if err != nil {
+		return nil, err
+	}
+	if !e.Enabled {
+		return nil, ErrNotEnrolled
+	}
+	codes, hashes, err := newRecoveryCodes()
+	if err != nil {
+		return nil, err
+	}
+	e.Recovery = hashes
+	return codes, m.Store.Put(username, e)
+}
+
+// Reset turns off the second factor of the user, used when the user or an admin disables it
+func (m *Manager) Reset(username string) error {
+	return m.Store.Delete(username)
+}
+
+// recovery codes are random so a plain hash is enough, e.g. "7QKZB-M3XTA"
+func newRecoveryCodes() (codes []string, hashes []string, err error) {
+	for i := 0; i < recoveryCount; i++ {
+		b := make([]byte, 7)
+		if _, err := rand.Read(b); err != nil {
+			return nil, nil, err
+		}
+		code := encoding.EncodeToString(b)[:10]
+		codes = append(codes, code[:5]+"-"+code[5:])
+		hashes = append(hashes, hashRecoveryCode(code))
+	}
+	return codes, hashes, nil
+}
+
+// the code is hashed without the dash and case so it can be typed either way
+func hashRecoveryCode(code string) string {
+	code = strings.ToUpper(strings.NewReplacer("-", "", " ", "").Replace(code))
+	sum := sha256.Sum256([]byte(code))
+	return hex.EncodeToString(sum[:])
+}
+
+// MemoryStore keeps the enrolments in memory
+type MemoryStore struct {
+	mutex      sync.Mutex
+	enrolments map[string]Enrolment
+}
+
+// NewMemoryStore return an empty MemoryStore
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{enrolments: map[string]Enrolment{}}
+}
+
+// Get return the enrolment of the user, ErrNotEnrolled when there is none
+func (s *MemoryStore) Get(username string) (Enrolment, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	e, ok := s.enrolments[username]
+	if !ok {
+		return Enrolment{}, ErrNotEnrolled
+	}
+	e.Recovery = append([]string{}, e.Recovery...)
+	return e, nil
+}
+
+// Put saves the enrolment of the user
+func (s *MemoryStore) Put(username string, e Enrolment) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.enrolments[username] = e
+	return nil
+}
+
+// Delete removes the enrolment of the user
+func (s *MemoryStore) Delete(username string) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	delete(s.enrolments, username)
+	return nil
+}
@@ -0,0 +1,91 @@
+package totp
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	. "github.com/franela/goblin"
+)
+
+func TestTOTP(t *testing.T) {
+	gob := Goblin(t)
+	secret := []byte("12345678901234567890")
+
+	gob.Describe("Code Test", func() {
+		gob.It("should match the RFC 6238 test vectors", func() {
+			for unix, code := range map[int64]string{
+				59:         "287082",
+				1111111109: "081804",
+				1234567890: "005924",
+				2000000000: "279037",
+			} {
+				gob.Assert(Code(secret, Step(time.Unix(unix, 0)))).Equal(code)
+			}
+		})
+
+		gob.It("should accept codes within the skew", func() {
+			now := time.Unix(1234567890, 0)
+			_, ok := Validate(secret, Code(secret, Step(now)-1), now, 1)
+			gob.Assert(ok).IsTrue()
+			_, ok = Validate(secret, Code(secret, Step(now)-2), now, 1)
+			gob.Assert(ok).IsFalse()
+			_, ok = Validate(secret, "12345", now, 1)
+			gob.Assert(ok).IsFalse()
+		})
+
+		gob.It("should build the provisioning uri", func() {
+			uri := URI("HireMe", "jiahao", secret)
+			gob.Assert(strings.HasPrefix(uri, "otpauth://totp/HireMe:jiahao?")).IsTrue()
+			gob.Assert(strings.Contains(uri, "secret=GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ")).IsTrue()
+		})
+	})
+
+	gob.Describe("Manager Test", func() {
+		now := time.Unix(1234567890, 0)
+		m := NewManager(NewMemoryStore(), "HireMe")
+		m.Now = func() time.Time { return now }
+		var recovery []string
+
+		gob.It("should only enable after a valid code", func() {
+			secret, _, err := m.Begin("jiahao")
+			gob.Assert(err).IsNil()
+			enabled, _ := m.Enabled("jiahao")
+			gob.Assert(enabled).IsFalse()
+
+			_, err = m.Confirm("jiahao", "000000")
+			gob.Assert(err).Equal(ErrInvalidCode)
+			recovery, err = m.Confirm("jiahao", Code(secret, Step(now)))
+			gob.Assert(err).IsNil()
+			gob.Assert(len(recovery)).Equal(10)
+			enabled, _ = m.Enabled("jiahao")
+			gob.Assert(enabled).IsTrue()
+
+			_, _, err = m.Begin("jiahao")
+			gob.Assert(err).Equal(ErrEnabled)
+		})
+
+		gob.It("should refuse a code used before", func() {
+			e, _ := m.Store.Get("jiahao")
+			gob.Assert(m.Verify("jiahao", Code(e.Secret, Step(now)))).Equal(ErrInvalidCode)
+			now = now.Add(Period)
+			gob.Assert(m.Verify("jiahao", Code(e.Secret, Step(now)))).IsNil()
+			gob.Assert(m.Verify("jiahao", Code(e.Secret, Step(now)))).Equal(ErrInvalidCode)
+		})
+
+		gob.It("should accept each recovery code once", func() {
+			gob.Assert(m.Verify("jiahao", strings.ToLower(recovery[0]))).IsNil()
+			gob.Assert(m.Verify("jiahao", recovery[0])).Equal(ErrInvalidCode)
+			e, _ := m.Store.Get("jiahao")
+			gob.Assert(len(e.Recovery)).Equal(9)
+		})
+
+		gob.It("should reset", func() {
+			gob.Assert(m.Reset("jiahao")).IsNil()
+			enabled, err := m.Enabled("jiahao")
+			gob.Assert(err).IsNil()
+			gob.Assert(enabled).IsFalse()
+			gob.Assert(m.Verify("jiahao", recovery[1])).Equal(ErrNotEnrolled)
+		})
+	})
+}
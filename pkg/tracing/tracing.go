@@ -0,0 +1,144 @@
+// Package tracing sets up OpenTelemetry tracing, spans are exported to stdout or to an
+// OTLP collector and the trace context is passed on to the api over http
+package tracing
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"os"
+
+	"github.com/gorilla/mux"
+	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// name of the tracer every span of the server comes from
+const instrumentation = "github.com/teojiahao/HireMe"
+
+// Exporters that can be set up
+const (
+	None   = "none"
+	Stdout = "stdout"
+	OTLP   = "otlp"
+)
+
+// Options is where the spans go and how many are kept
+type Options struct {
+	// Exporter is none, stdout or otlp
+	Exporter string
+	// Endpoint is the OTLP/HTTP url of the collector, http://localhost:4318 when empty
+	Endpoint string
+	// ServiceName the spans are reported under
+	ServiceName string
+	// SampleRatio is the share of new traces kept, from 0 to 1
+	SampleRatio float64
+}
+
+// Setup installs the tracer provider and the W3C trace context propagation, the func it
+// return flushes the spans left and has to be called before exiting
+func Setup(ctx context.Context, o Options) (func(context.Context) error, error) {
+	// the trace context is passed on even when nothing is exported here
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{}))
+
+	var exporter sdktrace.SpanExporter
+	var err error
+	switch o.Exporter {
+	case "", None:
+		return func(context.Context) error { return nil }, nil
+	case Stdout:
+		exporter, err = stdouttrace.New(stdouttrace.WithWriter(os.Stdout))
+	case OTLP:
+		opts := []otlptracehttp.Option{}
+		if o.Endpoint != "" {
+			opts = append(opts, otlptracehttp.WithEndpointURL(o.Endpoint))
+		}
+		exporter, err = otlptracehttp.New(ctx, opts...)
+	default:
+		return nil, fmt.Errorf("unknown exporter %q", o.Exporter)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	provider := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(resource.NewSchemaless(attribute.String("service.name", o.ServiceName))),
+		sdktrace.WithSampler(sdktrace.ParentBased(sdktrace.TraceIDRatioBased(o.SampleRatio))),
+	)
+	otel.SetTracerProvider(provider)
+	return provider.Shutdown, nil
+}
+
+// Start starts a span as a child of the one in ctx, end it once done
+func Start(ctx context.Context, name string, attrs ...attribute.KeyValue) (context.Context, trace.Span) {
+	return otel.Tracer(instrumentation).Start(ctx, name, trace.WithAttributes(attrs...))
+}
+
+// StartChild starts a span only when ctx already has one, so work done outside of a
+// request does not start traces of its own
+func StartChild(ctx context.Context, name string, attrs ...attribute.KeyValue) (context.Context, trace.Span) {
+	if !trace.SpanContextFromContext(ctx).IsValid() {
+		return ctx, trace.SpanFromContext(ctx)
+	}
+	return Start(ctx, name, attrs...)
+}
+
+// Fail marks the span as failed with the error, nothing is done when err is nil
+func Fail(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+}
+
+// the probes and the metrics are scraped every few seconds, they are not worth a trace
+var untraced = map[string]bool{"/healthz": true, "/readyz": true, "/metrics": true}
+
+type serverSpanKey struct{}
+
+// return the method and the template of the mux route matched, as span name
+func routeName(req *http.Request) string {
+	if current := mux.CurrentRoute(req); current != nil {
+		if t, err := current.GetPathTemplate(); err == nil {
+			return req.Method + " " + t
+		}
+	}
+	return req.Method
+}
+
+// Middleware starts a server span for every request, continuing the trace of the caller,
+// named after the template of the mux route matched. A router mounted inside another one
+// should use it too, it only renames the span to its more precise route.
+func Middleware(next http.Handler) http.Handler {
+	traced := otelhttp.NewHandler(
+		http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+			next.ServeHTTP(res, req.WithContext(context.WithValue(req.Context(), serverSpanKey{}, true)))
+		}),
+		"http.server",
+		otelhttp.WithSpanNameFormatter(func(operation string, req *http.Request) string { return routeName(req) }),
+		otelhttp.WithFilter(func(req *http.Request) bool { return !untraced[req.URL.Path] }),
+	)
+	return http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+		if req.Context().Value(serverSpanKey{}) != nil {
+			trace.SpanFromContext(req.Context()).SetName(routeName(req))
+			next.ServeHTTP(res, req)
+			return
+		}
+		traced.ServeHTTP(res, req)
+	})
+}
+
+// Transport return a RoundTripper with a client span for every call, sending the trace
+// context along so the api continues the trace of the page
+func Transport(base http.RoundTripper) http.RoundTripper {
+	return otelhttp.NewTransport(base)
+}
@@ -0,0 +1,102 @@
+package tracing
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	. "github.com/franela/goblin"
+	"github.com/gorilla/mux"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+// names return the names of the spans ended
+func names(recorder *tracetest.SpanRecorder) []string {
+	all := []string{}
+	for _, s := range recorder.Ended() {
+		all = append(all, s.Name())
+	}
+	return all
+}
+
+func TestTracing(t *testing.T) {
+	gob := Goblin(t)
+
+	gob.Describe("Tracing Test", func() {
+		var recorder *tracetest.SpanRecorder
+		gob.BeforeEach(func() {
+			recorder = tracetest.NewSpanRecorder()
+			otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)))
+			otel.SetTextMapPropagator(propagation.TraceContext{})
+		})
+
+		gob.Describe("Middleware Test", func() {
+			gob.It("should name the span after the route template", func() {
+				router := mux.NewRouter()
+				router.Use(Middleware)
+				router.HandleFunc("/api/v1/users/{username}", func(res http.ResponseWriter, req *http.Request) {})
+				router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/api/v1/users/jiahao", nil))
+				gob.Assert(names(recorder)).Equal([]string{"GET /api/v1/users/{username}"})
+			})
+
+			gob.It("should use the route of the innermost router", func() {
+				inner := mux.NewRouter()
+				inner.Use(Middleware)
+				inner.HandleFunc("/activity", func(res http.ResponseWriter, req *http.Request) {})
+				outer := mux.NewRouter()
+				outer.Use(Middleware)
+				outer.PathPrefix("/").Handler(inner)
+				outer.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/activity", nil))
+				gob.Assert(names(recorder)).Equal([]string{"GET /activity"})
+			})
+
+			gob.It("should not trace the probes", func() {
+				router := mux.NewRouter()
+				router.Use(Middleware)
+				router.HandleFunc("/readyz", func(res http.ResponseWriter, req *http.Request) {})
+				router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/readyz", nil))
+				gob.Assert(len(recorder.Ended())).Equal(0)
+			})
+		})
+
+		gob.Describe("Transport Test", func() {
+			gob.It("should continue the trace in the api", func() {
+				router := mux.NewRouter()
+				router.Use(Middleware)
+				router.HandleFunc("/api/v1/users", func(res http.ResponseWriter, req *http.Request) {})
+				api := httptest.NewServer(router)
+				defer api.Close()
+
+				ctx, span := Start(context.Background(), "page")
+				req, _ := http.NewRequestWithContext(ctx, "GET", api.URL+"/api/v1/users", nil)
+				res, err := (&http.Client{Transport: Transport(http.DefaultTransport)}).Do(req)
+				gob.Assert(err).IsNil()
+				res.Body.Close()
+				span.End()
+
+				for _, s := range recorder.Ended() {
+					gob.Assert(s.SpanContext().TraceID()).Equal(span.SpanContext().TraceID())
+				}
+				gob.Assert(len(recorder.Ended())).Equal(3)
+			})
+		})
+
+		gob.Describe("StartChild Test", func() {
+			gob.It("should only start a span inside a trace", func() {
+				_, span := StartChild(context.Background(), "db get_all_user")
+				span.End()
+				gob.Assert(len(recorder.Ended())).Equal(0)
+
+				ctx, parent := Start(context.Background(), "GET /")
+				_, span = StartChild(ctx, "db get_all_user")
+				span.End()
+				parent.End()
+				gob.Assert(names(recorder)).Equal([]string{"db get_all_user", "GET /"})
+			})
+		})
+	})
+}
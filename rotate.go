@@ -0,0 +1,78 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"log/slog"
+	"os"
+	"strings"
+
+	"github.com/teojiahao/HireMe/pkg/config"
+	"github.com/teojiahao/HireMe/pkg/database"
+)
+
+// rotateKeys runs the rotate-keys command which seals every encrypted column under the primary key,
+// it keeps the primary key id and the last row done in a state file so an interrupted run carries on
+// where it stopped, as long as the primary key is the same
+func rotateKeys(_ config.Config, d deps, args []string) error {
+	flags := flag.NewFlagSet("rotate-keys", flag.ExitOnError)
+	batch := flags.Int("batch", 100, "number of rows read at a time")
+	verify := flags.Bool("verify", false, "only check that every ciphertext is sealed under the primary key, nothing is written")
+	state := flags.String("state", "rotate-keys.state", "file keeping the last row done")
+	restart := flags.Bool("restart", false, "ignore the state file and start from the first row")
+	flags.Parse(args)
+
+	primary := d.keyring.Primary()
+	rotation := &database.Rotation{DB: d.db, BatchSize: *batch, Verify: *verify}
+	if !*verify && !*restart {
+		saved, err := ioutil.ReadFile(*state)
+		if err == nil {
+			// the rows before the last one were sealed under the primary key of then
+			key, last, _ := strings.Cut(strings.TrimSpace(string(saved)), "\n")
+			if key == primary {
+				rotation.After = last
+				slog.Info("resuming", "after", rotation.After)
+			} else {
+				slog.Warn("starting over, the state file is of another primary key", "file", *state, "key", key)
+			}
+		} else if !os.IsNotExist(err) {
+			return err
+		}
+	}
+
+	slog.Info("rotating to the primary", "primary", primary)
+	rotation.Progress = func(p database.RotateProgress) {
+		slog.Info("progress", "done", p.Done, "total", p.Total, "resealed", p.Resealed, "failed", len(p.Failed))
+		if !*verify {
+			if err := ioutil.WriteFile(*state, []byte(primary+"\n"+p.Last), 0600); err != nil {
+				slog.Error("saving state", "file", *state, "error", err)
+			}
+		}
+	}
+
+	progress, err := rotation.Run()
+	if err != nil {
+		return err
+	}
+	// an old key can only be removed once verify finds every row sealed under the primary
+	logged, problem := "cannot decrypt", "cannot be decrypted"
+	if *verify {
+		logged, problem = "not sealed under the primary key", "are not sealed under the primary key"
+	}
+	for _, failed := range progress.Failed {
+		slog.Error(logged, "row", failed)
+	}
+	if len(progress.Failed) > 0 {
+		return fmt.Errorf("%d rows %s", len(progress.Failed), problem)
+	}
+
+	if !*verify {
+		if err := os.Remove(*state); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return err
+		}
+	}
+	slog.Info("done", "checked", progress.Done, "resealed", progress.Resealed)
+	return nil
+}
@@ -0,0 +1,110 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log/slog"
+	"math/rand"
+	"strings"
+	"time"
+
+	"github.com/teojiahao/HireMe/pkg/api"
+	"github.com/teojiahao/HireMe/pkg/audit"
+	"github.com/teojiahao/HireMe/pkg/config"
+	"github.com/teojiahao/HireMe/pkg/database"
+	"github.com/teojiahao/HireMe/pkg/taxonomy"
+)
+
+// pick return up to n of the options in a random order
+func pick(r *rand.Rand, options []string, n int) []string {
+	picked := []string{}
+	for _, i := range r.Perm(len(options))[:n] {
+		picked = append(picked, options[i])
+	}
+	return picked
+}
+
+// seed runs the seed command which adds users with a shown profile spread over Singapore,
+// users already there are left alone so it can run again
+func seed(cfg config.Config, d deps, args []string) error {
+	flags := flag.NewFlagSet("seed", flag.ExitOnError)
+	count := flags.Int("count", 20, "number of users")
+	prefix := flags.String("prefix", "demo", "start of the usernames, followed by a number")
+	stdin := flags.Bool("password-stdin", false, "read the password of every user from stdin instead of generating one")
+	flags.Parse(args)
+	if *count < 1 || *count > 1000 {
+		return fmt.Errorf("count has to be from 1 to 1000")
+	}
+	if !validUsername.MatchString(fmt.Sprintf("%s%04d", *prefix, *count)) {
+		return fmt.Errorf("prefix %q does not make valid usernames", *prefix)
+	}
+	ctx := context.Background()
+
+	password, generated, err := newPassword(d.passwords, *stdin)
+	if err != nil {
+		return err
+	}
+	hash, err := d.passwords.Hash(password)
+	if err != nil {
+		return err
+	}
+
+	jobs := database.NewTaxonomyStore(d.db)
+	log := newAuditLog(cfg, d.db)
+	lists, err := jobs.Taxonomy()
+	if err != nil {
+		return err
+	}
+	if len(lists.JobTypes) < 2 || len(lists.Categories) < 3 {
+		return fmt.Errorf("the job lists are too short to pick from, run migrate first")
+	}
+
+	r := rand.New(rand.NewSource(time.Now().UnixNano()))
+	created := 0
+	for i := 1; i <= *count; i++ {
+		username := fmt.Sprintf("%s%04d", *prefix, i)
+		if _, err := d.db.GetUser(ctx, username); err == nil {
+			continue
+		} else if err != database.ErrNoUser {
+			return err
+		}
+
+		_, sealed, err := api.NewAccessKey(d.keyring)
+		if err != nil {
+			return err
+		}
+		errs := make(chan error, 1)
+		d.db.InsertUser(ctx, username, hash, sealed, errs)
+		if err := <-errs; err != nil {
+			return fmt.Errorf("creating %s: %w", username, err)
+		}
+		picked := taxonomy.Selection{
+			JobTypes:   pick(r, lists.JobTypes, 1+r.Intn(2)),
+			Categories: pick(r, lists.Categories, 1+r.Intn(3)),
+		}
+		if err := jobs.Pick(username, picked); err != nil {
+			return err
+		}
+		d.db.UpdateUser(ctx, username, "Yes",
+			// within the island
+			1.29+r.Float64()*0.15, 103.65+r.Float64()*0.3,
+			strings.Join(picked.JobTypes, ", "),
+			strings.Join(picked.Categories, ", "),
+			r.Intn(16),
+			time.Now().AddDate(0, 0, -r.Intn(365)).Format("2006-01-02"),
+			"Looking for work",
+			username+"@example.com",
+		)
+		if err := record(log, audit.UserCreate, username, nil); err != nil {
+			return err
+		}
+		created++
+	}
+
+	slog.Info("seeded", "created", created, "existing", *count-created)
+	if generated && created > 0 {
+		fmt.Printf("password: %s\n", password)
+	}
+	return nil
+}
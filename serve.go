@@ -0,0 +1,240 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"net/smtp"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/teojiahao/HireMe/pkg/alert"
+	"github.com/teojiahao/HireMe/pkg/api"
+	"github.com/teojiahao/HireMe/pkg/audit"
+	"github.com/teojiahao/HireMe/pkg/config"
+	"github.com/teojiahao/HireMe/pkg/database"
+	"github.com/teojiahao/HireMe/pkg/handler"
+	"github.com/teojiahao/HireMe/pkg/headers"
+	"github.com/teojiahao/HireMe/pkg/health"
+	"github.com/teojiahao/HireMe/pkg/logging"
+	"github.com/teojiahao/HireMe/pkg/metrics"
+	"github.com/teojiahao/HireMe/pkg/report"
+	"github.com/teojiahao/HireMe/pkg/throttle"
+	"github.com/teojiahao/HireMe/pkg/totp"
+	"github.com/teojiahao/HireMe/pkg/tracing"
+)
+
+// serve runs the pages and the api until SIGTERM
+func serve(cfg config.Config, d deps, args []string) error {
+	flags := flag.NewFlagSet("serve", flag.ExitOnError)
+	flags.Parse(args)
+
+	// the other commands run without the port, the certificate and the templates
+	if errs := cfg.ValidateServe(); len(errs) > 0 {
+		for _, e := range errs {
+			slog.Error("invalid config", "error", e)
+		}
+		return errs
+	}
+
+	// the queries expect the latest schema, better to stop here than on the first request
+	_, pending, err := d.db.MigrationStatus(context.Background())
+	if err != nil {
+		return fmt.Errorf("checking the schema: %w", err)
+	}
+	if len(pending) > 0 {
+		return fmt.Errorf("%d migrations are pending, run the migrate command first", len(pending))
+	}
+
+	// spans of the pages, the api, the queries and the geocoder, exported when set up
+	shutdownTracing, err := tracing.Setup(context.Background(), cfg.TracingOptions())
+	if err != nil {
+		fatal("setting up tracing", err)
+	}
+
+	// share one persistent activity store between the pages and the api
+	activities := database.NewActivityStore(d.db, cfg.Retention())
+
+	// flag suspicious logins and tell the user in app, by email and by webhook when set up
+	detector := &alert.Detector{
+		Activities:    activities,
+		MaxFailures:   cfg.Alert.MaxFailures,
+		FailureWindow: time.Duration(cfg.Alert.FailureWindowMinutes) * time.Minute,
+		Inactivity:    time.Duration(cfg.Alert.InactiveDays) * 24 * time.Hour,
+		Exists:        d.db.UserExists,
+	}
+	alerts := database.NewAlertStore(d.db)
+	notifiers := alert.Notifiers{alerts}
+	if cfg.SMTP.Addr != "" {
+		host, _, _ := net.SplitHostPort(cfg.SMTP.Addr)
+		notifiers = append(notifiers, &alert.EmailNotifier{
+			Addr:   cfg.SMTP.Addr,
+			From:   cfg.SMTP.From,
+			Auth:   smtp.PlainAuth("", cfg.SMTP.Username, cfg.SMTP.Password, host),
+			Lookup: d.db.UserEmail,
+		})
+	}
+	if cfg.Alert.WebhookURL != "" {
+		notifiers = append(notifiers, &alert.WebhookNotifier{URL: cfg.Alert.WebhookURL})
+	}
+
+	// reported profiles are shared by every instance, the moderators hear about them by email and webhook
+	reports := database.NewReportStore(d.db)
+	moderators := report.Notifiers{}
+	if cfg.SMTP.Addr != "" {
+		host, _, _ := net.SplitHostPort(cfg.SMTP.Addr)
+		moderators = append(moderators, &report.EmailNotifier{
+			Addr:       cfg.SMTP.Addr,
+			From:       cfg.SMTP.From,
+			Auth:       smtp.PlainAuth("", cfg.SMTP.Username, cfg.SMTP.Password, host),
+			Moderators: cfg.AdminUsers,
+			Lookup:     d.db.UserEmail,
+		})
+	}
+	if cfg.Report.WebhookURL != "" {
+		moderators = append(moderators, &report.WebhookNotifier{URL: cfg.Report.WebhookURL})
+	}
+	// one two-factor manager so the pages and the api see the same codes used
+	twoFactor := totp.NewManager(database.NewTwoFactorStore(d.db), cfg.TwoFactor.Issuer)
+
+	// the audit log is kept in the db so every instance appends to the same chain
+	auditLog := audit.NewLog(database.NewAuditStore(d.db), cfg.AuditKey())
+
+	// the pages list what the api checks the profiles against
+	jobs := database.NewTaxonomyStore(d.db)
+
+	v1 := api.New(cfg, api.Deps{
+		DB:         d.db,
+		Keyring:    d.keyring,
+		Passwords:  d.passwords,
+		Messages:   &d.messages,
+		Activities: activities,
+		// share the failed logins between instances through the database
+		Logins:    throttle.NewGuard(database.NewThrottleStore(d.db)),
+		TwoFactor: twoFactor,
+		Audit:     auditLog,
+		Reports:   &report.Queue{Store: reports, HideAfter: cfg.Report.HideAfter, Notifier: moderators},
+		Taxonomy:  jobs,
+	})
+
+	geocoder, err := handler.NewGoogleGeocoder(cfg.Google.APIKey)
+	if err != nil {
+		fatal("setting up geocoder", err)
+	}
+	pages, err := handler.NewServer(handler.Deps{
+		Config:     cfg,
+		Geocoder:   handler.NewCachingGeocoder(geocoder),
+		Activities: activities,
+		Detector:   detector,
+		Exists:     d.db.UserExists,
+		Alerts:     alerts,
+		Notifier:   notifiers,
+		TwoFactor:  twoFactor,
+		Audit:      auditLog,
+		Taxonomy:   jobs,
+		Reports:    reports,
+		Keyring:    d.keyring,
+		Passwords:  d.passwords,
+		Disposable: d.disposable,
+		Messages:   &d.messages,
+	})
+	if err != nil {
+		fatal("setting up pages", err)
+	}
+
+	// the orchestrator stops sending requests once the database or the geocoder cannot be reached
+	checker := health.NewChecker(map[string]health.Check{
+		"database": d.db.Ping,
+		"geocoder": geocoder.Ping,
+	})
+
+	router := mux.NewRouter()
+	router.Use(tracing.Middleware)
+	router.Use(logging.Middleware)
+	router.Use(cfg.HeaderConfig().Middleware)
+	router.Use(metrics.Middleware)
+	router.HandleFunc("/healthz", checker.Live).Methods("GET")
+	router.HandleFunc("/readyz", checker.Ready).Methods("GET")
+	router.Handle("/metrics", metrics.Handler(cfg.Metrics.Token)).Methods("GET")
+	router.PathPrefix("/static/").Handler(http.StripPrefix("/static/", http.FileServer(http.Dir("static"))))
+
+	router.HandleFunc("/api/v1/login", v1.Login).Methods("POST")
+	router.HandleFunc("/api/v1/users", v1.AllUsers)
+	router.HandleFunc("/api/v1/users/{username}/activity", v1.Activity).Methods("GET")
+	router.HandleFunc("/api/v1/users/{username}/reports", v1.Report).Methods("POST")
+	router.HandleFunc("/api/v1/reports", v1.MyReports).Methods("GET")
+	router.HandleFunc("/api/v1/taxonomy", v1.JobTaxonomy).Methods("GET")
+	router.HandleFunc("/api/v1/admin/lockouts/{username}", v1.Unlock).Methods("DELETE")
+	router.HandleFunc("/api/v1/admin/2fa/{username}", v1.ResetTwoFactor).Methods("DELETE")
+	router.HandleFunc("/api/v1/admin/users", v1.AdminUsers).Methods("GET")
+	router.HandleFunc("/api/v1/admin/users/{username}", v1.AdminUser).Methods("GET", "PATCH")
+	router.HandleFunc("/api/v1/admin/users/{username}/key", v1.RevokeKey).Methods("DELETE")
+	router.HandleFunc("/api/v1/admin/audit", v1.AuditLog).Methods("GET")
+	router.HandleFunc("/api/v1/admin/audit/export", v1.AuditExport).Methods("GET")
+	router.HandleFunc("/api/v1/admin/audit/verify", v1.AuditVerify).Methods("GET")
+	router.HandleFunc("/api/v1/users/{username}", v1.User).Methods("GET", "PUT", "POST", "DELETE", "PATCH")
+
+	// everything else is a page
+	router.PathPrefix("/").Handler(pages)
+
+	server := cfg.HTTPServer(router)
+	server.Addr = ":" + cfg.Port
+	servers := []*http.Server{server}
+	errs := make(chan error, 2)
+
+	// send anyone coming over plain http to https
+	if cfg.HTTPRedirectPort != "" {
+		redirect := cfg.HTTPServer(headers.RedirectHTTPS(cfg.Port))
+		redirect.Addr = ":" + cfg.HTTPRedirectPort
+		servers = append(servers, redirect)
+		go func() {
+			slog.Info("redirecting to https", "port", cfg.HTTPRedirectPort)
+			errs <- redirect.ListenAndServe()
+		}()
+	}
+
+	go func() {
+		slog.Info("listening", "port", cfg.Port)
+		errs <- server.ListenAndServeTLS(cfg.CertFile, cfg.KeyFile)
+	}()
+
+	// on SIGTERM stop taking new connections and let the ones in flight finish
+	stop, cancel := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer cancel()
+	var serveErr error
+	select {
+	case serveErr = <-errs:
+		// returned once everything is closed, so the command fails with it
+		slog.Info("shutting down, a server stopped")
+	case <-stop.Done():
+		slog.Info("shutting down")
+		// fail /readyz for a while so load balancers stop sending requests before the connections close
+		checker.Drain()
+		time.Sleep(time.Duration(cfg.Server.DrainDelay) * time.Second)
+	}
+
+	ctx, done := context.WithTimeout(context.Background(), time.Duration(cfg.Server.ShutdownTimeout)*time.Second)
+	defer done()
+	for _, s := range servers {
+		if err := s.Shutdown(ctx); err != nil {
+			slog.Error("shutting down server", "addr", s.Addr, "error", err)
+		}
+	}
+	if err := d.db.Close(); err != nil {
+		slog.Error("closing database", "error", err)
+	}
+	if err := shutdownTracing(ctx); err != nil {
+		slog.Error("flushing spans", "error", err)
+	}
+	if serveErr != nil {
+		return fmt.Errorf("serving: %w", serveErr)
+	}
+	slog.Info("stopped")
+	return nil
+}
@@ -0,0 +1,42 @@
+// called by the Google Maps script once it is loaded
+function initMap() {
+    const mapElement = document.getElementById("map");
+    const map = new google.maps.Map(mapElement, {
+        center: { lat: 1.3521, lng: 103.8198 },
+        zoom: 12,
+        mapId: mapElement.dataset.mapId,
+        options: { disableDefaultUI: true, zoomControl: true }
+    });
+
+    document.querySelectorAll("#markers .marker").forEach(function (content) {
+        addMarker(map, {
+            coords: { lat: parseFloat(content.dataset.lat), lng: parseFloat(content.dataset.lng) },
+            content: content,
+            iconImage: content.dataset.mine == "true"
+                ? "https://cdn.discordapp.com/emojis/785888573328457728.png?v=1"
+                : "https://cdn.discordapp.com/emojis/785883192539217961.png?v=1"
+        });
+    });
+}
+
+function addMarker(map, props) {
+    const marker = new google.maps.Marker({
+        position: props.coords,
+        map: map,
+        icon: {
+            scaledSize: new google.maps.Size(30, 30),
+            url: props.iconImage
+        },
+    });
+
+    // the content is an element so nothing in it is parsed as html again
+    const infoWindow = new google.maps.InfoWindow({
+        content: props.content
+    });
+
+    marker.addListener("click", function () {
+        infoWindow.open(map, marker);
+    });
+}
+
+window.initMap = initMap;
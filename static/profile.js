@@ -0,0 +1,6 @@
+// show the job details only to people looking for a job
+document.querySelectorAll("input[name=options]").forEach(function (option) {
+    option.addEventListener("change", function () {
+        document.getElementById("info").hidden = option.value == "No";
+    });
+});
@@ -0,0 +1,376 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/user"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/teojiahao/HireMe/pkg/api"
+	"github.com/teojiahao/HireMe/pkg/audit"
+	"github.com/teojiahao/HireMe/pkg/config"
+	"github.com/teojiahao/HireMe/pkg/database"
+	"github.com/teojiahao/HireMe/pkg/security"
+	"github.com/teojiahao/HireMe/pkg/throttle"
+	"github.com/teojiahao/HireMe/pkg/totp"
+)
+
+// usernames the commands create, the pages accept more but these are safe in urls and shells
+var validUsername = regexp.MustCompile(`^[A-Za-z0-9._-]{1,30}$`)
+
+// actor return the name the commands are recorded under in the audit log, the login of the
+// operator running them
+func actor() string {
+	name := os.Getenv("USER")
+	if u, err := user.Current(); err == nil {
+		name = u.Username
+	}
+	// the Actor column is 30 long
+	name = "cli:" + name
+	if len(name) > 30 {
+		name = name[:30]
+	}
+	return name
+}
+
+// newAuditLog return the audit log of the commands, the same chain the server appends to
+func newAuditLog(cfg config.Config, db *database.DB) *audit.Log {
+	return audit.NewLog(database.NewAuditStore(db), cfg.AuditKey())
+}
+
+// record the action in the audit log under the operator running the command
+func record(log *audit.Log, action audit.Action, target string, changes []audit.Change) error {
+	return log.Record(actor(), action, target, "", changes)
+}
+
+// newPassword return the password read from the first line of stdin, or a generated one,
+// checked against the password policy
+func newPassword(passwords *security.Passwords, stdin bool) (password string, generated bool, err error) {
+	if !stdin {
+		password, err = passwords.Policy.Generate()
+		return password, true, err
+	}
+	password, err = bufio.NewReader(os.Stdin).ReadString('\n')
+	if err != nil && err != io.EOF {
+		return "", false, err
+	}
+	password = strings.TrimRight(password, "\r\n")
+	return password, false, passwords.Check(password)
+}
+
+// one username has to follow the flags
+func usernameArg(flags *flag.FlagSet) (string, error) {
+	if flags.NArg() != 1 {
+		return "", fmt.Errorf("%s takes one username", flags.Name())
+	}
+	return flags.Arg(0), nil
+}
+
+// existingUser return the user named by the arg, the error says so when there is none
+func existingUser(ctx context.Context, db *database.DB, flags *flag.FlagSet) (database.User, error) {
+	username, err := usernameArg(flags)
+	if err != nil {
+		return database.User{}, err
+	}
+	u, err := db.GetUser(ctx, username)
+	if err == database.ErrNoUser {
+		return u, fmt.Errorf("user %q not found", username)
+	}
+	return u, err
+}
+
+// subcommand picks the subcommand named by the first arg
+func subcommand(name string, args []string, subs map[string]func([]string) error) error {
+	names := []string{}
+	for n := range subs {
+		names = append(names, n)
+	}
+	sort.Strings(names)
+	if len(args) == 0 {
+		return fmt.Errorf("%s needs one of %s", name, strings.Join(names, ", "))
+	}
+	run, ok := subs[args[0]]
+	if !ok {
+		return fmt.Errorf("unknown %s command %q, use one of %s", name, args[0], strings.Join(names, ", "))
+	}
+	return run(args[1:])
+}
+
+// userCommand runs the user commands
+func userCommand(cfg config.Config, d deps, args []string) error {
+	ctx := context.Background()
+	twoFactor := totp.NewManager(database.NewTwoFactorStore(d.db), cfg.TwoFactor.Issuer)
+	logins := throttle.NewGuard(database.NewThrottleStore(d.db))
+	log := newAuditLog(cfg, d.db)
+
+	return subcommand("user", args, map[string]func([]string) error{
+		"create": func(args []string) error {
+			flags := flag.NewFlagSet("create", flag.ExitOnError)
+			stdin := flags.Bool("password-stdin", false, "read the password from stdin instead of generating one")
+			flags.Parse(args)
+			username, err := usernameArg(flags)
+			if err != nil {
+				return err
+			}
+			if !validUsername.MatchString(username) {
+				return fmt.Errorf("username %q has to be up to 30 letters, digits, '.', '_' or '-'", username)
+			}
+
+			password, generated, err := newPassword(d.passwords, *stdin)
+			if err != nil {
+				return err
+			}
+			hash, err := d.passwords.Hash(password)
+			if err != nil {
+				return err
+			}
+			key, sealed, err := api.NewAccessKey(d.keyring)
+			if err != nil {
+				return err
+			}
+			errs := make(chan error, 1)
+			d.db.InsertUser(ctx, username, hash, sealed, errs)
+			if err := <-errs; err != nil {
+				return fmt.Errorf("user %q already exists", username)
+			}
+			if err := record(log, audit.UserCreate, username, nil); err != nil {
+				return err
+			}
+			if err := record(log, audit.KeyIssue, username, nil); err != nil {
+				return err
+			}
+
+			if generated {
+				fmt.Printf("password: %s\n", password)
+			}
+			fmt.Printf("access key: %s\n", key)
+			return nil
+		},
+
+		"list": func(args []string) error {
+			flags := flag.NewFlagSet("list", flag.ExitOnError)
+			asJSON := flags.Bool("json", false, "print the users as JSON")
+			flags.Parse(args)
+
+			all := d.db.GetAllUser(ctx)
+			users := []userInfo{}
+			for _, u := range all {
+				info, err := newUserInfo(u, twoFactor)
+				if err != nil {
+					return err
+				}
+				users = append(users, info)
+			}
+			sort.Slice(users, func(i, j int) bool { return users[i].Username < users[j].Username })
+			if *asJSON {
+				return json.NewEncoder(os.Stdout).Encode(users)
+			}
+
+			tw := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+			fmt.Fprintln(tw, "USERNAME\tDISPLAY\tHIDDEN\tDISABLED\tTWO_FACTOR\tKEY\tEMAIL")
+			for _, u := range users {
+				fmt.Fprintf(tw, "%s\t%s\t%t\t%t\t%t\t%t\t%s\n", u.Username, u.Display, u.Hidden, u.Disabled, u.TwoFactor, u.HasKey, u.Email)
+			}
+			return tw.Flush()
+		},
+
+		"show": func(args []string) error {
+			flags := flag.NewFlagSet("show", flag.ExitOnError)
+			flags.Parse(args)
+			u, err := existingUser(ctx, d.db, flags)
+			if err != nil {
+				return err
+			}
+			info, err := newUserInfo(u, twoFactor)
+			if err != nil {
+				return err
+			}
+			out := json.NewEncoder(os.Stdout)
+			out.SetIndent("", "  ")
+			return out.Encode(info)
+		},
+
+		"disable": func(args []string) error {
+			return setDisabled(ctx, d.db, log, "disable", args, true)
+		},
+
+		"enable": func(args []string) error {
+			return setDisabled(ctx, d.db, log, "enable", args, false)
+		},
+
+		"delete": func(args []string) error {
+			flags := flag.NewFlagSet("delete", flag.ExitOnError)
+			yes := flags.Bool("yes", false, "confirm the user and the data of the user are removed for good")
+			flags.Parse(args)
+			u, err := existingUser(ctx, d.db, flags)
+			if err != nil {
+				return err
+			}
+			if !*yes {
+				return fmt.Errorf("deleting %q cannot be undone, add -yes to go ahead", u.Username)
+			}
+			if err := d.db.DeleteUser(ctx, u.Username); err != nil {
+				return err
+			}
+			// a user created again with the name starts without lockouts
+			if err := logins.Succeeded(u.Username); err != nil {
+				return err
+			}
+			if err := record(log, audit.UserDelete, u.Username, nil); err != nil {
+				return err
+			}
+			fmt.Printf("deleted %s\n", u.Username)
+			return nil
+		},
+
+		"reset-password": func(args []string) error {
+			flags := flag.NewFlagSet("reset-password", flag.ExitOnError)
+			stdin := flags.Bool("password-stdin", false, "read the password from stdin instead of generating one")
+			flags.Parse(args)
+			u, err := existingUser(ctx, d.db, flags)
+			if err != nil {
+				return err
+			}
+			password, generated, err := newPassword(d.passwords, *stdin)
+			if err != nil {
+				return err
+			}
+			hash, err := d.passwords.Hash(password)
+			if err != nil {
+				return err
+			}
+			if err := d.db.UpdatePassword(ctx, u.Username, hash); err != nil {
+				return err
+			}
+			// the user was most likely locked out trying the old one
+			if err := logins.Succeeded(u.Username); err != nil {
+				return err
+			}
+			if err := record(log, audit.PasswordReset, u.Username, nil); err != nil {
+				return err
+			}
+			if generated {
+				fmt.Printf("password: %s\n", password)
+			}
+			return nil
+		},
+	})
+}
+
+// setDisabled runs user disable and user enable
+func setDisabled(ctx context.Context, db *database.DB, log *audit.Log, name string, args []string, disabled bool) error {
+	flags := flag.NewFlagSet(name, flag.ExitOnError)
+	flags.Parse(args)
+	u, err := existingUser(ctx, db, flags)
+	if err != nil {
+		return err
+	}
+	if u.Disabled == disabled {
+		fmt.Printf("%s is already %sd\n", u.Username, name)
+		return nil
+	}
+	if err := db.SetDisabled(ctx, u.Username, disabled); err != nil {
+		return err
+	}
+	action := audit.UserEnable
+	if disabled {
+		action = audit.UserDisable
+	}
+	changes := []audit.Change{{Field: "Disabled", Before: strconv.FormatBool(u.Disabled), After: strconv.FormatBool(disabled)}}
+	if err := record(log, action, u.Username, changes); err != nil {
+		return err
+	}
+	fmt.Printf("%sd %s\n", name, u.Username)
+	return nil
+}
+
+// userInfo is what user list and user show print, the password and key are left out
+type userInfo struct {
+	Username       string
+	Display        string
+	JobType        string
+	Skill          string
+	Exp            int
+	UnemployedDate string
+	Message        string
+	Email          string
+	Disabled       bool
+	Hidden         bool
+	TwoFactor      bool
+	HasKey         bool
+	// KeyID is the encryption key the access key is sealed under
+	KeyID string `json:",omitempty"`
+}
+
+func newUserInfo(u database.User, twoFactor *totp.Manager) (userInfo, error) {
+	enabled, err := twoFactor.Enabled(u.Username)
+	if err != nil {
+		return userInfo{}, err
+	}
+	info := userInfo{u.Username, u.Display, u.JobType, u.Skill, u.Exp, u.UnemployedDate, u.Message, u.Email,
+		u.Disabled, u.Hidden, enabled, len(u.AccessKey) > 0, ""}
+	if info.HasKey {
+		info.KeyID, _ = security.KeyID(u.AccessKey)
+	}
+	return info, nil
+}
+
+// apikeyCommand runs the apikey commands
+func apikeyCommand(cfg config.Config, d deps, args []string) error {
+	ctx := context.Background()
+	log := newAuditLog(cfg, d.db)
+
+	return subcommand("apikey", args, map[string]func([]string) error{
+		"issue": func(args []string) error {
+			flags := flag.NewFlagSet("issue", flag.ExitOnError)
+			flags.Parse(args)
+			u, err := existingUser(ctx, d.db, flags)
+			if err != nil {
+				return err
+			}
+			key, sealed, err := api.NewAccessKey(d.keyring)
+			if err != nil {
+				return err
+			}
+			if err := d.db.SetAccessKey(ctx, u.Username, sealed); err != nil {
+				return err
+			}
+			if err := record(log, audit.KeyIssue, u.Username, nil); err != nil {
+				return err
+			}
+			// only the key, so a script can take it as is
+			fmt.Println(key)
+			return nil
+		},
+
+		"revoke": func(args []string) error {
+			flags := flag.NewFlagSet("revoke", flag.ExitOnError)
+			flags.Parse(args)
+			u, err := existingUser(ctx, d.db, flags)
+			if err != nil {
+				return err
+			}
+			if len(u.AccessKey) == 0 {
+				return errors.New("the user has no key")
+			}
+			if err := d.db.SetAccessKey(ctx, u.Username, nil); err != nil {
+				return err
+			}
+			if err := record(log, audit.KeyRevoke, u.Username, nil); err != nil {
+				return err
+			}
+			fmt.Printf("revoked the key of %s, a new one is issued on the next login\n", u.Username)
+			return nil
+		},
+	})
+}